@@ -0,0 +1,153 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A curve is a family of closed plane curves.
+type curve struct {
+	// point returns the point at t of the curve with the given phase,
+	// scaled to lie within [-1, 1]².
+	point func(p *params, t, phase float64) (x, y float64)
+	// turns returns the number of turns of t after which the curve
+	// closes, or 0 if it does not.
+	turns func(p *params) float64
+}
+
+var curves = map[string]curve{
+	"lissajous":  {lissajous, func(*params) float64 { return 0 }},
+	"spirograph": {hypotrochoid, hypotrochoidTurns},
+	"rose":       {rose, roseTurns},
+}
+
+// defaultTurns is the length of a curve that does not close.
+const defaultTurns = 5
+
+func lissajous(p *params, t, phase float64) (x, y float64) {
+	return math.Sin(t), math.Sin(t*p.freq + phase)
+}
+
+// hypotrochoid traces a pen at distance d from the center of a circle of
+// radius r rolling inside one of radius R, as a spirograph does. The
+// phase turns the pen about the rolling circle.
+func hypotrochoid(p *params, t, phase float64) (x, y float64) {
+	a := (p.R - p.r) / p.r
+	x = (p.R-p.r)*math.Cos(t) + p.d*math.Cos(a*t+phase)
+	y = (p.R-p.r)*math.Sin(t) - p.d*math.Sin(a*t+phase)
+	scale := math.Abs(p.R-p.r) + p.d
+	if scale == 0 {
+		return 0, 0
+	}
+	return x / scale, y / scale
+}
+
+// hypotrochoidTurns returns the number of times the rolling circle
+// goes around before the pen returns to its start, r/gcd(R, r), if the
+// radii are integers.
+func hypotrochoidTurns(p *params) float64 {
+	if p.R != math.Trunc(p.R) || p.r != math.Trunc(p.r) {
+		return 0
+	}
+	return p.r / float64(gcd(int(p.R), int(p.r)))
+}
+
+// rose traces the rhodonea r = cos(kθ).
+func rose(p *params, t, phase float64) (x, y float64) {
+	k := p.k
+	if k == 0 {
+		k = float64(p.kp) / float64(p.kq)
+	}
+	r := math.Cos(k*t + phase)
+	return r * math.Cos(t), r * math.Sin(t)
+}
+
+// roseTurns returns the period of a rose whose k is the ratio p/q in
+// lowest terms: πq if p and q are both odd, and 2πq otherwise.
+func roseTurns(p *params) float64 {
+	if p.k != 0 {
+		return 0
+	}
+	if p.kp%2 == 1 && p.kq%2 == 1 {
+		return float64(p.kq) / 2
+	}
+	return float64(p.kq)
+}
+
+// turns returns the number of turns of t to draw.
+func (p *params) turns() float64 {
+	if p.cycles > 0 {
+		return p.cycles
+	}
+	if n := curves[p.curve].turns(p); n > 0 {
+		return n
+	}
+	return defaultTurns
+}
+
+// palette returns the palette of the animation: the background, then
+// the gradient, then a transparent color for the frame-delta encoders.
+func (p *params) palette() color.Palette {
+	pal := color.Palette{p.bg}
+	for i := 0; i < p.colors; i++ {
+		var u float64
+		if p.colors > 1 {
+			u = float64(i) / float64(p.colors-1)
+		}
+		pal = append(pal, gradient(p.stops, u))
+	}
+	return append(pal, color.RGBA{})
+}
+
+// gradient returns the color a fraction u of the way along stops.
+func gradient(stops []color.RGBA, u float64) color.RGBA {
+	if len(stops) == 1 {
+		return stops[0]
+	}
+	f := u * float64(len(stops)-1)
+	i := int(f)
+	if i >= len(stops)-1 {
+		return stops[len(stops)-1]
+	}
+	f -= float64(i)
+	a, b := stops[i], stops[i+1]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xFF}
+}
+
+// draw returns the frames of the animation. Along the curve, the
+// color moves through the gradient from start to end.
+func (p *params) draw() []*image.Paletted {
+	pal := p.palette()
+	point := curves[p.curve].point
+	tmax := p.turns() * 2 * math.Pi
+	rect := image.Rect(0, 0, 2*p.size+1, 2*p.size+1)
+	frames := make([]*image.Paletted, p.frames)
+	for i := range frames {
+		img := image.NewPaletted(rect, pal)
+		phase := float64(i) * p.phase
+		for t := 0.0; t < tmax; t += p.res {
+			x, y := point(p, t, phase)
+			ci := 1 + int(t/tmax*float64(p.colors))
+			if ci > p.colors {
+				ci = p.colors
+			}
+			p.plot(img, p.size+int(x*float64(p.size)+0.5), p.size+int(y*float64(p.size)+0.5), uint8(ci))
+		}
+		frames[i] = img
+	}
+	return frames
+}
+
+// plot sets a square of side p.line centered on (x, y) to color index ci.
+func (p *params) plot(img *image.Paletted, x, y int, ci uint8) {
+	lo := -(p.line - 1) / 2
+	for dy := lo; dy < lo+p.line; dy++ {
+		for dx := lo; dx < lo+p.line; dx++ {
+			img.SetColorIndex(x+dx, y+dy, ci)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"io"
+)
+
+// delta returns the part of cur that differs from prev: the smallest
+// rectangle holding every changed pixel, in which the unchanged pixels
+// have the transparent color index, so that cur is prev with the delta
+// drawn over it. If nothing changed, the delta is a single transparent
+// pixel, since neither GIF nor APNG allows an empty frame.
+func delta(prev, cur *image.Paletted, transparent uint8) *image.Paletted {
+	b := cur.Bounds()
+	r := image.Rectangle{Min: b.Max, Max: b.Min}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if i := cur.PixOffset(x, y); cur.Pix[i] != prev.Pix[i] {
+				if x < r.Min.X {
+					r.Min.X = x
+				}
+				if x >= r.Max.X {
+					r.Max.X = x + 1
+				}
+				if y < r.Min.Y {
+					r.Min.Y = y
+				}
+				r.Max.Y = y + 1
+			}
+		}
+	}
+	if r.Empty() {
+		r = image.Rectangle{Min: b.Min, Max: b.Min.Add(image.Pt(1, 1))}
+	}
+	d := image.NewPaletted(r, cur.Palette)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			ci := cur.ColorIndexAt(x, y)
+			if ci == prev.ColorIndexAt(x, y) {
+				ci = transparent
+			}
+			d.SetColorIndex(x, y, ci)
+		}
+	}
+	return d
+}
+
+// deltas returns the first frame followed by the delta of each frame
+// from its predecessor. The last color of the palette is transparent.
+func deltas(frames []*image.Paletted) []*image.Paletted {
+	out := []*image.Paletted{frames[0]}
+	transparent := uint8(len(frames[0].Palette) - 1)
+	for i := 1; i < len(frames); i++ {
+		out = append(out, delta(frames[i-1], frames[i], transparent))
+	}
+	return out
+}
+
+// encodeGIF writes frames as an endlessly looping animated GIF, each
+// shown for delay hundredths of a second.
+func encodeGIF(w io.Writer, frames []*image.Paletted, delay int) error {
+	b := frames[0].Bounds()
+	anim := gif.GIF{
+		Config: image.Config{ColorModel: frames[0].Palette, Width: b.Dx(), Height: b.Dy()},
+	}
+	for _, img := range deltas(frames) {
+		anim.Image = append(anim.Image, img)
+		anim.Delay = append(anim.Delay, delay)
+		anim.Disposal = append(anim.Disposal, gif.DisposalNone)
+	}
+	return gif.EncodeAll(w, &anim)
+}
+
+// APNG frame composition operators.
+const (
+	disposeNone = 0
+	blendSource = 0
+	blendOver   = 1
+)
+
+// encodeAPNG writes frames as an endlessly looping animated PNG, each
+// shown for delay hundredths of a second. The first frame is also the
+// image that decoders unaware of animation show.
+func encodeAPNG(w io.Writer, frames []*image.Paletted, delay int) error {
+	bw := bufio.NewWriter(w)
+	e := &apngEncoder{w: bw}
+	b := frames[0].Bounds()
+	bw.WriteString("\x89PNG\r\n\x1a\n")
+
+	e.chunk("IHDR", be32(uint32(b.Dx())), be32(uint32(b.Dy())), []byte{8, 3, 0, 0, 0}) // 8-bit paletted
+	e.chunk("acTL", be32(uint32(len(frames))), be32(0))                                // loop forever
+	var plte, trns []byte
+	for _, c := range frames[0].Palette {
+		r, g, b, a := c.RGBA()
+		plte = append(plte, byte(r>>8), byte(g>>8), byte(b>>8))
+		trns = append(trns, byte(a>>8))
+	}
+	e.chunk("PLTE", plte)
+	e.chunk("tRNS", trns)
+
+	for i, img := range deltas(frames) {
+		r := img.Bounds()
+		blend := byte(blendOver)
+		if i == 0 {
+			blend = blendSource
+		}
+		e.chunk("fcTL", e.next(),
+			be32(uint32(r.Dx())), be32(uint32(r.Dy())),
+			be32(uint32(r.Min.X-b.Min.X)), be32(uint32(r.Min.Y-b.Min.Y)),
+			be16(uint16(delay)), be16(100), []byte{disposeNone, blend})
+		data, err := compress(img)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			e.chunk("IDAT", data)
+		} else {
+			e.chunk("fdAT", e.next(), data)
+		}
+	}
+	e.chunk("IEND")
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+// An apngEncoder writes PNG chunks, numbering the animation chunks.
+type apngEncoder struct {
+	w   io.Writer
+	seq uint32
+	err error
+}
+
+// next returns the next sequence number for an fcTL or fdAT chunk.
+func (e *apngEncoder) next() []byte {
+	e.seq++
+	return be32(e.seq - 1)
+}
+
+// chunk writes a chunk of the given type whose data is the
+// concatenation of parts.
+func (e *apngEncoder) chunk(typ string, parts ...[]byte) {
+	if e.err != nil {
+		return
+	}
+	var data []byte
+	for _, p := range parts {
+		data = append(data, p...)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(typ))
+	crc.Write(data)
+	for _, b := range [][]byte{be32(uint32(len(data))), []byte(typ), data, be32(crc.Sum32())} {
+		if _, err := e.w.Write(b); err != nil {
+			e.err = err
+			return
+		}
+	}
+}
+
+// compress returns the zlib-compressed scanlines of img, each with
+// filter type None.
+func compress(img *image.Paletted) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	r := img.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := img.PixOffset(r.Min.X, y)
+		zw.Write([]byte{0})
+		zw.Write(img.Pix[i : i+r.Dx()])
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func be32(v uint32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return b[:]
+}
+
+func be16(v uint16) []byte {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return b[:]
+}
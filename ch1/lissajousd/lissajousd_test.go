@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func mustParams(t *testing.T, query string) *params {
+	t.Helper()
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseParams(q)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return p
+}
+
+func TestParams(t *testing.T) {
+	p := mustParams(t, "curve=rose&k=6/4&size=50&palette=ff0000,0000ff&colors=3&bg=%23000000")
+	if p.kp != 3 || p.kq != 2 || p.size != 50 || len(p.stops) != 2 || p.bg.R != 0 {
+		t.Errorf("got %+v", p)
+	}
+	pal := p.palette()
+	if len(pal) != 5 {
+		t.Fatalf("palette has %d colors, want bg + 3 + transparent", len(pal))
+	}
+	if r, _, b, _ := pal[2].RGBA(); r>>8 != 0x80 || b>>8 != 0x80 {
+		t.Errorf("middle of gradient = %v", pal[2])
+	}
+	if _, _, _, a := pal[4].RGBA(); a != 0 {
+		t.Errorf("last color %v is not transparent", pal[4])
+	}
+
+	for _, query := range []string{
+		"curve=spiral",
+		"size=0",
+		"size=big",
+		"frames=100000",
+		"res=0",
+		"freq=NaN",
+		"k=3/0",
+		"k=-2",
+		"k=2000",
+		"bg=red",
+		"palette=plaid",
+		"palette=ff0000,00ff",
+		"format=webp",
+		"cycles=1000&res=0.00001",
+		"size=1000&frames=200",
+		"line=20&cycles=10&res=0.0001",
+	} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseParams(q); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+}
+
+func TestTurns(t *testing.T) {
+	for _, test := range []struct {
+		query string
+		want  float64
+	}{
+		{"curve=lissajous", defaultTurns},
+		{"curve=lissajous&cycles=2", 2},
+		{"curve=spirograph&R=5&r=3", 3},
+		{"curve=spirograph&R=6&r=4", 2},
+		{"curve=spirograph&R=5.5&r=3", defaultTurns},
+		{"curve=rose&k=5", 0.5},
+		{"curve=rose&k=2", 1},
+		{"curve=rose&k=7/4", 4},
+		{"curve=rose&k=3/5", 2.5},
+		{"curve=rose&k=2.5", 2},
+		{"curve=rose&k=1.1", 10},
+		{"curve=rose&k=0.3183098861837907", defaultTurns},
+	} {
+		if got := mustParams(t, test.query).turns(); got != test.want {
+			t.Errorf("%s: turns = %g, want %g", test.query, got, test.want)
+		}
+	}
+}
+
+// A closed curve ends where it began.
+func TestClosed(t *testing.T) {
+	for _, query := range []string{"curve=spirograph&R=7&r=4&d=3", "curve=rose&k=7/4", "curve=rose&k=3"} {
+		p := mustParams(t, query)
+		pt := curves[p.curve].point
+		x0, y0 := pt(p, 0, 0.3)
+		x1, y1 := pt(p, p.turns()*2*3.141592653589793, 0.3)
+		if d := (x1-x0)*(x1-x0) + (y1-y0)*(y1-y0); d > 1e-18 {
+			t.Errorf("%s: curve ends (%g, %g) from its start", query, x1-x0, y1-y0)
+		}
+	}
+}
+
+func TestGIF(t *testing.T) {
+	p := mustParams(t, "freq=1.5&frames=10&size=60&palette=rainbow")
+	frames := p.draw()
+	var buf bytes.Buffer
+	if err := encodeGIF(&buf, frames, p.delay); err != nil {
+		t.Fatal(err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(frames) {
+		t.Fatalf("decoded %d frames, want %d", len(anim.Image), len(frames))
+	}
+	canvas := image.NewRGBA(frames[0].Bounds())
+	for i, img := range anim.Image {
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+		if !same(canvas, frames[i]) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+func TestDelta(t *testing.T) {
+	pal := mustParams(t, "colors=2").palette()
+	transparent := uint8(len(pal) - 1)
+	r := image.Rect(0, 0, 20, 20)
+	prev, cur := image.NewPaletted(r, pal), image.NewPaletted(r, pal)
+	prev.SetColorIndex(3, 4, 1)
+	cur.SetColorIndex(3, 4, 1)
+	cur.SetColorIndex(5, 6, 2)
+	cur.SetColorIndex(9, 5, 1)
+
+	d := delta(prev, cur, transparent)
+	if want := image.Rect(5, 5, 10, 7); d.Bounds() != want {
+		t.Fatalf("delta bounds = %v, want %v", d.Bounds(), want)
+	}
+	for _, test := range []struct {
+		x, y int
+		want uint8
+	}{{5, 6, 2}, {9, 5, 1}, {5, 5, transparent}, {9, 6, transparent}} {
+		if ci := d.ColorIndexAt(test.x, test.y); ci != test.want {
+			t.Errorf("delta(%d, %d) = %d, want %d", test.x, test.y, ci, test.want)
+		}
+	}
+
+	d = delta(cur, cur, transparent)
+	if d.Bounds().Dx() != 1 || d.Bounds().Dy() != 1 || d.Pix[0] != transparent {
+		t.Errorf("delta of identical frames = %v %v", d.Bounds(), d.Pix)
+	}
+
+	// An animation that changes little encodes to much less than
+	// its whole frames.
+	frames := []*image.Paletted{prev, cur, prev, cur}
+	var deltaGIF, wholeGIF bytes.Buffer
+	if err := encodeGIF(&deltaGIF, frames, 8); err != nil {
+		t.Fatal(err)
+	}
+	gif.EncodeAll(&wholeGIF, &gif.GIF{Image: frames, Delay: make([]int, len(frames))})
+	if deltaGIF.Len()*3/2 > wholeGIF.Len() {
+		t.Errorf("delta-encoded GIF is %d bytes, whole frames %d", deltaGIF.Len(), wholeGIF.Len())
+	}
+}
+
+func TestAPNG(t *testing.T) {
+	p := mustParams(t, "curve=spirograph&frames=6&size=40&line=2&palette=sunset&format=apng")
+	frames := p.draw()
+	var buf bytes.Buffer
+	if err := encodeAPNG(&buf, frames, p.delay); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Decoders unaware of animation see the first frame.
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same(img, frames[0]) {
+		t.Errorf("default image differs from first frame")
+	}
+
+	// Replay the animation chunks.
+	canvas := image.NewRGBA(frames[0].Bounds())
+	var seq uint32
+	var rect image.Rectangle
+	var got []*image.RGBA
+	be := binary.BigEndian
+	for data = data[8:]; len(data) > 0; {
+		n := be.Uint32(data)
+		typ, body := string(data[4:8]), data[8:8+n]
+		if crc := crc32.ChecksumIEEE(data[4 : 8+n]); crc != be.Uint32(data[8+n:]) {
+			t.Fatalf("%s chunk: bad CRC", typ)
+		}
+		data = data[12+n:]
+		switch typ {
+		case "acTL":
+			if nf := be.Uint32(body); nf != uint32(len(frames)) {
+				t.Errorf("acTL says %d frames, want %d", nf, len(frames))
+			}
+		case "fcTL", "fdAT":
+			if s := be.Uint32(body); s != seq {
+				t.Fatalf("%s sequence number %d, want %d", typ, s, seq)
+			}
+			seq++
+			if typ == "fcTL" {
+				w, h, x, y := be.Uint32(body[4:]), be.Uint32(body[8:]), be.Uint32(body[12:]), be.Uint32(body[16:])
+				rect = image.Rect(int(x), int(y), int(x+w), int(y+h))
+				continue
+			}
+			body = body[4:]
+			fallthrough
+		case "IDAT":
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pix, err := ioutil.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fr := image.NewPaletted(rect, frames[0].Palette)
+			for y := 0; y < rect.Dy(); y++ {
+				row := pix[y*(rect.Dx()+1):]
+				if row[0] != 0 {
+					t.Fatalf("row filter %d", row[0])
+				}
+				copy(fr.Pix[y*fr.Stride:], row[1:1+rect.Dx()])
+			}
+			draw.Draw(canvas, rect, fr, rect.Min, draw.Over)
+			got = append(got, image.NewRGBA(canvas.Bounds()))
+			copy(got[len(got)-1].Pix, canvas.Pix)
+		}
+	}
+	if len(got) != len(frames) {
+		t.Fatalf("replayed %d frames, want %d", len(got), len(frames))
+	}
+	for i := range got {
+		if !same(got[i], frames[i]) {
+			t.Errorf("frame %d differs", i)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(handler))
+	defer ts.Close()
+	for _, test := range []struct {
+		query, ctype string
+		code         int
+	}{
+		{"curve=rose&frames=2", "image/gif", http.StatusOK},
+		{"curve=rose&frames=2&format=apng", "image/apng", http.StatusOK},
+		{"curve=rose&k=x", "text/plain; charset=utf-8", http.StatusBadRequest},
+		{"size=1000&frames=1000", "text/plain; charset=utf-8", http.StatusBadRequest},
+	} {
+		resp, err := http.Get(ts.URL + "/?" + test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.code || resp.Header.Get("Content-Type") != test.ctype {
+			t.Errorf("%s: %d %s, want %d %s", test.query, resp.StatusCode,
+				resp.Header.Get("Content-Type"), test.code, test.ctype)
+		}
+	}
+}
+
+// same reports whether a and b have the same colors.
+func same(a, b image.Image) bool {
+	r := a.Bounds()
+	if r != b.Bounds() {
+		return false
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r1, g1, b1, a1 := a.At(x, y).RGBA()
+			r2, g2, b2, a2 := b.At(x, y).RGBA()
+			if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// A request waiting for its turn to draw gives up when its client does.
+func TestWaiting(t *testing.T) {
+	for i := 0; i < cap(sema); i++ {
+		sema <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < cap(sema); i++ {
+			<-sema
+		}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest("GET", "/?size=10&frames=2", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Body.Len() != 0 {
+		t.Errorf("waiting cancelled request wrote %d bytes", w.Body.Len())
+	}
+}
@@ -0,0 +1,122 @@
+// Lissajousd serves animations of Lissajous figures, spirograph
+// curves (hypotrochoids) and roses, generalizing gopl.io/ch1/lissajous.
+//
+// Every parameter is a query field:
+//
+//	curve    lissajous (default), spirograph or rose
+//	size     the canvas covers [-size..+size] (default 100)
+//	frames   number of frames (64)
+//	delay    delay between frames in 10ms units (8)
+//	cycles   turns of t to draw (default: until the curve closes, or 5)
+//	res      angular resolution (0.001)
+//	phase    phase change per frame in radians (0.1)
+//	line     line width in pixels (1)
+//	freq     lissajous: relative frequency of the y oscillator (random)
+//	R, r, d  spirograph: radii of the fixed and rolling circles and
+//	         the pen's distance from the rolling circle's center (5, 3, 5)
+//	k        rose: petal ratio in r = cos(kθ), as p/q or a number (5)
+//	bg       background color RRGGBB (ffffff)
+//	palette  gradient along the curve: black (default), green, sunset,
+//	         ocean, rainbow, or a comma-separated list of RRGGBB colors
+//	colors   number of colors in the gradient (64)
+//	format   gif (default) or apng
+//
+// Requests for animations too large to draw in reasonable time and
+// memory, counting both the pixels of the frames and the points of
+// the curve, are rejected with status 400. At most -limit animations
+// are drawn at once; other requests wait their turn.
+//
+// Each frame after the first is encoded as just the rectangle that
+// changed, with the unchanged pixels within it transparent, which
+// compress to almost nothing.
+//
+// Given a query as its argument, lissajousd writes that animation to
+// the standard output instead of serving:
+//
+//	$ go run ./ch1/lissajousd -http=localhost:8000 &
+//	$ curl 'localhost:8000/?curve=rose&k=7/4&palette=sunset&format=apng' > rose.png
+//	$ go run ./ch1/lissajousd 'curve=spirograph&R=7&r=4&d=3' > spiro.gif
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+)
+
+// sema limits the number of animations drawn at once.
+var sema = make(chan struct{}, runtime.NumCPU())
+
+func main() {
+	addr := flag.String("http", "", "serve animations on `address`")
+	limit := flag.Int("limit", runtime.NumCPU(), "number of animations to draw at once")
+	flag.Parse()
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	if *addr != "" {
+		if *limit < 1 {
+			fmt.Fprintln(os.Stderr, "lissajousd: -limit must be positive")
+			os.Exit(2)
+		}
+		sema = make(chan struct{}, *limit)
+		http.HandleFunc("/", handler)
+		log.Fatal(http.ListenAndServe(*addr, nil))
+	}
+	if flag.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "usage: lissajousd [-http=address | query]")
+		os.Exit(2)
+	}
+	q, err := url.ParseQuery(flag.Arg(0))
+	if err == nil {
+		var p *params
+		if p, err = parseParams(q); err == nil {
+			err = animate(os.Stdout, p)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "lissajousd: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handler(w http.ResponseWriter, r *http.Request) {
+	p, err := parseParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Wait for a turn to draw, unless the client gives up first.
+	select {
+	case sema <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	var buf bytes.Buffer
+	err = animate(&buf, p)
+	<-sema
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/"+p.format)
+	if _, err := buf.WriteTo(w); err != nil {
+		log.Print(err)
+	}
+}
+
+// animate writes the animation described by p to out.
+func animate(out io.Writer, p *params) error {
+	frames := p.draw()
+	if p.format == "apng" {
+		return encodeAPNG(out, frames, p.delay)
+	}
+	return encodeGIF(out, frames, p.delay)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/big"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Limits on the work of one animation.
+const (
+	maxPoints = 1e8 // points computed along the curve
+	maxPixels = 5e8 // pixels drawn, compared and encoded
+)
+
+// params are the parameters of an animation. Each is set by the query
+// field of the same name; see the package documentation.
+type params struct {
+	curve  string
+	size   int     // image canvas covers [-size..+size]
+	frames int     // number of animation frames
+	delay  int     // delay between frames in 10ms units
+	cycles float64 // length of the curve in turns of t; 0 for its own period
+	res    float64 // angular resolution
+	phase  float64 // phase change per frame, in radians
+	line   int     // line width in pixels
+
+	freq    float64 // lissajous: relative frequency of the y oscillator
+	R, r, d float64 // spirograph: radii of the fixed and rolling circles, pen distance
+	kp, kq  int     // rose: the petal ratio k = kp/kq
+	k       float64 // rose: k, if not a ratio of integers
+
+	bg     color.RGBA   // background
+	stops  []color.RGBA // the gradient along the curve
+	colors int          // number of colors in the gradient
+	format string       // "gif" or "apng"
+}
+
+// gradients are the named gradients; the palette parameter also accepts
+// a comma-separated list of hex colors.
+var gradients = map[string][]color.RGBA{
+	"black":   {{0, 0, 0, 0xFF}},
+	"green":   {{0, 0xFF, 0, 0xFF}, {0, 0x99, 0, 0xFF}},
+	"sunset":  {{0xFF, 0xD0, 0x00, 0xFF}, {0xFF, 0x40, 0x00, 0xFF}, {0x80, 0x00, 0x80, 0xFF}},
+	"ocean":   {{0x00, 0xC0, 0xFF, 0xFF}, {0x00, 0x30, 0x80, 0xFF}},
+	"rainbow": {{0xFF, 0, 0, 0xFF}, {0xFF, 0xFF, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0xFF, 0xFF, 0xFF}, {0, 0, 0xFF, 0xFF}, {0xFF, 0, 0xFF, 0xFF}},
+}
+
+// parseParams returns the parameters given by the query q, with
+// defaults for those that are absent. As in gopl.io/ch1/lissajous, the
+// Lissajous frequency is random unless given.
+func parseParams(q url.Values) (*params, error) {
+	p := &params{
+		curve:  "lissajous",
+		size:   100,
+		frames: 64,
+		delay:  8,
+		res:    0.001,
+		phase:  0.1,
+		line:   1,
+		freq:   rand.Float64() * 3.0,
+		R:      5,
+		r:      3,
+		d:      5,
+		kp:     5,
+		kq:     1,
+		bg:     color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+		stops:  gradients["black"],
+		colors: 64,
+		format: "gif",
+	}
+	if s := q.Get("curve"); s != "" {
+		if _, ok := curves[s]; !ok {
+			return nil, fmt.Errorf("unknown curve %q", s)
+		}
+		p.curve = s
+	}
+	for _, f := range []struct {
+		name     string
+		dst      *int
+		min, max int
+	}{
+		{"size", &p.size, 1, 1000},
+		{"frames", &p.frames, 1, 1000},
+		{"delay", &p.delay, 0, 6000},
+		{"line", &p.line, 1, 20},
+		{"colors", &p.colors, 1, 254},
+	} {
+		if s := q.Get(f.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < f.min || n > f.max {
+				return nil, fmt.Errorf("invalid %s %q: want an integer in %d-%d", f.name, s, f.min, f.max)
+			}
+			*f.dst = n
+		}
+	}
+	for _, f := range []struct {
+		name     string
+		dst      *float64
+		min, max float64
+	}{
+		{"cycles", &p.cycles, 0, 1000},
+		{"res", &p.res, 1e-5, 1},
+		{"phase", &p.phase, -2 * math.Pi, 2 * math.Pi},
+		{"freq", &p.freq, 0, 100},
+		{"R", &p.R, 1e-3, 1000},
+		{"r", &p.r, 1e-3, 1000},
+		{"d", &p.d, 0, 1000},
+	} {
+		if s := q.Get(f.name); s != "" {
+			x, err := strconv.ParseFloat(s, 64)
+			if err != nil || !(x >= f.min && x <= f.max) {
+				return nil, fmt.Errorf("invalid %s %q: want a number in %g-%g", f.name, s, f.min, f.max)
+			}
+			*f.dst = x
+		}
+	}
+	if s := q.Get("k"); s != "" {
+		if err := p.parseK(s); err != nil {
+			return nil, err
+		}
+	}
+	if s := q.Get("bg"); s != "" {
+		c, err := parseColor(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bg: %v", err)
+		}
+		p.bg = c
+	}
+	if s := q.Get("palette"); s != "" {
+		stops, err := parseGradient(s)
+		if err != nil {
+			return nil, err
+		}
+		p.stops = stops
+	}
+	if s := q.Get("format"); s != "" {
+		if s != "gif" && s != "apng" {
+			return nil, fmt.Errorf("unknown format %q: want gif or apng", s)
+		}
+		p.format = s
+	}
+	points := float64(p.frames) * p.turns() * 2 * math.Pi / p.res
+	if points > maxPoints {
+		return nil, fmt.Errorf("%d frames of %g turns at resolution %g is too many points", p.frames, p.turns(), p.res)
+	}
+	// Every pixel of each frame is encoded, and every point sets a
+	// square of line² pixels.
+	side := float64(2*p.size + 1)
+	if float64(p.frames)*side*side+points*float64(p.line*p.line) > maxPixels {
+		return nil, fmt.Errorf("%d frames of size %d with %g points of width %d is too many pixels",
+			p.frames, p.size, points, p.line)
+	}
+	return p, nil
+}
+
+// parseK sets the rose's k from s, a ratio p/q or a decimal number.
+// A k whose denominator is too large to close in a reasonable number
+// of turns is treated as irrational.
+func (p *params) parseK(s string) error {
+	k, ok := new(big.Rat).SetString(s)
+	if !ok || k.Sign() <= 0 || k.Cmp(big.NewRat(1000, 1)) > 0 {
+		return fmt.Errorf("invalid k %q: want p/q or a number in (0, 1000]", s)
+	}
+	if k.Denom().IsInt64() && k.Denom().Int64() <= 1000 {
+		p.kp, p.kq, p.k = int(k.Num().Int64()), int(k.Denom().Int64()), 0
+	} else {
+		p.k, _ = k.Float64()
+	}
+	return nil
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// parseGradient parses a gradient name or a comma-separated list of colors.
+func parseGradient(s string) ([]color.RGBA, error) {
+	if stops, ok := gradients[s]; ok {
+		return stops, nil
+	}
+	var stops []color.RGBA
+	for _, f := range strings.Split(s, ",") {
+		c, err := parseColor(f)
+		if err != nil {
+			return nil, fmt.Errorf("invalid palette %q: %v", s, err)
+		}
+		stops = append(stops, c)
+	}
+	return stops, nil
+}
+
+// parseColor parses a color written as six hex digits, with or without
+// a leading '#'.
+func parseColor(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("bad color %q: want RRGGBB", s)
+	}
+	return color.RGBA{uint8(n >> 16), uint8(n >> 8), uint8(n), 0xFF}, nil
+}
@@ -0,0 +1,374 @@
+// Package bmp implements a Windows BMP image decoder and encoder.
+//
+// Decode supports uncompressed images with 1, 4, 8, 24 or 32 bits
+// per pixel, stored bottom-up or top-down, with any of the common
+// header versions. Encode writes 8-bit paletted, 24-bit or, for
+// images that are not opaque, 32-bit images.
+//
+// Importing this package registers the "bmp" format with image.Decode.
+package bmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	fileHeaderLen = 14
+	infoHeaderLen = 40  // BITMAPINFOHEADER
+	v4HeaderLen   = 108 // BITMAPV4HEADER, which adds an alpha mask
+
+	biRGB       = 0
+	biBitfields = 3
+
+	maxPixels = 1 << 26 // largest image decoded, bounding its memory
+)
+
+// A FormatError reports that the input is not a valid BMP image.
+type FormatError string
+
+func (e FormatError) Error() string { return "bmp: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid
+// but unimplemented BMP feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "bmp: unsupported feature: " + string(e) }
+
+// header holds the fields of the file and info headers used by the decoder.
+type header struct {
+	offset      uint32 // of the pixel array
+	width       int
+	height      int
+	topDown     bool
+	bpp         int
+	compression uint32
+	masks       [4]uint32 // red, green, blue and alpha bit masks
+	palette     color.Palette
+}
+
+func readHeader(r io.Reader) (*header, error) {
+	var fh [fileHeaderLen + 4]byte
+	if _, err := io.ReadFull(r, fh[:]); err != nil {
+		return nil, err
+	}
+	if fh[0] != 'B' || fh[1] != 'M' {
+		return nil, FormatError("not a BMP file")
+	}
+	h := &header{offset: binary.LittleEndian.Uint32(fh[10:])}
+	size := binary.LittleEndian.Uint32(fh[14:])
+	if size < infoHeaderLen || size > 1<<10 {
+		if size == 12 {
+			return nil, UnsupportedError("OS/2 BITMAPCOREHEADER")
+		}
+		return nil, FormatError(fmt.Sprintf("info header size %d", size))
+	}
+	info := make([]byte, size-4)
+	if _, err := io.ReadFull(r, info); err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	width := int32(le.Uint32(info[0:]))
+	height := int32(le.Uint32(info[4:]))
+	planes := le.Uint16(info[8:])
+	h.bpp = int(le.Uint16(info[10:]))
+	h.compression = le.Uint32(info[12:])
+	ncolors := le.Uint32(info[28:])
+
+	if planes != 1 {
+		return nil, FormatError(fmt.Sprintf("%d planes", planes))
+	}
+	if height < 0 {
+		height = -height
+		h.topDown = true
+	}
+	if width <= 0 || height == 0 || width > 1<<16 || height > 1<<16 {
+		return nil, FormatError(fmt.Sprintf("dimensions %dx%d", width, height))
+	}
+	if int64(width)*int64(height) > maxPixels {
+		return nil, UnsupportedError(fmt.Sprintf("%dx%d pixels", width, height))
+	}
+	h.width, h.height = int(width), int(height)
+
+	switch h.compression {
+	case biRGB:
+		switch h.bpp {
+		case 1, 4, 8, 24:
+		case 32:
+			h.masks = [4]uint32{0xFF0000, 0xFF00, 0xFF, 0}
+		default:
+			return nil, UnsupportedError(fmt.Sprintf("%d bits per pixel", h.bpp))
+		}
+	case biBitfields:
+		if h.bpp != 32 {
+			return nil, UnsupportedError(fmt.Sprintf("bit fields with %d bits per pixel", h.bpp))
+		}
+		if size >= 56 { // BITMAPV3INFOHEADER or later: masks are in the header
+			for i := range h.masks {
+				h.masks[i] = le.Uint32(info[36+4*i:])
+			}
+		} else { // masks follow the header
+			var m [12]byte
+			if _, err := io.ReadFull(r, m[:]); err != nil {
+				return nil, err
+			}
+			for i := 0; i < 3; i++ {
+				h.masks[i] = le.Uint32(m[4*i:])
+			}
+			size += 12
+		}
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("compression type %d", h.compression))
+	}
+
+	if h.bpp <= 8 {
+		if ncolors == 0 || ncolors > 1<<uint(h.bpp) {
+			ncolors = 1 << uint(h.bpp)
+		}
+		pal := make([]byte, 4*ncolors)
+		if _, err := io.ReadFull(r, pal); err != nil {
+			return nil, err
+		}
+		size += 4 * ncolors
+		for i := 0; i < len(pal); i += 4 {
+			h.palette = append(h.palette, color.RGBA{pal[i+2], pal[i+1], pal[i], 0xFF})
+		}
+	}
+
+	// Skip any gap between the headers and the pixel array.
+	read := fileHeaderLen + size
+	if h.offset < read {
+		return nil, FormatError("pixel data overlaps headers")
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, int64(h.offset-read)); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *header) colorModel() color.Model {
+	switch {
+	case h.bpp <= 8:
+		return h.palette
+	case h.masks[3] != 0:
+		return color.NRGBAModel
+	default:
+		return color.RGBAModel
+	}
+}
+
+// DecodeConfig returns the color model and dimensions of a BMP image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: h.colorModel(), Width: h.width, Height: h.height}, nil
+}
+
+// Decode reads a BMP image from r and returns it as an image.Image.
+// Paletted images are returned as *image.Paletted, images with an
+// alpha channel as *image.NRGBA, and all others as *image.RGBA.
+func Decode(r io.Reader) (image.Image, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+	stride := (h.width*h.bpp + 31) / 32 * 4 // rows are padded to 4 bytes
+
+	// Read the whole pixel array before allocating the image, so that
+	// a short file cannot make Decode claim more memory than it holds.
+	size := int64(stride) * int64(h.height)
+	data, err := ioutil.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var pix []byte
+	var pixStride int
+	var img image.Image
+	switch {
+	case h.bpp <= 8:
+		m := image.NewPaletted(rect, h.palette)
+		pix, pixStride, img = m.Pix, m.Stride, m
+	case h.masks[3] != 0:
+		m := image.NewNRGBA(rect)
+		pix, pixStride, img = m.Pix, m.Stride, m
+	default:
+		m := image.NewRGBA(rect)
+		pix, pixStride, img = m.Pix, m.Stride, m
+	}
+
+	for i := 0; i < h.height; i++ {
+		row := data[i*stride : (i+1)*stride]
+		y := h.height - 1 - i
+		if h.topDown {
+			y = i
+		}
+		out := pix[y*pixStride:]
+		switch h.bpp {
+		case 1, 4:
+			perByte := 8 / h.bpp
+			mask := byte(1<<uint(h.bpp) - 1)
+			for x := 0; x < h.width; x++ {
+				shift := uint(8 - h.bpp*(x%perByte+1))
+				out[x] = row[x/perByte] >> shift & mask
+			}
+		case 8:
+			copy(out[:h.width], row)
+		case 24:
+			for x := 0; x < h.width; x++ {
+				b, g, r := row[3*x], row[3*x+1], row[3*x+2]
+				out[4*x], out[4*x+1], out[4*x+2], out[4*x+3] = r, g, b, 0xFF
+			}
+		case 32:
+			for x := 0; x < h.width; x++ {
+				v := binary.LittleEndian.Uint32(row[4*x:])
+				out[4*x] = field(v, h.masks[0])
+				out[4*x+1] = field(v, h.masks[1])
+				out[4*x+2] = field(v, h.masks[2])
+				out[4*x+3] = 0xFF
+				if h.masks[3] != 0 {
+					out[4*x+3] = field(v, h.masks[3])
+				}
+			}
+		}
+	}
+	if p, ok := img.(*image.Paletted); ok {
+		for _, c := range p.Pix {
+			if int(c) >= len(h.palette) {
+				return nil, FormatError(fmt.Sprintf("color index %d out of range", c))
+			}
+		}
+	}
+	return img, nil
+}
+
+// field extracts the bits of v selected by mask, scaled to 8 bits.
+func field(v, mask uint32) byte {
+	if mask == 0 {
+		return 0
+	}
+	shift := uint(0)
+	for mask&1 == 0 {
+		mask >>= 1
+		shift++
+	}
+	bits := uint(0)
+	for m := mask; m&1 == 1; m >>= 1 {
+		bits++
+	}
+	x := (v >> shift) & mask
+	if bits >= 8 {
+		return byte(x >> (bits - 8))
+	}
+	return byte(x * 0xFF / mask)
+}
+
+// Encode writes img to w in BMP format.
+func Encode(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("bmp: empty image")
+	}
+
+	var bpp int
+	var palette color.Palette
+	p, paletted := img.(*image.Paletted)
+	switch {
+	case paletted && len(p.Palette) <= 256:
+		bpp, palette = 8, p.Palette
+	case opaque(img):
+		bpp = 24
+	default:
+		bpp = 32
+	}
+	infoLen, compression := infoHeaderLen, uint32(biRGB)
+	if bpp == 32 {
+		infoLen, compression = v4HeaderLen, biBitfields
+	}
+	stride := (width*bpp + 31) / 32 * 4
+	offset := fileHeaderLen + infoLen + 4*len(palette)
+	size := offset + stride*height
+
+	hdr := make([]byte, offset)
+	le := binary.LittleEndian
+	hdr[0], hdr[1] = 'B', 'M'
+	le.PutUint32(hdr[2:], uint32(size))
+	le.PutUint32(hdr[10:], uint32(offset))
+	info := hdr[fileHeaderLen:]
+	le.PutUint32(info[0:], uint32(infoLen))
+	le.PutUint32(info[4:], uint32(width))
+	le.PutUint32(info[8:], uint32(height)) // positive: bottom-up
+	le.PutUint16(info[12:], 1)
+	le.PutUint16(info[14:], uint16(bpp))
+	le.PutUint32(info[16:], compression)
+	le.PutUint32(info[20:], uint32(stride*height))
+	le.PutUint32(info[24:], 2835) // 72 DPI
+	le.PutUint32(info[28:], 2835)
+	le.PutUint32(info[32:], uint32(len(palette)))
+	if bpp == 32 {
+		for i, mask := range []uint32{0xFF0000, 0xFF00, 0xFF, 0xFF000000} {
+			le.PutUint32(info[40+4*i:], mask)
+		}
+		copy(info[56:], "BGRs") // LCS_sRGB
+	}
+	for i, c := range palette {
+		r, g, b, _ := c.RGBA()
+		pal := hdr[fileHeaderLen+infoLen+4*i:]
+		pal[0], pal[1], pal[2] = byte(b>>8), byte(g>>8), byte(r>>8)
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(hdr)
+	row := make([]byte, stride)
+	for y := b.Max.Y - 1; y >= b.Min.Y; y-- {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			i := x - b.Min.X
+			switch bpp {
+			case 8:
+				row[i] = p.ColorIndexAt(x, y)
+			case 24:
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				row[3*i], row[3*i+1], row[3*i+2] = c.B, c.G, c.R
+			case 32:
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				row[4*i], row[4*i+1], row[4*i+2], row[4*i+3] = c.B, c.G, c.R, c.A
+			}
+		}
+		bw.Write(row)
+	}
+	return bw.Flush()
+}
+
+// opaque reports whether every pixel of img is fully opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func init() {
+	image.RegisterFormat("bmp", "BM????\x00\x00\x00\x00", Decode, DecodeConfig)
+}
@@ -0,0 +1,101 @@
+package bmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"testing"
+)
+
+func testImages() map[string]image.Image {
+	rgba := image.NewRGBA(image.Rect(0, 0, 7, 5)) // odd width exercises row padding
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 7, 5))
+	pal := image.NewPaletted(image.Rect(0, 0, 7, 5), palette.Plan9)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 7; x++ {
+			rgba.SetRGBA(x, y, color.RGBA{uint8(x * 30), uint8(y * 50), 99, 255})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 30), uint8(y * 50), 99, uint8(x * 40)})
+			pal.SetColorIndex(x, y, uint8(x*y*7))
+		}
+	}
+	return map[string]image.Image{"rgba": rgba, "nrgba": nrgba, "paletted": pal}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for name, want := range testImages() {
+		var buf bytes.Buffer
+		if err := Encode(&buf, want); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, format, err := image.Decode(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if format != "bmp" {
+			t.Errorf("%s: format %q", name, format)
+		}
+		if got.Bounds() != want.Bounds() {
+			t.Fatalf("%s: bounds %v, want %v", name, got.Bounds(), want.Bounds())
+		}
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 7; x++ {
+				g := color.NRGBAModel.Convert(got.At(x, y))
+				w := color.NRGBAModel.Convert(want.At(x, y))
+				if g != w {
+					t.Fatalf("%s: pixel (%d, %d) = %v, want %v", name, x, y, g, w)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeTopDown(t *testing.T) {
+	// A 2x2 top-down 24-bit image: red, green / blue, white.
+	data := []byte{
+		'B', 'M', 70, 0, 0, 0, 0, 0, 0, 0, 54, 0, 0, 0,
+		40, 0, 0, 0, 2, 0, 0, 0, 0xFE, 0xFF, 0xFF, 0xFF, 1, 0, 24, 0,
+		0, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0xFF, 0, 0xFF, 0, 0, 0, // BGR, padded to 8 bytes
+		0xFF, 0, 0, 0xFF, 0xFF, 0xFF, 0, 0,
+	}
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []color.RGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {255, 255, 255, 255}}
+	for i, w := range want {
+		if got := img.At(i%2, i/2); got != w {
+			t.Errorf("pixel (%d, %d) = %v, want %v", i%2, i/2, got, w)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	// header returns the headers of a 24-bit image without its pixels.
+	header := func(width, height int32) string {
+		h := make([]byte, 54)
+		le := binary.LittleEndian
+		h[0], h[1] = 'B', 'M'
+		le.PutUint32(h[10:], 54)
+		le.PutUint32(h[14:], 40)
+		le.PutUint32(h[18:], uint32(width))
+		le.PutUint32(h[22:], uint32(height))
+		le.PutUint16(h[26:], 1)
+		le.PutUint16(h[28:], 24)
+		return string(h)
+	}
+	for _, data := range []string{
+		"",
+		"GIF89a",
+		"BM\x00\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00\x0c\x00\x00\x00",
+		header(1<<16, 1<<16),          // too many pixels
+		header(1<<13, 1<<13),          // no pixels
+		header(2, 2) + "\x00\x00\x00", // too few pixels
+	} {
+		if _, err := Decode(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("Decode(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func testPNG(t *testing.T) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 6), uint8(y * 8), 200, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConvert(t *testing.T) {
+	src := testPNG(t)
+	for _, test := range []struct {
+		cfg  config
+		want string // format
+		w, h int
+	}{
+		{config{format: "jpeg", quality: 90}, "jpeg", 40, 30},
+		{config{format: "gif"}, "gif", 40, 30},
+		{config{format: "bmp"}, "bmp", 40, 30},
+		{config{format: "tiff"}, "tiff", 40, 30},
+		{config{}, "png", 40, 30},
+		{config{format: "png", width: 20}, "png", 20, 15},
+		{config{format: "png", width: 10, height: 10}, "png", 10, 10},
+		{config{format: "bmp", crop: image.Rect(5, 5, 25, 15)}, "bmp", 20, 10},
+		{config{format: "png", crop: image.Rect(30, 20, 50, 40), width: 20}, "png", 20, 20},
+		{config{format: "png", colors: 8}, "png", 40, 30},
+	} {
+		var out bytes.Buffer
+		if err := convert(&out, bytes.NewReader(src), &test.cfg); err != nil {
+			t.Errorf("%+v: %v", test.cfg, err)
+			continue
+		}
+		br := bufio.NewReader(&out)
+		format, err := detect(br)
+		if err != nil || format != test.want {
+			t.Errorf("%+v: output format %q (%v), want %q", test.cfg, format, err, test.want)
+			continue
+		}
+		img, err := decoders[format](br)
+		if err != nil {
+			t.Errorf("%+v: decoding output: %v", test.cfg, err)
+			continue
+		}
+		if b := img.Bounds(); b.Dx() != test.w || b.Dy() != test.h {
+			t.Errorf("%+v: output is %dx%d, want %dx%d", test.cfg, b.Dx(), b.Dy(), test.w, test.h)
+		}
+		if test.cfg.colors > 0 {
+			if p, ok := img.(*image.Paletted); !ok || len(p.Palette) > test.cfg.colors {
+				t.Errorf("%+v: output is not reduced to %d colors", test.cfg, test.cfg.colors)
+			}
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for _, input := range []string{"", "hello, world", "\x00\x00\x01\x00"} {
+		_, err := detect(bufio.NewReader(strings.NewReader(input)))
+		if err == nil {
+			t.Errorf("detect(%q) succeeded", input)
+		}
+	}
+	_, err := detect(bufio.NewReader(strings.NewReader("RIFF\x00\x00\x00\x00WEBP")))
+	if err == nil || !strings.Contains(err.Error(), "52 49 46 46") {
+		t.Errorf("detect(webp) = %v, want error showing the magic bytes", err)
+	}
+}
+
+func TestMedianCut(t *testing.T) {
+	// An image with exactly four colors, one of them transparent,
+	// is reproduced exactly by a palette of four entries.
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 255}, {0, 0, 0, 0}}
+	for i := 0; i < 16; i++ {
+		img.SetNRGBA(i%4, i/4, colors[i%3+i/12])
+	}
+	for _, dither := range []bool{false, true} {
+		q := quantize(img, 4, dither)
+		if len(q.Palette) != 4 {
+			t.Errorf("palette has %d colors, want 4", len(q.Palette))
+		}
+		for i := 0; i < 16; i++ {
+			got := color.NRGBAModel.Convert(q.At(i%4, i/4))
+			want := color.NRGBAModel.Convert(img.At(i%4, i/4))
+			if got != want {
+				t.Errorf("dither=%t: pixel %d = %v, want %v", dither, i, got, want)
+			}
+		}
+	}
+
+	// A gradient is reduced to the requested number of colors.
+	grad := image.NewGray(image.Rect(0, 0, 256, 1))
+	for x := 0; x < 256; x++ {
+		grad.Pix[x] = uint8(x)
+	}
+	if pal := medianCut(grad, 16); len(pal) != 16 {
+		t.Errorf("gradient palette has %d colors, want 16", len(pal))
+	}
+
+	// When the last color holds the median pixel, it is split off
+	// from the rest rather than the first.
+	skew := image.NewGray(image.Rect(0, 0, 100, 1))
+	for x := 0; x < 100; x++ {
+		skew.Pix[x] = 0xFF
+		if x < 10 {
+			skew.Pix[x] = uint8(x)
+		}
+	}
+	pal := medianCut(skew, 2)
+	if len(pal) != 2 || pal[1] != (color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("skewed palette = %v, want a dark gray and white", pal)
+	}
+}
@@ -0,0 +1,259 @@
+// The imgconv command converts images between the JPEG, PNG, GIF,
+// BMP and TIFF formats, optionally cropping, resizing and reducing
+// them to a palette on the way.
+//
+// The input format is detected from the file's magic bytes. The output
+// format is given by -f, or else by the output file's extension, or
+// else is the same as the input format. Input and output default to
+// the standard input and output.
+//
+// Usage:
+//
+//	$ go run ./ch10/imgconv [flags] [input [output]]
+//	$ go run ./ch3/mandelbrot | go run ./ch10/imgconv -f=gif -colors=64 -resize=256x0 > m.gif
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopl.io/ch10/bmp"
+	"gopl.io/ch10/tiff"
+	"gopl.io/ch8/thumbnail"
+)
+
+// A config holds the conversion parameters.
+type config struct {
+	format   string // output format; "" for the input format
+	quality  int    // JPEG quality
+	colors   int    // palette size; 0 for no quantization (GIF: 256)
+	dither   bool
+	crop     image.Rectangle // relative to the image's origin; empty for none
+	width    int             // resize dimensions; 0 keeps the aspect ratio
+	height   int
+	filter   thumbnail.Filter
+	compress tiff.CompressionType
+	verbose  bool
+}
+
+var decoders = map[string]func(io.Reader) (image.Image, error){
+	"jpeg": jpeg.Decode,
+	"png":  png.Decode,
+	"gif":  gif.Decode,
+	"bmp":  bmp.Decode,
+	"tiff": tiff.Decode,
+}
+
+// formatNames maps file name extensions and -f values to formats.
+var formatNames = map[string]string{
+	"jpeg": "jpeg", "jpg": "jpeg",
+	"png":  "png",
+	"gif":  "gif",
+	"bmp":  "bmp",
+	"tiff": "tiff", "tif": "tiff",
+}
+
+func main() {
+	var cfg config
+	var crop, resize, filter, compress string
+	flag.StringVar(&cfg.format, "f", "", "output `format`: jpeg, png, gif, bmp or tiff")
+	flag.IntVar(&cfg.quality, "quality", 90, "JPEG quality, 1-100")
+	flag.IntVar(&cfg.colors, "colors", 0, "reduce to `n` colors by median cut, 1-256 (GIF default 256)")
+	flag.BoolVar(&cfg.dither, "dither", true, "use Floyd-Steinberg dithering when reducing colors")
+	flag.StringVar(&crop, "crop", "", "crop to `x,y,w,h` before resizing")
+	flag.StringVar(&resize, "resize", "", "resize to `WxH`; a zero dimension keeps the aspect ratio")
+	flag.StringVar(&filter, "filter", "lanczos3", "resampling filter: lanczos3, bilinear or box")
+	flag.StringVar(&compress, "compress", "deflate", "TIFF compression: deflate or none")
+	flag.BoolVar(&cfg.verbose, "v", false, "report the input format")
+	flag.Parse()
+
+	if err := cfg.parse(crop, resize, filter, compress); err != nil {
+		fatalf("%v", err)
+	}
+	// The zero value means no quantization only as the default.
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "colors" && cfg.colors == 0 {
+			fatalf("colors 0 out of range 1-256")
+		}
+	})
+	if flag.NArg() > 2 {
+		fatalf("usage: imgconv [flags] [input [output]]")
+	}
+
+	in, out := io.Reader(os.Stdin), io.WriteCloser(os.Stdout)
+	if name := flag.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if name := flag.Arg(1); name != "" && name != "-" {
+		if cfg.format == "" {
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+			cfg.format = formatNames[ext]
+		}
+		f, err := os.Create(name)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		out = f
+	}
+
+	if err := convert(out, in, &cfg); err != nil {
+		out.Close()
+		fatalf("%v", err)
+	}
+	if err := out.Close(); err != nil {
+		fatalf("%v", err)
+	}
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "imgconv: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// parse validates cfg and fills in the fields given by the string flags.
+func (cfg *config) parse(crop, resize, filter, compress string) error {
+	if cfg.format != "" {
+		f, ok := formatNames[strings.ToLower(cfg.format)]
+		if !ok {
+			return fmt.Errorf("unknown output format %q", cfg.format)
+		}
+		cfg.format = f
+	}
+	if cfg.quality < 1 || cfg.quality > 100 {
+		return fmt.Errorf("quality %d out of range 1-100", cfg.quality)
+	}
+	if cfg.colors < 0 || cfg.colors > 256 {
+		return fmt.Errorf("colors %d out of range 1-256", cfg.colors)
+	}
+	if crop != "" {
+		var x, y, w, h int
+		if _, err := fmt.Sscanf(crop, "%d,%d,%d,%d", &x, &y, &w, &h); err != nil || w <= 0 || h <= 0 {
+			return fmt.Errorf("invalid crop %q: want x,y,w,h", crop)
+		}
+		cfg.crop = image.Rect(x, y, x+w, y+h)
+	}
+	if resize != "" {
+		if _, err := fmt.Sscanf(resize, "%dx%d", &cfg.width, &cfg.height); err != nil ||
+			cfg.width < 0 || cfg.height < 0 || cfg.width+cfg.height == 0 {
+			return fmt.Errorf("invalid size %q: want WxH", resize)
+		}
+	}
+	var err error
+	if cfg.filter, err = thumbnail.ParseFilter(filter); err != nil {
+		return err
+	}
+	switch compress {
+	case "deflate":
+		cfg.compress = tiff.Deflate
+	case "none":
+		cfg.compress = tiff.Uncompressed
+	default:
+		return fmt.Errorf("unknown TIFF compression %q", compress)
+	}
+	return nil
+}
+
+// convert reads an image from in, transforms it and writes it to out.
+func convert(out io.Writer, in io.Reader, cfg *config) error {
+	br := bufio.NewReader(in)
+	format, err := detect(br)
+	if err != nil {
+		return err
+	}
+	if cfg.verbose {
+		fmt.Fprintln(os.Stderr, "Input format =", format)
+	}
+	img, err := decoders[format](br)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.crop.Empty() {
+		b := img.Bounds()
+		r := cfg.crop.Add(b.Min).Intersect(b)
+		if r.Empty() {
+			return fmt.Errorf("crop %v lies outside the %dx%d image", cfg.crop, b.Dx(), b.Dy())
+		}
+		img = img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}).SubImage(r)
+	}
+	if cfg.width > 0 || cfg.height > 0 {
+		opts := thumbnail.Options{Width: cfg.width, Height: cfg.height, Filter: cfg.filter}
+		if cfg.width > 0 && cfg.height > 0 {
+			opts.Fit = thumbnail.Fill
+		}
+		img = opts.Image(img)
+	}
+
+	outFormat := cfg.format
+	if outFormat == "" {
+		outFormat = format
+	}
+	colors := cfg.colors
+	if outFormat == "gif" && colors == 0 {
+		colors = 256
+	}
+	if colors > 0 {
+		img = quantize(img, colors, cfg.dither)
+	}
+
+	switch outFormat {
+	case "jpeg":
+		return jpeg.Encode(out, img, &jpeg.Options{Quality: cfg.quality})
+	case "png":
+		return png.Encode(out, img)
+	case "gif":
+		return gif.Encode(out, img, nil) // already paletted
+	case "bmp":
+		return bmp.Encode(out, img)
+	case "tiff":
+		return tiff.Encode(out, img, &tiff.Options{Compression: cfg.compress, Predictor: true})
+	}
+	return fmt.Errorf("unknown output format %q", outFormat)
+}
+
+// magics lists the leading bytes that identify each input format.
+var magics = []struct {
+	format, magic string
+}{
+	{"jpeg", "\xFF\xD8\xFF"},
+	{"png", "\x89PNG\r\n\x1A\n"},
+	{"gif", "GIF87a"},
+	{"gif", "GIF89a"},
+	{"bmp", "BM"},
+	{"tiff", "II*\x00"},
+	{"tiff", "MM\x00*"},
+}
+
+// detect returns the format of the image read by r, judging by its
+// first bytes, which are not consumed.
+func detect(r *bufio.Reader) (string, error) {
+	head, err := r.Peek(8)
+	if len(head) == 0 {
+		if err == io.EOF {
+			return "", fmt.Errorf("empty input")
+		}
+		return "", err
+	}
+	for _, m := range magics {
+		if strings.HasPrefix(string(head), m.magic) {
+			return m.format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown image format (input begins % x)", head)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// A colorCount is a distinct opaque color and the number of pixels that have it.
+type colorCount struct {
+	c [3]uint8
+	n int
+}
+
+// A box is a set of colors to be represented by one palette entry.
+type box []colorCount
+
+// widest returns the channel in which the colors of b vary the most,
+// and the extent of that variation.
+func (b box) widest() (channel, extent int) {
+	for ch := 0; ch < 3; ch++ {
+		lo, hi := 255, 0
+		for _, cc := range b {
+			v := int(cc.c[ch])
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if hi-lo > extent {
+			channel, extent = ch, hi-lo
+		}
+	}
+	return channel, extent
+}
+
+// mean returns the average color of b, weighted by pixel counts.
+func (b box) mean() color.Color {
+	var sum [3]int
+	var total int
+	for _, cc := range b {
+		for ch := range sum {
+			sum[ch] += int(cc.c[ch]) * cc.n
+		}
+		total += cc.n
+	}
+	var c [3]uint8
+	for ch := range c {
+		c[ch] = uint8((sum[ch] + total/2) / total)
+	}
+	return color.RGBA{c[0], c[1], c[2], 0xFF}
+}
+
+// medianCut returns a palette of at most n colors for img. It repeatedly
+// splits the box of colors that varies most widely in one channel at
+// the median pixel along that channel. If img has transparent pixels,
+// one entry of the palette is reserved for them.
+func medianCut(img image.Image, n int) color.Palette {
+	counts := make(map[[3]uint8]int)
+	transparent := false
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				transparent = true
+				continue
+			}
+			counts[[3]uint8{c.R, c.G, c.B}]++
+		}
+	}
+	var pal color.Palette
+	if transparent {
+		pal = append(pal, color.Transparent)
+		n--
+	}
+	if len(counts) == 0 || n <= 0 {
+		return pal
+	}
+
+	all := make(box, 0, len(counts))
+	for c, k := range counts {
+		all = append(all, colorCount{c, k})
+	}
+	boxes := []box{all}
+	for len(boxes) < n {
+		// Find the box to split.
+		best, bestExtent, bestChannel := -1, 0, 0
+		for i, bx := range boxes {
+			if len(bx) < 2 {
+				continue
+			}
+			if ch, ext := bx.widest(); ext > bestExtent {
+				best, bestExtent, bestChannel = i, ext, ch
+			}
+		}
+		if best < 0 {
+			break // every box holds a single color
+		}
+		bx := boxes[best]
+		sort.Slice(bx, func(i, j int) bool { return bx[i].c[bestChannel] < bx[j].c[bestChannel] })
+
+		// Split after the color of the median pixel, or before it if it
+		// is the last color, keeping both halves non-empty.
+		var total, half int
+		for _, cc := range bx {
+			total += cc.n
+		}
+		split := len(bx) - 1
+		for i, cc := range bx[:len(bx)-1] {
+			half += cc.n
+			if 2*half >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes[best] = bx[:split]
+		boxes = append(boxes, bx[split:])
+	}
+	for _, bx := range boxes {
+		pal = append(pal, bx.mean())
+	}
+	return pal
+}
+
+// quantize returns img reduced to a palette of at most n colors chosen
+// by median cut, optionally with Floyd-Steinberg error diffusion.
+func quantize(img image.Image, n int, dither bool) *image.Paletted {
+	b := img.Bounds()
+	dst := image.NewPaletted(b, medianCut(img, n))
+	if dither {
+		draw.FloydSteinberg.Draw(dst, b, img, b.Min)
+	} else {
+		draw.Draw(dst, b, img, b.Min, draw.Src)
+	}
+	return dst
+}
@@ -0,0 +1,56 @@
+package tiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// decompress returns the first n decompressed bytes of a strip.
+func decompress(data []byte, compression, n int) ([]byte, error) {
+	switch compression {
+	case cNone:
+		return data, nil
+	case cPackBits:
+		return unpackBits(data, n)
+	case cDeflate, cDeflateOld:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return ioutil.ReadAll(io.LimitReader(zr, int64(n)))
+	case cLZW:
+		return nil, UnsupportedError("LZW compression")
+	default:
+		return nil, UnsupportedError(fmt.Sprintf("compression type %d", compression))
+	}
+}
+
+// unpackBits decodes at most n bytes of PackBits run-length encoding.
+func unpackBits(data []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for len(data) > 0 && len(out) < n {
+		c := int(int8(data[0]))
+		data = data[1:]
+		switch {
+		case c >= 0: // copy the next c+1 bytes literally
+			if len(data) < c+1 {
+				return nil, FormatError("truncated PackBits literal")
+			}
+			out = append(out, data[:c+1]...)
+			data = data[c+1:]
+		case c != -128: // repeat the next byte 1-c times
+			if len(data) < 1 {
+				return nil, FormatError("truncated PackBits run")
+			}
+			for i := 0; i < 1-c; i++ {
+				out = append(out, data[0])
+			}
+			data = data[1:]
+		}
+	}
+	return out, nil
+}
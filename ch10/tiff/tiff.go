@@ -0,0 +1,485 @@
+// Package tiff implements a baseline TIFF image decoder and encoder.
+//
+// Decode supports bilevel, grayscale, paletted and RGB(A) images with
+// 1, 4, 8 or 16 bits per sample, stored in strips that are
+// uncompressed or compressed with PackBits or Deflate, with or without
+// horizontal differencing. Only the first image of a file is read.
+// LZW compression, tiles and planar layouts are not supported.
+//
+// Importing this package registers the "tiff" format with image.Decode.
+package tiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+// Tags.
+const (
+	tImageWidth      = 256
+	tImageLength     = 257
+	tBitsPerSample   = 258
+	tCompression     = 259
+	tPhotometric     = 262
+	tStripOffsets    = 273
+	tSamplesPerPixel = 277
+	tRowsPerStrip    = 278
+	tStripByteCounts = 279
+	tXResolution     = 282
+	tYResolution     = 283
+	tPlanarConfig    = 284
+	tResolutionUnit  = 296
+	tPredictor       = 317
+	tColorMap        = 320
+	tTileWidth       = 322
+	tExtraSamples    = 338
+)
+
+// Field types.
+const (
+	dtByte     = 1
+	dtASCII    = 2
+	dtShort    = 3
+	dtLong     = 4
+	dtRational = 5
+)
+
+var typeLen = [...]int{dtByte: 1, dtASCII: 1, dtShort: 2, dtLong: 4, dtRational: 8}
+
+// Compression schemes.
+const (
+	cNone       = 1
+	cLZW        = 5
+	cDeflate    = 8
+	cDeflateOld = 32946
+	cPackBits   = 32773
+)
+
+// Photometric interpretations.
+const (
+	pWhiteIsZero = 0
+	pBlackIsZero = 1
+	pRGB         = 2
+	pPaletted    = 3
+)
+
+// maxPixels is the size of the largest image decoded, which bounds the
+// memory it takes.
+const maxPixels = 1 << 26
+
+// A FormatError reports that the input is not a valid TIFF image.
+type FormatError string
+
+func (e FormatError) Error() string { return "tiff: invalid format: " + string(e) }
+
+// An UnsupportedError reports that the input uses a valid
+// but unimplemented TIFF feature.
+type UnsupportedError string
+
+func (e UnsupportedError) Error() string { return "tiff: unsupported feature: " + string(e) }
+
+// A decoder holds the first image file directory of a TIFF file.
+type decoder struct {
+	data  []byte
+	order binary.ByteOrder
+	tags  map[uint16][]uint32
+
+	width, height int
+	bps           int // bits per sample
+	spp           int // samples per pixel
+	photometric   int
+	alpha         int // 0: none, 1: premultiplied, 2: straight
+	palette       color.Palette
+}
+
+func newDecoder(r io.Reader) (*decoder, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, FormatError("short header")
+	}
+	d := &decoder{data: data, tags: make(map[uint16][]uint32)}
+	switch string(data[:4]) {
+	case "II*\x00":
+		d.order = binary.LittleEndian
+	case "MM\x00*":
+		d.order = binary.BigEndian
+	default:
+		return nil, FormatError("not a TIFF file")
+	}
+	if err := d.readIFD(d.order.Uint32(data[4:])); err != nil {
+		return nil, err
+	}
+	return d, d.parseTags()
+}
+
+// readIFD reads the entries of the directory at offset
+// whose values are bytes, shorts or longs.
+func (d *decoder) readIFD(offset uint32) error {
+	p := int(offset)
+	if p < 8 || p+2 > len(d.data) {
+		return FormatError("bad IFD offset")
+	}
+	n := int(d.order.Uint16(d.data[p:]))
+	p += 2
+	if p+12*n > len(d.data) {
+		return FormatError("short IFD")
+	}
+	for i := 0; i < n; i, p = i+1, p+12 {
+		tag := d.order.Uint16(d.data[p:])
+		typ := int(d.order.Uint16(d.data[p+2:]))
+		count := int(d.order.Uint32(d.data[p+4:]))
+		if typ != dtByte && typ != dtShort && typ != dtLong {
+			continue // not needed by the decoder
+		}
+		size := typeLen[typ] * count
+		if count < 0 || size < 0 || size > len(d.data) {
+			return FormatError(fmt.Sprintf("tag %d: bad count", tag))
+		}
+		val := d.data[p+8 : p+12]
+		if size > 4 {
+			off := int(d.order.Uint32(val))
+			if off < 0 || off+size > len(d.data) {
+				return FormatError(fmt.Sprintf("tag %d: bad offset", tag))
+			}
+			val = d.data[off : off+size]
+		}
+		vals := make([]uint32, count)
+		for j := range vals {
+			switch typ {
+			case dtByte:
+				vals[j] = uint32(val[j])
+			case dtShort:
+				vals[j] = uint32(d.order.Uint16(val[2*j:]))
+			case dtLong:
+				vals[j] = d.order.Uint32(val[4*j:])
+			}
+		}
+		d.tags[tag] = vals
+	}
+	return nil
+}
+
+// tag returns the first value of the tag, or def if it is absent.
+func (d *decoder) tag(tag uint16, def int) int {
+	if v := d.tags[tag]; len(v) > 0 {
+		return int(v[0])
+	}
+	return def
+}
+
+func (d *decoder) parseTags() error {
+	d.width = d.tag(tImageWidth, 0)
+	d.height = d.tag(tImageLength, 0)
+	if d.width <= 0 || d.height <= 0 || d.width > 1<<16 || d.height > 1<<16 {
+		return FormatError(fmt.Sprintf("dimensions %dx%d", d.width, d.height))
+	}
+	if int64(d.width)*int64(d.height) > maxPixels {
+		return UnsupportedError(fmt.Sprintf("%dx%d pixels", d.width, d.height))
+	}
+	if _, ok := d.tags[tTileWidth]; ok {
+		return UnsupportedError("tiled images")
+	}
+	if d.tag(tPlanarConfig, 1) != 1 {
+		return UnsupportedError("planar configuration")
+	}
+	d.spp = d.tag(tSamplesPerPixel, 1)
+	d.bps = d.tag(tBitsPerSample, 1)
+	for _, b := range d.tags[tBitsPerSample] {
+		if int(b) != d.bps {
+			return UnsupportedError("differing bits per sample")
+		}
+	}
+	switch d.bps {
+	case 1, 4, 8, 16:
+	default:
+		return UnsupportedError(fmt.Sprintf("%d bits per sample", d.bps))
+	}
+
+	d.photometric = d.tag(tPhotometric, -1)
+	switch d.photometric {
+	case pWhiteIsZero, pBlackIsZero:
+		if d.spp != 1 {
+			return UnsupportedError(fmt.Sprintf("grayscale with %d samples per pixel", d.spp))
+		}
+	case pRGB:
+		if d.bps < 8 || (d.spp != 3 && d.spp != 4) {
+			return UnsupportedError(fmt.Sprintf("RGB with %d samples of %d bits", d.spp, d.bps))
+		}
+		if d.spp == 4 {
+			d.alpha = 2
+			if d.tag(tExtraSamples, 2) == 1 {
+				d.alpha = 1
+			}
+		}
+	case pPaletted:
+		if d.spp != 1 || d.bps > 8 {
+			return UnsupportedError(fmt.Sprintf("paletted with %d samples of %d bits", d.spp, d.bps))
+		}
+		cmap := d.tags[tColorMap]
+		n := 1 << uint(d.bps)
+		if len(cmap) != 3*n {
+			return FormatError("bad color map")
+		}
+		for i := 0; i < n; i++ {
+			d.palette = append(d.palette, color.RGBA64{
+				uint16(cmap[i]), uint16(cmap[i+n]), uint16(cmap[i+2*n]), 0xFFFF})
+		}
+	default:
+		return UnsupportedError(fmt.Sprintf("photometric interpretation %d", d.photometric))
+	}
+	return nil
+}
+
+func (d *decoder) colorModel() color.Model {
+	switch d.photometric {
+	case pPaletted:
+		return d.palette
+	case pRGB:
+		switch {
+		case d.alpha == 2 && d.bps == 16:
+			return color.NRGBA64Model
+		case d.alpha == 2:
+			return color.NRGBAModel
+		case d.bps == 16:
+			return color.RGBA64Model
+		default:
+			return color.RGBAModel
+		}
+	default:
+		if d.bps == 16 {
+			return color.Gray16Model
+		}
+		return color.GrayModel
+	}
+}
+
+// DecodeConfig returns the color model and dimensions of a TIFF image
+// without decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: d.colorModel(), Width: d.width, Height: d.height}, nil
+}
+
+// Decode reads the first image of a TIFF file from r.
+func Decode(r io.Reader) (image.Image, error) {
+	d, err := newDecoder(r)
+	if err != nil {
+		return nil, err
+	}
+	pix, err := d.pixels()
+	if err != nil {
+		return nil, err
+	}
+	return d.image(pix), nil
+}
+
+// rowBytes returns the number of bytes in one row of samples.
+func (d *decoder) rowBytes() int {
+	return (d.width*d.spp*d.bps + 7) / 8
+}
+
+// pixels returns the decompressed samples of the whole image.
+func (d *decoder) pixels() ([]byte, error) {
+	offsets := d.tags[tStripOffsets]
+	counts := d.tags[tStripByteCounts]
+	if len(offsets) == 0 || len(offsets) != len(counts) {
+		return nil, FormatError("bad strips")
+	}
+	rowsPerStrip := d.tag(tRowsPerStrip, d.height)
+	if rowsPerStrip <= 0 || rowsPerStrip > d.height {
+		rowsPerStrip = d.height
+	}
+	rowBytes := d.rowBytes()
+	size := rowBytes * d.height
+	compression := d.tag(tCompression, cNone)
+	if compression == cNone && size > len(d.data) {
+		return nil, FormatError("missing strips")
+	}
+	// pix grows as strips are decompressed, rather than being allocated
+	// at once, so that a short file cannot claim the memory of a large
+	// image.
+	var pix []byte
+	for i := range offsets {
+		start, n := int(offsets[i]), int(counts[i])
+		if start < 0 || n < 0 || start+n > len(d.data) {
+			return nil, FormatError("strip out of range")
+		}
+		rows := rowsPerStrip
+		if left := d.height - len(pix)/rowBytes; rows > left {
+			rows = left
+		}
+		want := rows * rowBytes
+		strip, err := decompress(d.data[start:start+n], compression, want)
+		if err != nil {
+			return nil, err
+		}
+		if len(strip) < want {
+			return nil, FormatError("short strip")
+		}
+		pix = append(pix, strip[:want]...)
+		if len(pix) == size {
+			break
+		}
+	}
+	if len(pix) < size {
+		return nil, FormatError("missing strips")
+	}
+
+	switch d.tag(tPredictor, 1) {
+	case 1:
+	case 2:
+		d.undoPredictor(pix)
+	default:
+		return nil, UnsupportedError("predictor")
+	}
+	return pix, nil
+}
+
+// undoPredictor reverses horizontal differencing, in which each
+// sample is stored as the difference from the previous pixel's.
+func (d *decoder) undoPredictor(pix []byte) {
+	rowBytes := d.rowBytes()
+	for y := 0; y < d.height; y++ {
+		row := pix[y*rowBytes : (y+1)*rowBytes]
+		switch d.bps {
+		case 8:
+			for i := d.spp; i < len(row); i++ {
+				row[i] += row[i-d.spp]
+			}
+		case 16:
+			for i := 2 * d.spp; i+1 < len(row); i += 2 {
+				v := d.order.Uint16(row[i:]) + d.order.Uint16(row[i-2*d.spp:])
+				d.order.PutUint16(row[i:], v)
+			}
+		}
+	}
+}
+
+// image converts the samples to an image.
+func (d *decoder) image(pix []byte) image.Image {
+	rect := image.Rect(0, 0, d.width, d.height)
+	rowBytes := d.rowBytes()
+	u16 := func(b []byte) uint16 { return d.order.Uint16(b) }
+
+	switch d.photometric {
+	case pPaletted:
+		img := image.NewPaletted(rect, d.palette)
+		for y := 0; y < d.height; y++ {
+			unpack(img.Pix[y*img.Stride:y*img.Stride+d.width], pix[y*rowBytes:], d.bps, false)
+		}
+		return img
+
+	case pRGB:
+		n := d.spp
+		if d.bps == 8 {
+			var out []byte
+			var stride int
+			var img image.Image
+			if d.alpha == 2 {
+				m := image.NewNRGBA(rect)
+				out, stride, img = m.Pix, m.Stride, m
+			} else {
+				m := image.NewRGBA(rect)
+				out, stride, img = m.Pix, m.Stride, m
+			}
+			for y := 0; y < d.height; y++ {
+				in := pix[y*rowBytes:]
+				o := out[y*stride:]
+				for x := 0; x < d.width; x++ {
+					copy(o[4*x:4*x+3], in[n*x:n*x+3])
+					o[4*x+3] = 0xFF
+					if n == 4 {
+						o[4*x+3] = in[n*x+3]
+					}
+				}
+			}
+			return img
+		}
+		// 16 bits per sample.
+		var img interface {
+			image.Image
+			Set(x, y int, c color.Color)
+		}
+		if d.alpha == 2 {
+			img = image.NewNRGBA64(rect)
+		} else {
+			img = image.NewRGBA64(rect)
+		}
+		for y := 0; y < d.height; y++ {
+			in := pix[y*rowBytes:]
+			for x := 0; x < d.width; x++ {
+				s := in[2*n*x:]
+				r, g, b, a := u16(s), u16(s[2:]), u16(s[4:]), uint16(0xFFFF)
+				if n == 4 {
+					a = u16(s[6:])
+				}
+				if d.alpha == 2 {
+					img.Set(x, y, color.NRGBA64{r, g, b, a})
+				} else {
+					img.Set(x, y, color.RGBA64{r, g, b, a})
+				}
+			}
+		}
+		return img
+
+	default: // grayscale
+		invert := d.photometric == pWhiteIsZero
+		if d.bps == 16 {
+			img := image.NewGray16(rect)
+			for y := 0; y < d.height; y++ {
+				in := pix[y*rowBytes:]
+				for x := 0; x < d.width; x++ {
+					v := u16(in[2*x:])
+					if invert {
+						v = 0xFFFF - v
+					}
+					img.SetGray16(x, y, color.Gray16{v})
+				}
+			}
+			return img
+		}
+		img := image.NewGray(rect)
+		for y := 0; y < d.height; y++ {
+			unpack(img.Pix[y*img.Stride:y*img.Stride+d.width], pix[y*rowBytes:], d.bps, true)
+			if invert {
+				for x := 0; x < d.width; x++ {
+					img.Pix[y*img.Stride+x] ^= 0xFF
+				}
+			}
+		}
+		return img
+	}
+}
+
+// unpack expands samples of 1, 4 or 8 bits from in into bytes of out.
+// If scale is set, the samples are scaled to the range 0-255.
+func unpack(out, in []byte, bps int, scale bool) {
+	if bps == 8 {
+		copy(out, in)
+		return
+	}
+	perByte := 8 / bps
+	mask := byte(1<<uint(bps) - 1)
+	for x := range out {
+		v := in[x/perByte] >> uint(8-bps*(x%perByte+1)) & mask
+		if scale {
+			v = v * (0xFF / mask)
+		}
+		out[x] = v
+	}
+}
+
+func init() {
+	image.RegisterFormat("tiff", "II*\x00", Decode, DecodeConfig)
+	image.RegisterFormat("tiff", "MM\x00*", Decode, DecodeConfig)
+}
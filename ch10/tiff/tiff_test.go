@@ -0,0 +1,159 @@
+package tiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"testing"
+)
+
+func testImages() map[string]image.Image {
+	r := image.Rect(0, 0, 9, 5)
+	rgba, nrgba := image.NewRGBA(r), image.NewNRGBA(r)
+	gray, gray16 := image.NewGray(r), image.NewGray16(r)
+	pal := image.NewPaletted(r, palette.WebSafe)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 9; x++ {
+			rgba.SetRGBA(x, y, color.RGBA{uint8(x * 28), uint8(y * 50), 77, 255})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 28), uint8(y * 50), 77, uint8(x*y*6 + 1)})
+			gray.SetGray(x, y, color.Gray{uint8(x*y*6 + 3)})
+			gray16.SetGray16(x, y, color.Gray16{uint16(x*7000 + y*300)})
+			pal.SetColorIndex(x, y, uint8(x*y+x))
+		}
+	}
+	return map[string]image.Image{
+		"rgba": rgba, "nrgba": nrgba, "gray": gray, "gray16": gray16, "paletted": pal,
+	}
+}
+
+func equal(t *testing.T, name string, got, want image.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("%s: bounds %v, want %v", name, got.Bounds(), want.Bounds())
+	}
+	b := want.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.NRGBA64Model.Convert(got.At(x, y))
+			w := color.NRGBA64Model.Convert(want.At(x, y))
+			if g != w {
+				t.Fatalf("%s: pixel (%d, %d) = %v, want %v", name, x, y, g, w)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, opt := range []*Options{
+		nil,
+		{Compression: Deflate},
+		{Compression: Deflate, Predictor: true},
+	} {
+		for name, want := range testImages() {
+			var buf bytes.Buffer
+			if err := Encode(&buf, want, opt); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got, format, err := image.Decode(&buf)
+			if err != nil {
+				t.Fatalf("%s %+v: %v", name, opt, err)
+			}
+			if format != "tiff" {
+				t.Errorf("%s: format %q", name, format)
+			}
+			equal(t, name, got, want)
+		}
+	}
+}
+
+// bigEndianGray returns a big-endian 4x2 8-bit WhiteIsZero image
+// with two PackBits-compressed strips of one row each.
+func bigEndianGray() []byte {
+	be := binary.BigEndian
+	strips := [][]byte{
+		{0xFD, 0x00},                   // run: 0 0 0 0
+		{0x03, 0x10, 0x20, 0x30, 0xFF}, // literal: 10 20 30 ff
+	}
+	var buf bytes.Buffer
+	buf.WriteString("MM\x00*")
+	binary.Write(&buf, be, uint32(8+2+5)) // IFD follows the strips
+	buf.Write(strips[0])
+	buf.Write(strips[1])
+	entries := [][3]uint32{
+		{tImageWidth, dtShort, 4},
+		{tImageLength, dtShort, 2},
+		{tBitsPerSample, dtShort, 8},
+		{tCompression, dtShort, cPackBits},
+		{tPhotometric, dtShort, pWhiteIsZero},
+		{tStripOffsets, dtShort, 8},
+		{tRowsPerStrip, dtShort, 1},
+		{tStripByteCounts, dtShort, 2},
+	}
+	binary.Write(&buf, be, uint16(len(entries)))
+	for _, e := range entries {
+		count := uint32(1)
+		if e[0] == tStripOffsets || e[0] == tStripByteCounts {
+			count = 2
+		}
+		binary.Write(&buf, be, uint16(e[0]))
+		binary.Write(&buf, be, uint16(e[1]))
+		binary.Write(&buf, be, count)
+		switch e[0] {
+		case tStripOffsets:
+			binary.Write(&buf, be, []uint16{8, 10})
+		case tStripByteCounts:
+			binary.Write(&buf, be, []uint16{2, 5})
+		default:
+			binary.Write(&buf, be, []uint16{uint16(e[2]), 0})
+		}
+	}
+	binary.Write(&buf, be, uint32(0))
+	return buf.Bytes()
+}
+
+func TestDecodeBigEndianPackBits(t *testing.T) {
+	img, err := Decode(bytes.NewReader(bigEndianGray()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint8{0xFF, 0xFF, 0xFF, 0xFF, 0xEF, 0xDF, 0xCF, 0x00}
+	for i, w := range want {
+		if got := img.At(i%4, i/4).(color.Gray).Y; got != w {
+			t.Errorf("pixel (%d, %d) = %#x, want %#x", i%4, i/4, got, w)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	data := bigEndianGray()
+	// Patch the compression entry (the fourth) to LZW.
+	p := 8 + 2 + 5 + 2 + 3*12 + 8
+	binary.BigEndian.PutUint16(data[p:], cLZW)
+	_, err := Decode(bytes.NewReader(data))
+	if _, ok := err.(UnsupportedError); !ok {
+		t.Errorf("Decode of LZW image: got %v, want UnsupportedError", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	// patch returns the image with its width, height and compression
+	// entries, the first, second and fourth, set to the given values.
+	patch := func(width, height, compression uint16) []byte {
+		data := bigEndianGray()
+		p := 8 + 2 + 5 + 2 + 8
+		binary.BigEndian.PutUint16(data[p:], width)
+		binary.BigEndian.PutUint16(data[p+12:], height)
+		binary.BigEndian.PutUint16(data[p+3*12:], compression)
+		return data
+	}
+	_, err := Decode(bytes.NewReader(patch(0xFFFF, 0xFFFF, cPackBits)))
+	if _, ok := err.(UnsupportedError); !ok {
+		t.Errorf("Decode of 65535x65535 image: got %v, want UnsupportedError", err)
+	}
+	_, err = Decode(bytes.NewReader(patch(1000, 60000, cNone)))
+	if _, ok := err.(FormatError); !ok {
+		t.Errorf("Decode of truncated uncompressed image: got %v, want FormatError", err)
+	}
+}
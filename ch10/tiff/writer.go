@@ -0,0 +1,223 @@
+package tiff
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// A CompressionType selects how the encoder compresses pixel data.
+type CompressionType int
+
+const (
+	Uncompressed CompressionType = iota
+	Deflate
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	Compression CompressionType
+	// Predictor enables horizontal differencing, which usually
+	// improves compression of photographic images.
+	Predictor bool
+}
+
+// An ifdEntry is a directory entry to be written.
+type ifdEntry struct {
+	tag  uint16
+	typ  int
+	vals []uint32 // for dtRational, numerator and denominator pairs
+}
+
+func (e ifdEntry) count() int {
+	if e.typ == dtRational {
+		return len(e.vals) / 2
+	}
+	return len(e.vals)
+}
+
+// Encode writes img to w in little-endian TIFF format as a single strip.
+// Paletted, 8-bit gray and 16-bit gray images are written as such;
+// other images as 8-bit RGB, with an alpha channel if img is not opaque.
+// If opt is nil, the image is written uncompressed.
+func Encode(w io.Writer, img image.Image, opt *Options) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width <= 0 || height <= 0 {
+		return errors.New("tiff: empty image")
+	}
+	if opt == nil {
+		opt = &Options{}
+	}
+	le := binary.LittleEndian
+
+	var pix []byte
+	var spp, bps, photometric int
+	var extra []ifdEntry
+	switch m := img.(type) {
+	case *image.Paletted:
+		if len(m.Palette) > 256 {
+			return errors.New("tiff: palette too large")
+		}
+		spp, bps, photometric = 1, 8, pPaletted
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := m.PixOffset(b.Min.X, y)
+			pix = append(pix, m.Pix[i:i+width]...)
+		}
+		cmap := make([]uint32, 3*256)
+		for i, c := range m.Palette {
+			r, g, b, _ := c.RGBA()
+			cmap[i], cmap[i+256], cmap[i+512] = r, g, b
+		}
+		extra = append(extra, ifdEntry{tColorMap, dtShort, cmap})
+	case *image.Gray:
+		spp, bps, photometric = 1, 8, pBlackIsZero
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := m.PixOffset(b.Min.X, y)
+			pix = append(pix, m.Pix[i:i+width]...)
+		}
+	case *image.Gray16:
+		spp, bps, photometric = 1, 16, pBlackIsZero
+		pix = make([]byte, 0, 2*width*height)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				v := m.Gray16At(x, y).Y
+				pix = append(pix, byte(v), byte(v>>8))
+			}
+		}
+	default:
+		spp, bps, photometric = 3, 8, pRGB
+		if !opaque(img) {
+			spp = 4
+			extra = append(extra, ifdEntry{tExtraSamples, dtShort, []uint32{2}}) // straight alpha
+		}
+		pix = make([]byte, 0, spp*width*height)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+				pix = append(pix, c.R, c.G, c.B)
+				if spp == 4 {
+					pix = append(pix, c.A)
+				}
+			}
+		}
+	}
+
+	predictor := 1
+	if opt.Predictor && photometric != pPaletted {
+		predictor = 2
+		rowBytes := width * spp * bps / 8
+		for y := 0; y < height; y++ {
+			row := pix[y*rowBytes : (y+1)*rowBytes]
+			if bps == 8 {
+				for i := len(row) - 1; i >= spp; i-- {
+					row[i] -= row[i-spp]
+				}
+			} else {
+				for i := len(row) - 2; i >= 2*spp; i -= 2 {
+					le.PutUint16(row[i:], le.Uint16(row[i:])-le.Uint16(row[i-2*spp:]))
+				}
+			}
+		}
+	}
+
+	compression := cNone
+	if opt.Compression == Deflate {
+		compression = cDeflate
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(pix)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		pix = buf.Bytes()
+	}
+
+	bpsVals := make([]uint32, spp)
+	for i := range bpsVals {
+		bpsVals[i] = uint32(bps)
+	}
+	dataOffset := uint32(8)
+	entries := append([]ifdEntry{
+		{tImageWidth, dtLong, []uint32{uint32(width)}},
+		{tImageLength, dtLong, []uint32{uint32(height)}},
+		{tBitsPerSample, dtShort, bpsVals},
+		{tCompression, dtShort, []uint32{uint32(compression)}},
+		{tPhotometric, dtShort, []uint32{uint32(photometric)}},
+		{tStripOffsets, dtLong, []uint32{dataOffset}},
+		{tSamplesPerPixel, dtShort, []uint32{uint32(spp)}},
+		{tRowsPerStrip, dtLong, []uint32{uint32(height)}},
+		{tStripByteCounts, dtLong, []uint32{uint32(len(pix))}},
+		{tXResolution, dtRational, []uint32{72, 1}},
+		{tYResolution, dtRational, []uint32{72, 1}},
+		{tPlanarConfig, dtShort, []uint32{1}},
+		{tResolutionUnit, dtShort, []uint32{2}}, // inches
+		{tPredictor, dtShort, []uint32{uint32(predictor)}},
+	}, extra...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	// Layout: header, pixel data, IFD (word-aligned), out-of-line values.
+	ifdOffset := dataOffset + uint32(len(pix))
+	ifdOffset += ifdOffset & 1
+	ifdLen := 2 + 12*len(entries) + 4
+	extraOffset := ifdOffset + uint32(ifdLen)
+
+	var ifd, values bytes.Buffer
+	binary.Write(&ifd, le, uint16(len(entries)))
+	for _, e := range entries {
+		var val bytes.Buffer
+		for _, v := range e.vals {
+			switch e.typ {
+			case dtShort:
+				binary.Write(&val, le, uint16(v))
+			default:
+				binary.Write(&val, le, v)
+			}
+		}
+		binary.Write(&ifd, le, e.tag)
+		binary.Write(&ifd, le, uint16(e.typ))
+		binary.Write(&ifd, le, uint32(e.count()))
+		if val.Len() <= 4 {
+			var inline [4]byte
+			copy(inline[:], val.Bytes())
+			ifd.Write(inline[:])
+		} else {
+			binary.Write(&ifd, le, extraOffset+uint32(values.Len()))
+			values.Write(val.Bytes())
+		}
+	}
+	binary.Write(&ifd, le, uint32(0)) // no next IFD
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("II*\x00")
+	binary.Write(bw, le, ifdOffset)
+	bw.Write(pix)
+	if len(pix)&1 == 1 {
+		bw.WriteByte(0)
+	}
+	bw.Write(ifd.Bytes())
+	bw.Write(values.Bytes())
+	return bw.Flush()
+}
+
+// opaque reports whether every pixel of img is fully opaque.
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xFFFF {
+				return false
+			}
+		}
+	}
+	return true
+}
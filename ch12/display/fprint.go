@@ -0,0 +1,488 @@
+package display
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options control the output of Fprint.
+type Options struct {
+	// Name is the name by which paths refer to the value; "x" if empty.
+	Name string
+
+	// MaxDepth, if positive, is the number of levels of structs,
+	// arrays, slices, maps, pointers and interfaces that are expanded.
+	// Values nested more deeply are shown as <max depth>.
+	MaxDepth int
+
+	// MaxElems, if positive, is the greatest number of elements shown
+	// of any array, slice or map. The rest are counted, as in
+	// x.list[10:] = <90 more>.
+	MaxElems int
+
+	// SortMapKeys causes map elements to be shown in order of their
+	// keys, rather than in the map's random iteration order.
+	SortMapKeys bool
+
+	// ShowTypes causes the type of each value to follow it.
+	ShowTypes bool
+
+	// GoSyntax causes the value to be written instead as a Go
+	// expression that reproduces it, suitable for a test fixture:
+	// a composite literal for a struct, array, slice or map.
+	// Zero fields are left out, map keys are always sorted, and the
+	// other options, except Package, are ignored. Values that cannot
+	// be reproduced, such as non-nil channels and functions, and
+	// pointers that lead back into a cycle, are written as nil with a
+	// comment, and unexported fields of other packages' types as just
+	// a comment. Floating-point infinities and NaNs require package math.
+	GoSyntax bool
+
+	// Package is the import path of the package in which a GoSyntax
+	// expression will be compiled. Its types are written unqualified.
+	Package string
+}
+
+// Fprint writes to w a description of x, line by line, like Display
+// but according to opts. A pointer, slice or map that leads back to a
+// value that encloses it is shown as a cycle to the path of that value,
+// as in (*(*x).next).next = <cycle to (*x).next>.
+func Fprint(w io.Writer, x interface{}, opts Options) error {
+	if opts.Name == "" {
+		opts.Name = "x"
+	}
+	p := &printer{Writer: bufio.NewWriter(w), opts: opts, active: make(map[ref]string)}
+	v := reflect.ValueOf(x)
+	if opts.GoSyntax {
+		p.literal(opts.Name, v, 0, true)
+		p.WriteByte('\n')
+	} else {
+		p.display(opts.Name, v, 0)
+	}
+	return p.Flush()
+}
+
+// A ref identifies the variable or variables to which a pointer, slice
+// or map refers.
+type ref struct {
+	ptr uintptr
+	t   reflect.Type
+	len int
+}
+
+type printer struct {
+	*bufio.Writer
+	opts   Options
+	active map[ref]string // references being expanded, and their paths
+}
+
+// enter records that the reference v at path is being expanded. If it
+// already is, enter returns the path of that expansion and false.
+func (p *printer) enter(path string, v reflect.Value) (r ref, cycle string, ok bool) {
+	r = ref{ptr: v.Pointer(), t: v.Type()}
+	if v.Kind() == reflect.Slice {
+		r.len = v.Len()
+	}
+	if prev, ok := p.active[r]; ok {
+		return r, prev, false
+	}
+	p.active[r] = path
+	return r, "", true
+}
+
+func (p *printer) line(path, value string, t reflect.Type) {
+	if p.opts.ShowTypes && t != nil {
+		fmt.Fprintf(p, "%s = %s (%s)\n", path, value, t)
+	} else {
+		fmt.Fprintf(p, "%s = %s\n", path, value)
+	}
+}
+
+// limit returns the number of the n elements of an array, slice or map
+// that are shown.
+func (p *printer) limit(n int) int {
+	if p.opts.MaxElems > 0 && n > p.opts.MaxElems {
+		return p.opts.MaxElems
+	}
+	return n
+}
+
+func (p *printer) display(path string, v reflect.Value, depth int) {
+	if !v.IsValid() {
+		p.line(path, "invalid", nil)
+		return
+	}
+	if p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth && expands(v) {
+		p.line(path, "<max depth>", v.Type())
+		return
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			r, cycle, ok := p.enter(path, v)
+			if !ok {
+				p.line(path, "<cycle to "+cycle+">", v.Type())
+				return
+			}
+			defer delete(p.active, r)
+		}
+		n := p.limit(v.Len())
+		for i := 0; i < n; i++ {
+			p.display(fmt.Sprintf("%s[%d]", path, i), v.Index(i), depth+1)
+		}
+		if n < v.Len() {
+			p.line(fmt.Sprintf("%s[%d:]", path, n), fmt.Sprintf("<%d more>", v.Len()-n), nil)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			fieldPath := fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name)
+			p.display(fieldPath, v.Field(i), depth+1)
+		}
+	case reflect.Map:
+		if v.Len() > 0 {
+			r, cycle, ok := p.enter(path, v)
+			if !ok {
+				p.line(path, "<cycle to "+cycle+">", v.Type())
+				return
+			}
+			defer delete(p.active, r)
+		}
+		keys := v.MapKeys()
+		if p.opts.SortMapKeys {
+			sortKeys(keys)
+		}
+		n := p.limit(len(keys))
+		for _, key := range keys[:n] {
+			p.display(fmt.Sprintf("%s[%s]", path, atom(key)), v.MapIndex(key), depth+1)
+		}
+		if n < len(keys) {
+			p.line(path+"[...]", fmt.Sprintf("<%d more>", len(keys)-n), nil)
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			p.line(path, "nil", v.Type())
+			return
+		}
+		r, cycle, ok := p.enter(path, v)
+		if !ok {
+			p.line(path, "<cycle to "+cycle+">", v.Type())
+			return
+		}
+		defer delete(p.active, r)
+		p.display(fmt.Sprintf("(*%s)", path), v.Elem(), depth+1)
+	case reflect.Interface:
+		if v.IsNil() {
+			p.line(path, "nil", v.Type())
+			return
+		}
+		p.line(path+".type", v.Elem().Type().String(), nil)
+		p.display(path+".value", v.Elem(), depth+1)
+	default: // basic types, channels, funcs
+		p.line(path, atom(v), v.Type())
+	}
+}
+
+// expands reports whether display would show v as more than one line.
+func expands(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map:
+		return v.Len() > 0
+	case reflect.Struct:
+		return v.NumField() > 0
+	case reflect.Ptr, reflect.Interface:
+		return !v.IsNil()
+	}
+	return false
+}
+
+// sortKeys sorts map keys: numbers by value, strings and booleans
+// naturally, and other keys by their formatted text.
+func sortKeys(keys []reflect.Value) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		x, y := keys[i], keys[j]
+		if x.Kind() == reflect.Interface {
+			x, y = x.Elem(), y.Elem()
+		}
+		if x.Kind() == y.Kind() {
+			switch x.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return x.Int() < y.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				return x.Uint() < y.Uint()
+			case reflect.Float32, reflect.Float64:
+				return x.Float() < y.Float()
+			case reflect.String:
+				return x.String() < y.String()
+			case reflect.Bool:
+				return !x.Bool() && y.Bool()
+			}
+		}
+		return atom(x) < atom(y)
+	})
+}
+
+// literal writes a Go expression for v, whose path is path, at the
+// given level of indentation. If typed is set, the expression's type
+// must be v's, as when it is the value of an interface; otherwise it
+// need only be assignable to v's type.
+func (p *printer) literal(path string, v reflect.Value, indent int, typed bool) {
+	if !v.IsValid() {
+		p.WriteString("nil")
+		return
+	}
+	t := v.Type()
+	switch v.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		lit, exact := basicLit(v)
+		// Infinities and NaNs are not constants, and have type float64
+		// or complex128 even where another type is implied.
+		constant := !strings.Contains(lit, "math.")
+		if typed && !exact || !constant && t != float64Type && t != complex128Type {
+			lit = p.typeString(t) + "(" + lit + ")"
+		}
+		p.WriteString(lit)
+
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		p.nilValue(t, typed)
+		if !v.IsNil() {
+			fmt.Fprintf(p, " /* %s value */", t)
+		}
+
+	case reflect.Interface:
+		if v.IsNil() {
+			p.WriteString("nil")
+			return
+		}
+		p.literal(path+".value", v.Elem(), indent, true)
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			p.nilValue(t, typed)
+			return
+		}
+		r, cycle, ok := p.enter(path, v)
+		if !ok {
+			p.nilValue(t, typed)
+			fmt.Fprintf(p, " /* cycle to %s */", cycle)
+			return
+		}
+		defer delete(p.active, r)
+		switch v.Elem().Kind() {
+		case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+			p.WriteByte('&')
+			p.literal("(*"+path+")", v.Elem(), indent, true)
+		default:
+			// There is no literal for a pointer to other kinds of value.
+			fmt.Fprintf(p, "func() %s { v := ", p.typeString(t))
+			p.literal("(*"+path+")", v.Elem(), indent, true)
+			p.WriteString("; return &v }()")
+		}
+
+	case reflect.Slice:
+		if v.IsNil() {
+			p.nilValue(t, typed)
+			return
+		}
+		if v.Len() > 0 {
+			r, cycle, ok := p.enter(path, v)
+			if !ok {
+				p.nilValue(t, typed)
+				fmt.Fprintf(p, " /* cycle to %s */", cycle)
+				return
+			}
+			defer delete(p.active, r)
+		}
+		p.elems(path, v, indent)
+
+	case reflect.Array:
+		p.elems(path, v, indent)
+
+	case reflect.Map:
+		if v.IsNil() {
+			p.nilValue(t, typed)
+			return
+		}
+		if v.Len() > 0 {
+			r, cycle, ok := p.enter(path, v)
+			if !ok {
+				p.nilValue(t, typed)
+				fmt.Fprintf(p, " /* cycle to %s */", cycle)
+				return
+			}
+			defer delete(p.active, r)
+		}
+		keys := v.MapKeys()
+		sortKeys(keys)
+		p.WriteString(p.typeString(t) + "{")
+		for _, key := range keys {
+			p.newline(indent + 1)
+			p.literal(path, key, indent+1, false)
+			p.WriteString(": ")
+			p.literal(fmt.Sprintf("%s[%s]", path, atom(key)), v.MapIndex(key), indent+1, false)
+			p.WriteByte(',')
+		}
+		p.close(len(keys), indent)
+
+	case reflect.Struct:
+		p.WriteString(p.typeString(t) + "{")
+		n := 0
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).IsZero() {
+				continue
+			}
+			name := t.Field(i).Name
+			if pkg := t.Field(i).PkgPath; pkg != "" && pkg != p.opts.Package {
+				// The field cannot be set outside its package.
+				p.newline(indent + 1)
+				fmt.Fprintf(p, "/* unexported field %s */", name)
+				n++
+				continue
+			}
+			p.newline(indent + 1)
+			p.WriteString(name + ": ")
+			p.literal(path+"."+name, v.Field(i), indent+1, false)
+			p.WriteByte(',')
+			n++
+		}
+		p.close(n, indent)
+	}
+}
+
+// elems writes a composite literal for the slice or array v.
+func (p *printer) elems(path string, v reflect.Value, indent int) {
+	p.WriteString(p.typeString(v.Type()) + "{")
+	for i := 0; i < v.Len(); i++ {
+		p.newline(indent + 1)
+		p.literal(fmt.Sprintf("%s[%d]", path, i), v.Index(i), indent+1, false)
+		p.WriteByte(',')
+	}
+	p.close(v.Len(), indent)
+}
+
+func (p *printer) newline(indent int) {
+	p.WriteByte('\n')
+	p.WriteString(strings.Repeat("\t", indent))
+}
+
+// close ends a composite literal of n elements.
+func (p *printer) close(n, indent int) {
+	if n > 0 {
+		p.newline(indent)
+	}
+	p.WriteByte('}')
+}
+
+func (p *printer) nilValue(t reflect.Type, typed bool) {
+	if typed {
+		fmt.Fprintf(p, "(%s)(nil)", p.typeString(t))
+	} else {
+		p.WriteString("nil")
+	}
+}
+
+var (
+	float64Type    = reflect.TypeOf(0.0)
+	complex128Type = reflect.TypeOf(0i)
+)
+
+// atom formats v as formatAtom does, and floating-point and complex
+// numbers, for which formatAtom gives only the type, too.
+func atom(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits())
+	}
+	return formatAtom(v)
+}
+
+// basicLit returns a Go expression for the value of v, which has a
+// basic kind, and whether that expression has v's type even where no
+// type is implied, as an element of an interface{} has not.
+func basicLit(v reflect.Value) (lit string, exact bool) {
+	named := v.Type().PkgPath() != ""
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), !named
+	case reflect.String:
+		return strconv.Quote(v.String()), !named
+	case reflect.Int:
+		return strconv.FormatInt(v.Int(), 10), !named
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), false
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		switch {
+		case math.IsInf(f, 1):
+			return "math.Inf(1)", false
+		case math.IsInf(f, -1):
+			return "math.Inf(-1)", false
+		case math.IsNaN(f):
+			return "math.NaN()", false
+		}
+		s := strconv.FormatFloat(f, 'g', -1, v.Type().Bits())
+		return s, !named && v.Kind() == reflect.Float64 && strings.ContainsAny(s, ".e")
+	default: // complex
+		c := v.Complex()
+		bits := v.Type().Bits() / 2
+		for _, f := range []float64{real(c), imag(c)} {
+			if math.IsInf(f, 0) || math.IsNaN(f) {
+				re, _ := basicLit(reflect.ValueOf(real(c)))
+				im, _ := basicLit(reflect.ValueOf(imag(c)))
+				return "complex(" + re + ", " + im + ")", false
+			}
+		}
+		return strconv.FormatComplex(c, 'g', -1, 2*bits), !named && v.Kind() == reflect.Complex128
+	}
+}
+
+// typeString returns the Go syntax for t, leaving types of the package
+// given by opts.Package unqualified.
+func (p *printer) typeString(t reflect.Type) string {
+	if t.Name() != "" {
+		if t.PkgPath() == "" || t.PkgPath() == p.opts.Package {
+			return t.Name()
+		}
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + p.typeString(t.Elem())
+	case reflect.Slice:
+		return "[]" + p.typeString(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), p.typeString(t.Elem()))
+	case reflect.Map:
+		return "map[" + p.typeString(t.Key()) + "]" + p.typeString(t.Elem())
+	case reflect.Struct:
+		var fields []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			s := p.typeString(f.Type)
+			if !f.Anonymous {
+				s = f.Name + " " + s
+			}
+			if f.Tag != "" {
+				s += " " + strconv.Quote(string(f.Tag))
+			}
+			fields = append(fields, s)
+		}
+		if len(fields) == 0 {
+			return "struct{}"
+		}
+		return "struct { " + strings.Join(fields, "; ") + " }"
+	}
+	return t.String()
+}
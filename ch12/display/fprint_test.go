@@ -0,0 +1,178 @@
+package display
+
+import (
+	"go/parser"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+type node struct {
+	value int
+	next  *node
+}
+
+func ExampleFprint() {
+	a := &node{value: 1}
+	a.next = &node{value: 2, next: a}
+	Fprint(os.Stdout, a, Options{})
+	// Output:
+	// (*x).value = 1
+	// (*(*x).next).value = 2
+	// (*(*x).next).next = <cycle to x>
+}
+
+func ExampleFprint_options() {
+	type Movie struct {
+		Title  string
+		Rating float64
+		Actor  map[string]string
+		Oscars []string
+		Sequel *Movie
+	}
+	m := Movie{
+		Title:  "Dr. Strangelove",
+		Rating: 8.4,
+		Actor: map[string]string{
+			"Dr. Strangelove":           "Peter Sellers",
+			"Gen. Buck Turgidson":       "George C. Scott",
+			"Brig. Gen. Jack D. Ripper": "Sterling Hayden",
+		},
+		Oscars: []string{"Best Actor (Nomin.)", "Best Adapted Screenplay (Nomin.)", "Best Director (Nomin.)"},
+		Sequel: &Movie{Title: "Dr. Strangelove II", Sequel: &Movie{}},
+	}
+	Fprint(os.Stdout, m, Options{
+		Name:        "m",
+		MaxDepth:    2,
+		MaxElems:    2,
+		SortMapKeys: true,
+		ShowTypes:   true,
+	})
+	// Output:
+	// m.Title = "Dr. Strangelove" (string)
+	// m.Rating = 8.4 (float64)
+	// m.Actor["Brig. Gen. Jack D. Ripper"] = "Sterling Hayden" (string)
+	// m.Actor["Dr. Strangelove"] = "Peter Sellers" (string)
+	// m.Actor[...] = <1 more>
+	// m.Oscars[0] = "Best Actor (Nomin.)" (string)
+	// m.Oscars[1] = "Best Adapted Screenplay (Nomin.)" (string)
+	// m.Oscars[2:] = <1 more>
+	// (*m.Sequel) = <max depth> (display.Movie)
+}
+
+func TestFprintCycles(t *testing.T) {
+	type M map[string]M
+	m := make(M)
+	m["self"] = m
+	type S []S
+	s := make(S, 1)
+	s[0] = s
+	type P *P
+	var p P
+	p = &p
+	for _, test := range []struct {
+		x    interface{}
+		want string
+	}{
+		{m, `x["self"] = <cycle to x>` + "\n"},
+		{s, "x[0] = <cycle to x>\n"},
+		{p, "(*x) = <cycle to x>\n"},
+		// Shared, acyclic references are expanded each time.
+		{[]*int{new(int), new(int)}, "(*x[0]) = 0\n(*x[1]) = 0\n"},
+		{[2]float32{1.5, float32(math.Inf(-1))}, "x[0] = 1.5\nx[1] = -Inf\n"},
+		{complex(1, -2), "x = (1-2i)\n"},
+	} {
+		var b strings.Builder
+		if err := Fprint(&b, test.x, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.want {
+			t.Errorf("Fprint(%T) =\n%s\nwant\n%s", test.x, b.String(), test.want)
+		}
+	}
+}
+
+type fixture struct {
+	Name   string
+	Count  int8
+	Ratio  float32
+	Tags   map[string][]int
+	Any    interface{}
+	Next   *fixture
+	Ptr    *uint
+	Skip   []string
+	Nested struct {
+		On bool
+	}
+	private func()
+}
+
+func TestGoSyntax(t *testing.T) {
+	n := uint(7)
+	x := &fixture{
+		Name:    "a\tb",
+		Count:   -3,
+		Ratio:   1,
+		Tags:    map[string][]int{"b": {2}, "a": nil},
+		Any:     []interface{}{1, 2.5, int16(3), "s", nil, math.NaN(), float32(math.Inf(1))},
+		Next:    &fixture{Name: "next"},
+		Ptr:     &n,
+		private: func() {},
+	}
+	x.Next.Next = x
+	x.Nested.On = true
+
+	var b strings.Builder
+	Fprint(&b, x, Options{GoSyntax: true, Package: "gopl.io/ch12/display"})
+	want := `&fixture{
+	Name: "a\tb",
+	Count: -3,
+	Ratio: 1,
+	Tags: map[string][]int{
+		"a": nil,
+		"b": []int{
+			2,
+		},
+	},
+	Any: []interface {}{
+		1,
+		2.5,
+		int16(3),
+		"s",
+		nil,
+		float64(math.NaN()),
+		float32(math.Inf(1)),
+	},
+	Next: &fixture{
+		Name: "next",
+		Next: nil /* cycle to x */,
+	},
+	Ptr: func() *uint { v := uint(7); return &v }(),
+	Nested: struct { On bool }{
+		On: true,
+	},
+	private: nil /* func() value */,
+}
+`
+	if b.String() != want {
+		t.Errorf("GoSyntax =\n%s\nwant\n%s", b.String(), want)
+	}
+	if _, err := parser.ParseExpr(b.String()); err != nil {
+		t.Errorf("GoSyntax output does not parse: %v", err)
+	}
+
+	b.Reset()
+	Fprint(&b, map[int]*fixture(nil), Options{GoSyntax: true})
+	if got, want := b.String(), "(map[int]*display.fixture)(nil)\n"; got != want {
+		t.Errorf("GoSyntax = %s, want %s", got, want)
+	}
+
+	// Unexported fields of other packages' types cannot be set.
+	b.Reset()
+	Fprint(&b, time.Unix(1, 0).UTC(), Options{GoSyntax: true})
+	if got, want := b.String(), "time.Time{\n\t/* unexported field ext */\n}\n"; got != want {
+		t.Errorf("GoSyntax = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,371 @@
+package display
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	pageSize    = 100 // children sent in one response
+	inlineElems = 20  // largest collection expanded without a request
+	inlineDepth = 3   // levels expanded without a request
+)
+
+// Handler returns an HTTP handler that shows each of the named values
+// as a collapsible tree, with the paths that Display prints. Small
+// values are sent whole; the elements of large or deeply nested ones
+// are fetched as they are expanded, by requests such as
+//
+//	GET /?path=(*x).field[3]&start=100
+//
+// which return an HTML fragment listing the children of the value at
+// that path, starting with the given one.
+//
+// The values are read afresh for each request, so a pointer shows the
+// current state of its variable; the handler does no locking, so the
+// program must not update what it points to at the same time.
+func Handler(values map[string]interface{}) http.Handler {
+	return &inspector{values: values}
+}
+
+type inspector struct {
+	values map[string]interface{}
+}
+
+func (in *inspector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	path := req.FormValue("path")
+	if path == "" {
+		in.page(w)
+		return
+	}
+	v, err := in.resolve(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	start, err := strconv.Atoi(req.FormValue("start"))
+	if req.FormValue("start") == "" {
+		start, err = 0, nil
+	}
+	if err != nil || start < 0 {
+		http.Error(w, "bad start", http.StatusBadRequest)
+		return
+	}
+	// The value being expanded is on the path to its children.
+	active := make(map[ref]string)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		active[ref{ptr: v.Pointer(), t: v.Type()}] = path
+	}
+	bw := bufio.NewWriter(w)
+	writeChildren(bw, path, v, start, 0, active)
+	bw.Flush()
+}
+
+// page writes the whole page, with a tree for each value.
+func (in *inspector) page(w http.ResponseWriter) {
+	var names []string
+	for name := range in.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	bw.WriteString(pageHead)
+	bw.WriteString("<ul>\n")
+	for _, name := range names {
+		writeNode(bw, name, reflect.ValueOf(in.values[name]), 0, make(map[ref]string))
+	}
+	bw.WriteString("</ul>\n")
+	bw.WriteString(pageTail)
+	bw.Flush()
+}
+
+// A child is one element of a composite value.
+type child struct {
+	path string
+	v    reflect.Value
+}
+
+// children returns the elements of v, whose path is path, that display
+// would visit, from start to start+n, and how many there are in all.
+// Map elements are in order of their keys.
+func children(path string, v reflect.Value, start, n int) ([]child, int) {
+	var kids []child
+	total := 0
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		total = v.Len()
+		for i := start; i < total && i < start+n; i++ {
+			kids = append(kids, child{fmt.Sprintf("%s[%d]", path, i), v.Index(i)})
+		}
+	case reflect.Struct:
+		total = v.NumField()
+		for i := start; i < total && i < start+n; i++ {
+			kids = append(kids, child{path + "." + v.Type().Field(i).Name, v.Field(i)})
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sortKeys(keys)
+		total = len(keys)
+		for i := start; i < total && i < start+n; i++ {
+			kids = append(kids, child{fmt.Sprintf("%s[%s]", path, atom(keys[i])), v.MapIndex(keys[i])})
+		}
+	case reflect.Ptr:
+		if !v.IsNil() && start == 0 {
+			total = 1
+			kids = append(kids, child{"(*" + path + ")", v.Elem()})
+		}
+	case reflect.Interface:
+		if !v.IsNil() && start == 0 {
+			total = 1
+			kids = append(kids, child{path + ".value", v.Elem()})
+		}
+	}
+	return kids, total
+}
+
+// writeNode writes a list item for v: a leaf for a basic value, or a
+// collapsible tree whose children are written now, if v is small and
+// shallow enough, or fetched when it is opened. Active holds the
+// pointers being written along the path to v; a pointer already among
+// them is written as a cycle to the path where it was met.
+func writeNode(w *bufio.Writer, path string, v reflect.Value, depth int, active map[ref]string) {
+	if !v.IsValid() || !expands(v) {
+		value := "invalid"
+		if v.IsValid() {
+			value = atom(v)
+			if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+				value = "nil"
+			}
+		}
+		writeLeaf(w, path, value, v)
+		return
+	}
+	var r ref
+	if v.Kind() == reflect.Ptr {
+		r = ref{ptr: v.Pointer(), t: v.Type()}
+		if prev, ok := active[r]; ok {
+			writeLeaf(w, path, "<cycle to "+prev+">", v)
+			return
+		}
+	}
+
+	_, total := children(path, v, 0, 0)
+	summary := html.EscapeString(v.Type().String())
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		summary += fmt.Sprintf(" (%d)", total)
+	case reflect.Interface:
+		summary = html.EscapeString(v.Elem().Type().String()) + " in " + summary
+	}
+	if depth < inlineDepth && total <= inlineElems {
+		fmt.Fprintf(w, "<li><details><summary><code>%s</code> <i>%s</i></summary>\n",
+			html.EscapeString(path), summary)
+		if v.Kind() == reflect.Ptr {
+			active[r] = path
+			defer delete(active, r)
+		}
+		if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface {
+			depth++ // a pointer or interface is not a level of its own
+		}
+		writeChildren(w, path, v, 0, depth, active)
+	} else {
+		fmt.Fprintf(w, "<li><details data-path=\"%s\"><summary><code>%s</code> <i>%s</i></summary>\n",
+			html.EscapeString(path), html.EscapeString(path), summary)
+	}
+	w.WriteString("</details></li>\n")
+}
+
+// writeLeaf writes a list item showing the value at path, and the type
+// of v if it is valid.
+func writeLeaf(w *bufio.Writer, path, value string, v reflect.Value) {
+	fmt.Fprintf(w, "<li><code>%s</code> = %s", html.EscapeString(path), html.EscapeString(value))
+	if v.IsValid() {
+		fmt.Fprintf(w, " <i>%s</i>", html.EscapeString(v.Type().String()))
+	}
+	w.WriteString("</li>\n")
+}
+
+// writeChildren writes a list of up to pageSize children of v from
+// start, followed, if there are more, by a node that fetches them.
+func writeChildren(w *bufio.Writer, path string, v reflect.Value, start, depth int, active map[ref]string) {
+	kids, total := children(path, v, start, pageSize)
+	w.WriteString("<ul>\n")
+	for _, k := range kids {
+		writeNode(w, k.path, k.v, depth, active)
+	}
+	if next := start + len(kids); next < total {
+		fmt.Fprintf(w, "<li><details data-path=\"%s\" data-start=\"%d\"><summary>%d more</summary></details></li>\n",
+			html.EscapeString(path), next, total-next)
+	}
+	w.WriteString("</ul>\n")
+}
+
+// resolve returns the value at path, which is written as Display
+// writes paths: the name of a value, followed by field selectors,
+// indices and map keys, within any number of (*...) dereferences, as
+// in (*(*x).next).items["key"]. The .value of an interface is its
+// dynamic value. A map key is matched by the text Display shows for it.
+func (in *inspector) resolve(path string) (reflect.Value, error) {
+	s := path
+	derefs := 0
+	for strings.HasPrefix(s, "(*") {
+		s = s[2:]
+		derefs++
+	}
+	// The name is the longest one that s begins with.
+	var name string
+	for n := range in.values {
+		if strings.HasPrefix(s, n) && len(n) > len(name) {
+			name = n
+		}
+	}
+	if name == "" {
+		return reflect.Value{}, fmt.Errorf("no value named in %q", path)
+	}
+	v := reflect.ValueOf(in.values[name])
+	s = s[len(name):]
+
+	bad := func(format string, args ...interface{}) (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("bad path %q: %s", path, fmt.Sprintf(format, args...))
+	}
+	for s != "" {
+		switch s[0] {
+		case ')':
+			if derefs == 0 || v.Kind() != reflect.Ptr || v.IsNil() {
+				return bad("%s is not a non-nil pointer", typeOf(v))
+			}
+			derefs--
+			v = v.Elem()
+			s = s[1:]
+
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[)")
+			if end < 0 {
+				end = len(s)
+			}
+			sel := s[:end]
+			s = s[end:]
+			switch {
+			case v.Kind() == reflect.Interface && sel == "value" && !v.IsNil():
+				v = v.Elem()
+			case v.Kind() == reflect.Struct && v.FieldByName(sel).IsValid():
+				v = v.FieldByName(sel)
+			default:
+				return bad("%s has no element .%s", typeOf(v), sel)
+			}
+
+		case '[':
+			end := keyEnd(s)
+			if end < 0 {
+				return bad("unterminated [")
+			}
+			key := s[1:end]
+			s = s[end+1:]
+			elem, ok := index(v, key)
+			if !ok {
+				return bad("%s has no element [%s]", typeOf(v), key)
+			}
+			v = elem
+
+		default:
+			return bad("unexpected %q", s)
+		}
+	}
+	if derefs != 0 {
+		return bad("unbalanced (*")
+	}
+	return v, nil
+}
+
+func typeOf(v reflect.Value) string {
+	if !v.IsValid() {
+		return "invalid value"
+	}
+	return v.Type().String()
+}
+
+// keyEnd returns the index of the ] that closes the [ at the start of
+// s, skipping over a quoted key, or -1.
+func keyEnd(s string) int {
+	i := 1
+	if i < len(s) && s[i] == '"' {
+		for i++; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' {
+				i++
+			}
+		}
+		i++ // past the closing quote
+	}
+	if i > len(s) {
+		return -1
+	}
+	if j := strings.IndexByte(s[i:], ']'); j >= 0 {
+		return i + j
+	}
+	return -1
+}
+
+// index returns the element of the array, slice or map v that
+// Display shows as [key].
+func index(v reflect.Value, key string) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= v.Len() {
+			return reflect.Value{}, false
+		}
+		return v.Index(i), true
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			if atom(k) == key {
+				return v.MapIndex(k), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+const pageHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>display</title>
+<style>
+body { font-family: sans-serif; }
+ul { list-style: none; padding-left: 1.5em; }
+i { color: grey; font-size: smaller; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+`
+
+// The script fetches the children of a node the first time it opens.
+const pageTail = `<script>
+document.addEventListener("toggle", function(e) {
+	var d = e.target;
+	if (!d.open || !d.dataset.path || d.dataset.loaded) {
+		return;
+	}
+	d.dataset.loaded = "yes";
+	var q = "?path=" + encodeURIComponent(d.dataset.path) + "&start=" + (d.dataset.start || 0);
+	fetch(q).then(function(r) { return r.text(); }).then(function(html) {
+		if (d.dataset.start) {
+			d.parentNode.outerHTML = html.replace(/^<ul>\n|<\/ul>\n$/g, "");
+		} else {
+			d.insertAdjacentHTML("beforeend", html);
+		}
+	});
+}, true);
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,136 @@
+package display
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type server struct {
+	Name    string
+	Conns   []*conn
+	Config  map[string]interface{}
+	Handler interface{}
+}
+
+type conn struct {
+	ID   int
+	Peer *server
+}
+
+func newServer() *server {
+	s := &server{
+		Name:   "web",
+		Config: map[string]interface{}{"port": 8080, `a "b"]`: []string{"x"}},
+	}
+	for i := 0; i < 250; i++ {
+		s.Conns = append(s.Conns, &conn{ID: i, Peer: s})
+	}
+	s.Handler = s.Conns[0]
+	return s
+}
+
+func fetch(t *testing.T, values map[string]interface{}, path, start string) (int, string) {
+	q := url.Values{"path": {path}}
+	if start != "" {
+		q.Set("start", start)
+	}
+	rec := httptest.NewRecorder()
+	Handler(values).ServeHTTP(rec, httptest.NewRequest("GET", "/?"+q.Encode(), nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestResolve(t *testing.T) {
+	s := newServer()
+	in := &inspector{values: map[string]interface{}{"srv": s, "srv.x": 42}}
+	for _, test := range []struct {
+		path string
+		want interface{}
+	}{
+		{"(*srv).Name", "web"},
+		{"(*(*srv).Conns[3]).ID", 3},
+		{"(*(*(*(*srv).Conns[3]).Peer).Conns[249]).ID", 249},
+		{`(*srv).Config["port"].value`, 8080},
+		{`(*srv).Config["a \"b\"]"].value[0]`, "x"},
+		{"(*(*srv).Handler.value).ID", 0},
+		{"srv.x", 42},
+	} {
+		v, err := in.resolve(test.path)
+		if err != nil {
+			t.Errorf("resolve(%s): %v", test.path, err)
+			continue
+		}
+		if got := v.Interface(); got != test.want {
+			t.Errorf("resolve(%s) = %v, want %v", test.path, got, test.want)
+		}
+	}
+	for _, path := range []string{
+		"nosuch",
+		"srv.Name", // srv is a pointer
+		"(*srv).Missing",
+		"(*srv).Conns[250]",
+		"(*srv).Conns[1",
+		"(*(*srv).Name)",
+		"(*srv",
+		`(*srv).Config["nope"]`,
+	} {
+		if _, err := in.resolve(path); err == nil {
+			t.Errorf("resolve(%s) succeeded", path)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	values := map[string]interface{}{"srv": newServer(), "n": 3}
+	code, page := fetch(t, values, "", "")
+	if code != 200 || !strings.Contains(page, "<code>n</code> = 3") {
+		t.Fatalf("page: %d\n%s", code, page)
+	}
+	// The 250 connections are too many to send with the page.
+	if !strings.Contains(page, `<details data-path="(*srv).Conns">`) {
+		t.Errorf("page does not defer (*srv).Conns:\n%s", page)
+	}
+	if !strings.Contains(page, `<code>(*srv).Config[&#34;port&#34;].value</code> = 8080`) {
+		t.Errorf("page lacks config port:\n%s", page)
+	}
+
+	_, frag := fetch(t, values, "(*srv).Conns", "")
+	if n := strings.Count(frag, "<code>(*srv).Conns["); n != pageSize {
+		t.Errorf("first page of Conns has %d items, want %d", n, pageSize)
+	}
+	if !strings.Contains(frag, `data-path="(*srv).Conns" data-start="100"><summary>150 more`) {
+		t.Errorf("first page of Conns lacks a link to the rest:\n%.500s", frag)
+	}
+	_, frag = fetch(t, values, "(*srv).Conns", "200")
+	if !strings.Contains(frag, "(*srv).Conns[249]") || strings.Contains(frag, "more") {
+		t.Errorf("last page of Conns:\n%.500s", frag)
+	}
+	_, frag = fetch(t, values, "(*(*srv).Conns[7])", "")
+	if !strings.Contains(frag, "<code>(*(*srv).Conns[7]).ID</code> = 7") {
+		t.Errorf("Conns[7]:\n%s", frag)
+	}
+
+	if code, _ := fetch(t, values, "(*srv).Nope", ""); code != 404 {
+		t.Errorf("bad path: status %d", code)
+	}
+	if code, _ := fetch(t, values, "n", "-1"); code != 400 {
+		t.Errorf("bad start: status %d", code)
+	}
+}
+
+func TestHandlerCycle(t *testing.T) {
+	v := new(interface{})
+	*v = v
+	values := map[string]interface{}{"v": v}
+	_, page := fetch(t, values, "", "")
+	if !strings.Contains(page, "<code>(*v).value</code> = &lt;cycle to v&gt;") {
+		t.Errorf("page lacks cycle:\n%s", page)
+	}
+	_, frag := fetch(t, values, "(*v).value", "")
+	if !strings.Contains(frag, "<code>(*(*v).value).value</code> = &lt;cycle to (*v).value&gt;") {
+		t.Errorf("fragment lacks cycle:\n%s", frag)
+	}
+}
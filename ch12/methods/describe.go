@@ -0,0 +1,272 @@
+package methods
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// A Report describes the method sets of a type T and of *T.
+type Report struct {
+	Value, Pointer MethodSet
+}
+
+// A MethodSet is the method set of one receiver type, T or *T.
+type MethodSet struct {
+	Receiver   reflect.Type
+	Methods    []Method       // in order of name
+	Implements []reflect.Type // those of the interfaces given to Describe
+}
+
+// A Method is one method of a method set.
+type Method struct {
+	Name string
+	Type reflect.Type // without the receiver
+
+	// For a method promoted from an embedded field, Via is the path of
+	// embedded field names through which it is promoted, such as
+	// "Point" or "Inner.Point", and From is the type of the last of
+	// those fields, which declares the method. Both are empty for a
+	// method declared on T or *T.
+	Via  string
+	From reflect.Type
+}
+
+// Describe reports the methods of T and *T, where x is of type T, or of
+// type *T if T is not itself a pointer, and which of the interfaces
+// ifaces each satisfies. Each element of ifaces is a nil pointer to an
+// interface type, as in
+//
+//	methods.Describe(x, (*io.Reader)(nil), (*fmt.Stringer)(nil))
+//
+// Describe panics if an element of ifaces is not such a pointer.
+func Describe(x interface{}, ifaces ...interface{}) *Report {
+	var its []reflect.Type
+	for _, i := range ifaces {
+		t := reflect.TypeOf(i)
+		if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+			panic(fmt.Sprintf("methods: Describe: %T is not a pointer to an interface", i))
+		}
+		its = append(its, t.Elem())
+	}
+
+	t := reflect.TypeOf(x)
+	if t == nil {
+		panic("methods: Describe(nil)")
+	}
+	if t.Kind() == reflect.Ptr && t.Name() == "" && t.Elem().Kind() != reflect.Ptr {
+		t = t.Elem()
+	}
+	ptr := reflect.PtrTo(t)
+	r := &Report{
+		Value:   MethodSet{Receiver: t},
+		Pointer: MethodSet{Receiver: ptr},
+	}
+	declared := make(map[string]bool) // of T's value methods
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		declared[m.Name] = t.Kind() == reflect.Interface || !promoted(t, m, false)
+		r.Value.Methods = append(r.Value.Methods, describe(t, m, declared[m.Name], false))
+	}
+	for i := 0; i < ptr.NumMethod(); i++ {
+		m := ptr.Method(i)
+		isDeclared, ok := declared[m.Name]
+		if !ok {
+			isDeclared = !promoted(t, m, true) // declared on *T
+		}
+		r.Pointer.Methods = append(r.Pointer.Methods, describe(t, m, isDeclared, true))
+	}
+	for _, it := range its {
+		if t.Implements(it) {
+			r.Value.Implements = append(r.Value.Implements, it)
+		}
+		if ptr.Implements(it) {
+			r.Pointer.Implements = append(r.Pointer.Implements, it)
+		}
+	}
+	return r
+}
+
+// describe returns the Method for m, a method of T or, if addressable,
+// of *T.
+func describe(t reflect.Type, m reflect.Method, declared, addressable bool) Method {
+	meth := Method{Name: m.Name, Type: m.Type}
+	if t.Kind() != reflect.Interface { // drop the receiver
+		ft := m.Type
+		in := make([]reflect.Type, ft.NumIn()-1)
+		for i := range in {
+			in[i] = ft.In(i + 1)
+		}
+		out := make([]reflect.Type, ft.NumOut())
+		for i := range out {
+			out[i] = ft.Out(i)
+		}
+		meth.Type = reflect.FuncOf(in, out, ft.IsVariadic())
+	}
+	if !declared {
+		meth.Via, meth.From = promotion(t, m.Name, addressable)
+	}
+	return meth
+}
+
+// promoted reports whether method m of t, or if addressable of *t, is
+// promoted from an embedded field rather than declared on t or *t.
+//
+// A method can be promoted only if an embedded field has one of the
+// same name, which the structure of t shows. But a method declared on
+// t shadows such a field's method, and reflection does not tell the
+// two apart. In that case only, promoted relies on isWrapper.
+func promoted(t reflect.Type, m reflect.Method, addressable bool) bool {
+	return embeds(t, m.Name, addressable) && isWrapper(m)
+}
+
+// embeds reports whether an embedded field of struct type t, or of a
+// field embedded in it in turn, has the method name. If addressable
+// is set, the methods of *F count for an embedded field of type F.
+func embeds(t reflect.Type, name string, addressable bool) bool {
+	level := []reflect.Type{t}
+	seen := make(map[reflect.Type]bool)
+	for len(level) > 0 {
+		var next []reflect.Type
+		for _, st := range level {
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+				addressable = true
+			}
+			if st.Kind() != reflect.Struct || seen[st] {
+				continue
+			}
+			seen[st] = true
+			for i := 0; i < st.NumField(); i++ {
+				if f := st.Field(i); f.Anonymous {
+					if hasMethod(f.Type, name, addressable || f.Type.Kind() == reflect.Ptr) {
+						return true
+					}
+					next = append(next, f.Type)
+				}
+			}
+		}
+		level = next
+	}
+	return false
+}
+
+// isWrapper reports whether the code of method m was generated by the
+// compiler, as it is for methods promoted from embedded fields and for
+// methods of *T that are declared on T. It depends on the gc runtime's
+// reporting "<autogenerated>" as the file of such code.
+func isWrapper(m reflect.Method) bool {
+	if m.Func.Kind() != reflect.Func {
+		return false
+	}
+	f := runtime.FuncForPC(m.Func.Pointer())
+	if f == nil {
+		return false
+	}
+	file, _ := f.FileLine(f.Entry())
+	return file == "<autogenerated>"
+}
+
+// promotion returns the path of embedded fields of struct type t
+// through which the method name is promoted, and the type of the last,
+// which declares it,
+// by searching the embedded fields breadth first, as the rules for
+// selectors do. If addressable is set, the methods of *F are available
+// from an embedded field of type F.
+func promotion(t reflect.Type, name string, addressable bool) (string, reflect.Type) {
+	type node struct {
+		t    reflect.Type
+		path []string
+	}
+	level := []node{{t: t}}
+	seen := make(map[reflect.Type]bool)
+	for len(level) > 0 {
+		var next []node
+		for _, n := range level {
+			st := n.t
+			if st.Kind() == reflect.Ptr {
+				st = st.Elem()
+			}
+			if st.Kind() != reflect.Struct || seen[st] {
+				continue
+			}
+			seen[st] = true
+			for i := 0; i < st.NumField(); i++ {
+				f := st.Field(i)
+				if !f.Anonymous {
+					continue
+				}
+				path := append(append([]string(nil), n.path...), f.Name)
+				addressable := addressable || f.Type.Kind() == reflect.Ptr
+				if hasMethod(f.Type, name, addressable) {
+					if declaredOn(f.Type, name) {
+						return strings.Join(path, "."), f.Type
+					}
+					// Promoted to f's type in turn.
+					via, from := promotion(f.Type, name, addressable)
+					return strings.Join(path, ".") + "." + via, from
+				}
+				next = append(next, node{f.Type, path})
+			}
+		}
+		level = next
+	}
+	return "", nil
+}
+
+// declaredOn reports whether the method name of t or *t is declared on
+// t or *t rather than promoted to it.
+func declaredOn(t reflect.Type, name string) bool {
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem() // the methods of *F are declared on F or *F
+	}
+	if m, ok := t.MethodByName(name); ok {
+		return !promoted(t, m, false)
+	}
+	if m, ok := reflect.PtrTo(t).MethodByName(name); ok {
+		return !promoted(t, m, true)
+	}
+	return false
+}
+
+// hasMethod reports whether type t, or if addressable *t, has a method
+// of the given name, whether declared or itself promoted.
+func hasMethod(t reflect.Type, name string, addressable bool) bool {
+	if _, ok := t.MethodByName(name); ok {
+		return true
+	}
+	if addressable && t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface {
+		_, ok := reflect.PtrTo(t).MethodByName(name)
+		return ok
+	}
+	return false
+}
+
+// String formats the report in the style of Print, noting promoted
+// methods and satisfied interfaces.
+func (r *Report) String() string {
+	var buf bytes.Buffer
+	for i, ms := range []MethodSet{r.Value, r.Pointer} {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, "type %s\n", ms.Receiver)
+		for _, m := range ms.Methods {
+			fmt.Fprintf(&buf, "func (%s) %s%s", ms.Receiver, m.Name,
+				strings.TrimPrefix(m.Type.String(), "func"))
+			if m.Via != "" {
+				fmt.Fprintf(&buf, " // promoted from %s (%s)", m.Via, m.From)
+			}
+			buf.WriteByte('\n')
+		}
+		for _, it := range ms.Implements {
+			fmt.Fprintf(&buf, "implements %s\n", it)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,129 @@
+package methods
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Point and ColoredPoint are as in gopl.io/ch6/coloredpoint.
+type Point struct{ X, Y float64 }
+
+func (p Point) Distance(q Point) float64    { return math.Hypot(q.X-p.X, q.Y-p.Y) }
+func (p *Point) ScaleBy(factor float64)     { p.X *= factor; p.Y *= factor }
+func (p Point) String() string              { return fmt.Sprintf("(%g, %g)", p.X, p.Y) }
+func (p *Point) Read(b []byte) (int, error) { return 0, io.EOF }
+
+type ColoredPoint struct {
+	Point
+	Color color.RGBA
+}
+
+// String shadows Point.String.
+func (c ColoredPoint) String() string { return c.Point.String() + " in color" }
+
+type Path struct {
+	*ColoredPoint
+	io.Writer
+	Label string
+}
+
+func (p Path) Len() int { return 0 }
+
+// Segment embeds a pointer, and its ScaleBy shadows (*Point).ScaleBy.
+type Segment struct {
+	*Point
+	End Point
+}
+
+func (s *Segment) ScaleBy(factor float64) { s.Point.ScaleBy(factor); s.End.ScaleBy(factor) }
+
+func ExampleDescribe() {
+	fmt.Print(Describe(ColoredPoint{}, (*fmt.Stringer)(nil), (*io.Reader)(nil)))
+	// Output:
+	// type methods.ColoredPoint
+	// func (methods.ColoredPoint) Distance(methods.Point) float64 // promoted from Point (methods.Point)
+	// func (methods.ColoredPoint) String() string
+	// implements fmt.Stringer
+	//
+	// type *methods.ColoredPoint
+	// func (*methods.ColoredPoint) Distance(methods.Point) float64 // promoted from Point (methods.Point)
+	// func (*methods.ColoredPoint) Read([]uint8) (int, error) // promoted from Point (methods.Point)
+	// func (*methods.ColoredPoint) ScaleBy(float64) // promoted from Point (methods.Point)
+	// func (*methods.ColoredPoint) String() string
+	// implements fmt.Stringer
+	// implements io.Reader
+}
+
+func TestDescribe(t *testing.T) {
+	ifaces := []interface{}{(*fmt.Stringer)(nil), (*io.Reader)(nil), (*io.Writer)(nil), (*sort.Interface)(nil)}
+	r := Describe(new(Path), ifaces...)
+	if r.Value.Receiver.String() != "methods.Path" {
+		t.Fatalf("receiver %s, want methods.Path", r.Value.Receiver)
+	}
+	var got []string
+	for _, m := range r.Value.Methods {
+		got = append(got, m.Name+":"+m.Via)
+	}
+	// Through the embedded pointer, even ScaleBy and Read are promoted
+	// to the value type.
+	want := "Distance:ColoredPoint.Point Len: Read:ColoredPoint.Point ScaleBy:ColoredPoint.Point String:ColoredPoint Write:Writer"
+	if strings.Join(got, " ") != want {
+		t.Errorf("methods of Path = %s,\nwant %s", got, want)
+	}
+	if len(r.Value.Implements) != 3 || len(r.Pointer.Implements) != 3 {
+		t.Errorf("Path implements %v, *Path implements %v; want Stringer, Reader and Writer", r.Value.Implements, r.Pointer.Implements)
+	}
+	if from := r.Value.Methods[0].From; from != reflect.TypeOf(Point{}) {
+		t.Errorf("Distance promoted from %v", from)
+	}
+	if from := r.Value.Methods[5].From; from.String() != "io.Writer" {
+		t.Errorf("Write promoted from %v", from)
+	}
+
+	// Methods declared on *T are not promoted.
+	r = Describe(&Point{})
+	for _, m := range r.Pointer.Methods {
+		if m.Via != "" {
+			t.Errorf("(*Point).%s reported as promoted via %s", m.Name, m.Via)
+		}
+	}
+	if len(r.Value.Methods) != 2 || len(r.Pointer.Methods) != 4 {
+		t.Errorf("Point has %d and *Point %d methods, want 2 and 4", len(r.Value.Methods), len(r.Pointer.Methods))
+	}
+
+	// A method declared on *T shadows one promoted through a pointer.
+	r = Describe(Segment{})
+	got = nil
+	for _, ms := range []MethodSet{r.Value, r.Pointer} {
+		for _, m := range ms.Methods {
+			got = append(got, m.Name+":"+m.Via)
+		}
+	}
+	want = "Distance:Point Read:Point String:Point Distance:Point Read:Point ScaleBy: String:Point"
+	if strings.Join(got, " ") != want {
+		t.Errorf("methods of Segment and *Segment = %s,\nwant %s", got, want)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, Describe(bytes.Buffer{}, (*io.Reader)(nil)))
+	if !strings.Contains(buf.String(), "type *bytes.Buffer\nfunc (*bytes.Buffer) Available() int\n") ||
+		!strings.HasSuffix(buf.String(), "implements io.Reader\n") {
+		t.Errorf("bytes.Buffer:\n%s", &buf)
+	}
+}
+
+func TestDescribePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a non-interface")
+		}
+	}()
+	Describe(1, io.EOF)
+}
@@ -0,0 +1,144 @@
+package params
+
+import (
+	"encoding"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A field is a struct field that holds a parameter.
+type field struct {
+	name      string // parameter name; dotted for fields of nested structs
+	index     []int  // path of field indices from the outermost struct
+	typ       reflect.Type
+	omitempty bool
+	rules     []rule // from the validate tag
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// fieldsOf returns the parameter fields of the struct type t.
+func fieldsOf(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	fs := appendFields(nil, t, "", nil, map[reflect.Type]bool{t: true})
+	fieldCache.Store(t, fs)
+	return fs
+}
+
+// appendFields appends to fs the fields of struct type t, whose names
+// begin with prefix and whose indices begin with index. Nested structs
+// contribute their fields, prefixed by the struct's name and a dot,
+// unless they are embedded, when their fields are promoted. A struct
+// type that contains itself, through a pointer, is visited only once
+// along each path, since otherwise the names would never end. Embedded
+// pointers to unexported struct types are skipped, as encoding/json
+// skips them, since the pointer could not be set.
+func appendFields(fs []field, t reflect.Type, prefix string, index []int, visiting map[reflect.Type]bool) []field {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue // unexported
+		}
+		tag := sf.Tag.Get("http")
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		idx := append(append([]int(nil), index...), i)
+
+		if st := nestedStruct(sf.Type); st != nil {
+			if visiting[st] {
+				continue
+			}
+			if sf.PkgPath != "" && sf.Type.Kind() == reflect.Ptr {
+				continue // a nil pointer that cannot be allocated
+			}
+			visiting[st] = true
+			p := prefix + name + "."
+			if sf.Anonymous && tag == "" {
+				p = prefix
+			}
+			fs = appendFields(fs, st, p, idx, visiting)
+			delete(visiting, st)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue // embedded unexported non-struct
+		}
+		f := field{
+			name:      prefix + name,
+			index:     idx,
+			typ:       sf.Type,
+			omitempty: opts == "omitempty",
+		}
+		if v, ok := sf.Tag.Lookup("validate"); ok {
+			rules, err := parseRules(v, sf.Type)
+			if err != nil {
+				panic(fmt.Sprintf("params: field %s.%s: %v", t, sf.Name, err))
+			}
+			f.rules = rules
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// nestedStruct returns the struct type of a field of type t whose
+// fields are parameters in their own right, or nil if t is not such a
+// struct or pointer to one.
+func nestedStruct(t reflect.Type) reflect.Type {
+	if t == fileHeaderType {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || isText(t) {
+		return nil
+	}
+	return t
+}
+
+// isText reports whether values of type t, or pointers to them, parse
+// themselves from text.
+func isText(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// lookup returns the field of v at index, allocating any nil struct
+// pointers along the way if alloc is set. If it meets a nil pointer
+// and alloc is not set, it returns the invalid Value.
+func lookup(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,264 @@
+package params
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// A Parameter describes one query parameter in OpenAPI 3 form.
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"` // always "query"
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// A Schema is the OpenAPI 3 schema of a parameter's value.
+type Schema struct {
+	Type      string      `json:"type"`
+	Format    string      `json:"format,omitempty"`
+	Items     *Schema     `json:"items,omitempty"`
+	Default   interface{} `json:"default,omitempty"`
+	Minimum   *float64    `json:"minimum,omitempty"`
+	Maximum   *float64    `json:"maximum,omitempty"`
+	MinLength *int        `json:"minLength,omitempty"`
+	MaxLength *int        `json:"maxLength,omitempty"`
+	MinItems  *int        `json:"minItems,omitempty"`
+	MaxItems  *int        `json:"maxItems,omitempty"`
+	Enum      []string    `json:"enum,omitempty"`
+}
+
+// Parameters describes the parameters that Unpack reads into the
+// struct pointed to by ptr: their names and types, whether each may be
+// repeated, the constraints of their validate tags, and, as defaults,
+// the non-zero values of ptr's fields. File fields are left out.
+func Parameters(ptr interface{}) ([]Parameter, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params: Parameters of %T, want pointer to struct", ptr)
+	}
+
+	var params []Parameter
+	for _, f := range fieldsOf(v.Type()) {
+		if f.typ == fileHeaderType || f.typ == reflect.SliceOf(fileHeaderType) {
+			continue
+		}
+		s, err := schema(f.typ)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		if fv := lookup(v, f.index, false); fv.IsValid() && !fv.IsZero() {
+			if s.Default, err = jsonValue(fv); err != nil {
+				return nil, fmt.Errorf("%s: %v", f.name, err)
+			}
+		}
+		p := Parameter{Name: f.name, In: "query", Schema: s}
+		for _, r := range f.rules {
+			p.Required = p.Required || r.name == "required"
+			constrain(s, f.typ, r)
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
+
+// schema returns the schema of a parameter of type t, without
+// constraints or default.
+func schema(t reflect.Type) (*Schema, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case t == durationType:
+		return &Schema{Type: "string", Format: "duration"}, nil
+	case isText(t):
+		return &Schema{Type: "string"}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Complex64, reflect.Complex128:
+		return &Schema{Type: "string"}, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t.Bits() <= 32 {
+			return &Schema{Type: "integer", Format: "int32"}, nil
+		}
+		return &Schema{Type: "integer", Format: "int64"}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		zero := 0.0
+		return &Schema{Type: "integer", Minimum: &zero}, nil
+
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}, nil
+
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}, nil
+
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+
+	case reflect.Slice:
+		items, err := schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "array", Items: items}, nil
+	}
+	return nil, fmt.Errorf("unsupported kind %s", t)
+}
+
+// constrain adds the constraint of rule r on a field of type t to s.
+// Bounds on durations have no OpenAPI form and are left out.
+func constrain(s *Schema, t reflect.Type, r rule) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch r.name {
+	case "min", "max":
+		bound := r.bound
+		n := int(bound)
+		switch {
+		case t == durationType:
+		case s.Type == "array":
+			if r.name == "min" {
+				s.MinItems = &n
+			} else {
+				s.MaxItems = &n
+			}
+		case s.Type == "string" && t.Kind() == reflect.String:
+			if r.name == "min" {
+				s.MinLength = &n
+			} else {
+				s.MaxLength = &n
+			}
+		case s.Type == "integer" || s.Type == "number":
+			if r.name == "min" {
+				s.Minimum = &bound
+			} else {
+				s.Maximum = &bound
+			}
+		}
+	case "email":
+		if s.Items != nil {
+			s = s.Items
+		}
+		s.Format = "email"
+	case "oneof":
+		if s.Items != nil {
+			s = s.Items
+		}
+		s.Enum = r.words
+	}
+}
+
+// jsonValue returns the default value v in the form that the schema's
+// type calls for.
+func jsonValue(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice && !isText(v.Type()) {
+		elems := make([]interface{}, v.Len())
+		for i := range elems {
+			x, err := jsonValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = x
+		}
+		return elems, nil
+	}
+	if v.Type() != durationType && !isText(v.Type()) {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return v.Int(), nil
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return v.Uint(), nil
+		case reflect.Float32, reflect.Float64:
+			return v.Float(), nil
+		case reflect.Bool:
+			return v.Bool(), nil
+		}
+	}
+	return format(v)
+}
+
+// An api is a set of operations, each described by its parameters.
+type api struct {
+	title, version string
+	once           sync.Once
+	mu             sync.Mutex
+	ops            map[string][]Parameter // keyed by pattern
+}
+
+var defaultAPI = &api{title: filepath.Base(os.Args[0]), version: "0.0.0"}
+
+// HandleFunc registers handler for pattern in http.DefaultServeMux, as
+// http.HandleFunc does, and describes it in the OpenAPI 3 document
+// served at /openapi.json, which the first call registers. ptr points
+// to a struct of the type into which handler unpacks its parameters,
+// holding their defaults. The operation is described as a GET.
+//
+// HandleFunc panics if Parameters fails for ptr.
+func HandleFunc(pattern string, ptr interface{}, handler func(http.ResponseWriter, *http.Request)) {
+	defaultAPI.handleFunc(http.DefaultServeMux, pattern, ptr, handler)
+}
+
+func (a *api) handleFunc(mux *http.ServeMux, pattern string, ptr interface{}, handler func(http.ResponseWriter, *http.Request)) {
+	params, err := Parameters(ptr)
+	if err != nil {
+		panic(fmt.Sprintf("params: HandleFunc %s: %v", pattern, err))
+	}
+	a.once.Do(func() { mux.HandleFunc("/openapi.json", a.serve) })
+	mux.HandleFunc(pattern, handler)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ops == nil {
+		a.ops = make(map[string][]Parameter)
+	}
+	a.ops[pattern] = params
+}
+
+// serve writes the OpenAPI document of a.
+func (a *api) serve(w http.ResponseWriter, req *http.Request) {
+	type operation struct {
+		Parameters []Parameter                  `json:"parameters"`
+		Responses  map[string]map[string]string `json:"responses"`
+	}
+	a.mu.Lock()
+	paths := make(map[string]map[string]operation, len(a.ops))
+	for pattern, params := range a.ops {
+		paths[pattern] = map[string]operation{"get": {
+			Parameters: params,
+			Responses: map[string]map[string]string{
+				"200": {"description": "OK"},
+				"400": {"description": "invalid parameters"},
+			},
+		}}
+	}
+	a.mu.Unlock()
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": a.title, "version": a.version},
+		"paths":   paths,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,109 @@
+package params
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Pack returns the URL parameters that Unpack would read into the
+// struct pointed to by ptr, using the same names. A slice becomes one
+// value per element, and nil pointers, and the fields of nil nested
+// struct pointers, are left out, as are zero values of fields whose
+// http tag has the omitempty option, such as `http:"max,omitempty"`.
+// Unpacking the result into a zero struct of the same type yields a
+// struct equal to the original, except that empty slices become nil
+// and times keep only their instant and offset.
+//
+// File fields are skipped, since files cannot be sent as parameters.
+func Pack(ptr interface{}) (url.Values, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("params: Pack of %T, want pointer to struct", ptr)
+	}
+
+	values := make(url.Values)
+	for _, f := range fieldsOf(v.Type()) {
+		if f.typ == fileHeaderType || f.typ == reflect.SliceOf(fileHeaderType) {
+			continue
+		}
+		fv := lookup(v, f.index, false)
+		if !fv.IsValid() || f.omitempty && fv.IsZero() {
+			continue
+		}
+		if fv.Kind() == reflect.Slice && !isText(fv.Type()) {
+			for i := 0; i < fv.Len(); i++ {
+				s, err := format(fv.Index(i))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", f.name, err)
+				}
+				values.Add(f.name, s)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Ptr && fv.IsNil() {
+			continue
+		}
+		s, err := format(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		values.Add(f.name, s)
+	}
+	return values, nil
+}
+
+// format is the inverse of populate.
+func format(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", fmt.Errorf("nil %s", v.Type())
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String(), nil
+	}
+	if isText(v.Type()) {
+		if !v.CanAddr() {
+			p := reflect.New(v.Type())
+			p.Elem().Set(v)
+			v = p.Elem()
+		}
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			text, err := m.MarshalText()
+			return string(text), err
+		}
+		return "", fmt.Errorf("%s implements encoding.TextUnmarshaler but not TextMarshaler", v.Type())
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+
+	case reflect.Complex64, reflect.Complex128:
+		return strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits()), nil
+
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	}
+	return "", fmt.Errorf("unsupported kind %s", v.Type())
+}
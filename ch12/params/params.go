@@ -7,73 +7,200 @@
 package params
 
 import (
+	"encoding"
+	"encoding/json"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strconv"
-	"strings"
+	"time"
 )
 
 //!+Unpack
 
 // Unpack populates the fields of the struct pointed to by ptr
 // from the HTTP request parameters in req.
+//
+// The parameters come from the URL's query and from the body, which
+// is parsed according to its Content-Type: as a form, as a multipart
+// form, whose files bind to fields of type *multipart.FileHeader or
+// []*multipart.FileHeader, or as a JSON object, whose nested objects
+// supply the parameters of nested structs and whose arrays supply
+// repeated values.
+//
+// If any parameter cannot be parsed or fails validation, Unpack
+// returns an Errors that lists every such problem.
 func Unpack(req *http.Request, ptr interface{}) error {
-	if err := req.ParseForm(); err != nil {
+	values, files, err := requestValues(req)
+	if err != nil {
 		return err
 	}
+	return unpack(values, files, ptr)
+}
+
+//!-Unpack
+
+// UnpackValues is like Unpack but takes the parameters from values.
+//
+// A field's parameter name is given by its http tag, or else is its
+// name in lower case; a tag of "-" excludes the field. The fields of a
+// nested struct, or pointer to one, are named by the struct's name, a
+// dot and their own name, as in "addr.city", unless the struct is
+// embedded without a tag, in which case their names are promoted.
+// A slice field collects every value of its parameter; any other field
+// takes the last.
+//
+// A field may be a string, bool, or number of any kind, a time.Duration,
+// a pointer to any of these, or any type whose pointer implements
+// encoding.TextUnmarshaler, such as time.Time. A time.Time may also be
+// given as a date alone, such as 2006-01-02.
+//
+// A validate tag holds a comma-separated list of rules:
+//
+//	required	the parameter must be present
+//	min=n, max=n	bounds on a number or duration, on the length of a
+//			string in characters, or on the number of values
+//	email		each value must be a bare email address
+//	oneof=a b c	each value must be one of those listed
+//
+// Rules other than required apply only to parameters that are present.
+// A field whose validate tag is malformed causes a panic.
+func UnpackValues(values url.Values, ptr interface{}) error {
+	return unpack(values, nil, ptr)
+}
 
-	// Build map of fields keyed by effective name.
-	fields := make(map[string]reflect.Value)
-	v := reflect.ValueOf(ptr).Elem() // the struct variable
-	for i := 0; i < v.NumField(); i++ {
-		fieldInfo := v.Type().Field(i) // a reflect.StructField
-		tag := fieldInfo.Tag           // a reflect.StructTag
-		name := tag.Get("http")
-		if name == "" {
-			name = strings.ToLower(fieldInfo.Name)
-		}
-		fields[name] = v.Field(i)
+func unpack(values url.Values, files map[string][]*multipart.FileHeader, ptr interface{}) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("params: Unpack of %T, want pointer to struct", ptr)
 	}
+	v = v.Elem() // the struct variable
 
-	// Update struct field for each parameter in the request.
-	for name, values := range req.Form {
-		f := fields[name]
-		if !f.IsValid() {
-			continue // ignore unrecognized HTTP parameters
-		}
-		for _, value := range values {
-			if f.Kind() == reflect.Slice {
-				elem := reflect.New(f.Type().Elem()).Elem()
-				if err := populate(elem, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
-				}
-				f.Set(reflect.Append(f, elem))
-			} else {
-				if err := populate(f, value); err != nil {
-					return fmt.Errorf("%s: %v", name, err)
+	// Bind every parameter before validating any, so that a parameter
+	// of a nested struct pointer brings its struct, and with it the
+	// struct's rules, into being whatever the order of its fields.
+	fields := fieldsOf(v.Type())
+	raw := make([][]string, len(fields))
+	parseErrs := make([][]*FieldError, len(fields))
+	for i := range fields {
+		f := &fields[i]
+		if f.typ == fileHeaderType || f.typ == reflect.SliceOf(fileHeaderType) {
+			fhs := files[f.name]
+			if len(fhs) > 0 {
+				fv := lookup(v, f.index, true)
+				if f.typ == fileHeaderType {
+					fv.Set(reflect.ValueOf(fhs[len(fhs)-1]))
+				} else {
+					fv.Set(reflect.AppendSlice(fv, reflect.ValueOf(fhs)))
 				}
 			}
+			for _, fh := range fhs {
+				raw[i] = append(raw[i], fh.Filename)
+			}
+			continue
 		}
+		raw[i] = values[f.name]
+		if len(raw[i]) == 0 {
+			continue
+		}
+		fv := lookup(v, f.index, true)
+		for _, value := range raw[i] {
+			if err := set(fv, value); err != nil {
+				parseErrs[i] = append(parseErrs[i], &FieldError{Param: f.name, Value: value, Err: err})
+			}
+		}
+	}
+	var errs Errors
+	for i := range fields {
+		f := &fields[i]
+		errs = append(errs, parseErrs[i]...)
+		if parseErrs[i] != nil || len(f.rules) == 0 {
+			continue
+		}
+		fv := lookup(v, f.index, false)
+		if !fv.IsValid() {
+			continue // within an absent nested struct
+		}
+		errs = append(errs, validate(f, fv, raw[i])...)
+	}
+	if len(errs) > 0 {
+		return errs
 	}
 	return nil
 }
 
-//!-Unpack
+// set sets v from value, or appends it if v is a slice.
+func set(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Slice && !isText(v.Type()) {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := populate(elem, value); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+		return nil
+	}
+	return populate(v, value)
+}
 
 //!+populate
 func populate(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return populate(v.Elem(), value)
+	}
+	if v.Type() == timeType {
+		return parseTime(v, value)
+	}
+	if isText(v.Type()) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
 	switch v.Kind() {
 	case reflect.String:
 		v.SetString(value)
 
-	case reflect.Int:
-		i, err := strconv.ParseInt(value, 10, 64)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
 		if err != nil {
 			return err
 		}
 		v.SetInt(i)
 
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.Complex64, reflect.Complex128:
+		c, err := strconv.ParseComplex(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetComplex(c)
+
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
@@ -88,3 +215,86 @@ func populate(v reflect.Value, value string) error {
 }
 
 //!-populate
+
+// parseTime sets the time.Time v from value, in RFC 3339 format or, as
+// an HTML date input sends it, as a date alone.
+func parseTime(v reflect.Value, value string) error {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		var err2 error
+		if t, err2 = time.Parse("2006-01-02", value); err2 != nil {
+			return err
+		}
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+const (
+	maxMemory   = 32 << 20 // of a multipart form, beyond which files go to disk
+	maxJSONSize = 10 << 20 // the limit net/http places on a form
+)
+
+// requestValues returns the parameters of req, from its URL and body,
+// and the files of a multipart form.
+func requestValues(req *http.Request) (url.Values, map[string][]*multipart.FileHeader, error) {
+	ct, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch ct {
+	case "multipart/form-data":
+		if err := req.ParseMultipartForm(maxMemory); err != nil {
+			return nil, nil, err
+		}
+		return req.Form, req.MultipartForm.File, nil
+
+	case "application/json":
+		values := req.URL.Query()
+		if req.Body == nil {
+			return values, nil, nil
+		}
+		dec := json.NewDecoder(io.LimitReader(req.Body, maxJSONSize))
+		dec.UseNumber()
+		var body interface{}
+		if err := dec.Decode(&body); err == io.EOF {
+			return values, nil, nil
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("params: decoding JSON body: %v", err)
+		}
+		obj, ok := body.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("params: JSON body is not an object")
+		}
+		flatten(values, "", obj)
+		return values, nil, nil
+
+	default:
+		if err := req.ParseForm(); err != nil {
+			return nil, nil, err
+		}
+		return req.Form, nil, nil
+	}
+}
+
+// flatten adds to values the parameters of the decoded JSON value x,
+// naming the members of objects by dotted paths and giving each element
+// of an array as a separate value. Nulls are omitted.
+func flatten(values url.Values, name string, x interface{}) {
+	switch x := x.(type) {
+	case map[string]interface{}:
+		for k, elem := range x {
+			if name != "" {
+				k = name + "." + k
+			}
+			flatten(values, k, elem)
+		}
+	case []interface{}:
+		for _, elem := range x {
+			flatten(values, name, elem)
+		}
+	case string:
+		values.Add(name, x)
+	case json.Number:
+		values.Add(name, x.String())
+	case bool:
+		values.Add(name, strconv.FormatBool(x))
+	}
+}
@@ -0,0 +1,343 @@
+package params
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `validate:"required"`
+	Zip  string `http:"postcode"`
+}
+
+type Paging struct {
+	Page  uint16 `validate:"min=1"`
+	Limit int8   `validate:"max=100"`
+}
+
+type order struct {
+	Paging
+	Name     string        `validate:"required,max=5"`
+	Email    string        `validate:"email"`
+	Qty      int32         `http:"n" validate:"min=1,max=10"`
+	Price    float32       `http:"price"`
+	Ratio    complex64     `http:"z"`
+	Tags     []string      `http:"tag" validate:"max=2,oneof=a b c"`
+	IDs      []uint64      `http:"id"`
+	Timeout  time.Duration `validate:"max=1m"`
+	Due      time.Time
+	Note     *string
+	Addr     address
+	Ship     *address
+	IP       net.IP
+	Internal string `http:"-"`
+}
+
+func TestUnpackValues(t *testing.T) {
+	q, err := url.ParseQuery("name=ann&email=ann@example.com&n=3&price=1.5&z=1%2B2i" +
+		"&tag=a&tag=b&id=1&id=18446744073709551615&timeout=30s&due=2016-10-26" +
+		"&note=hi&addr.city=Rome&addr.postcode=00100&ip=10.0.0.1&page=2&limit=-5&internal=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got order
+	if err := UnpackValues(q, &got); err != nil {
+		t.Fatal(err)
+	}
+	note := "hi"
+	want := order{
+		Paging:  Paging{Page: 2, Limit: -5},
+		Name:    "ann",
+		Email:   "ann@example.com",
+		Qty:     3,
+		Price:   1.5,
+		Ratio:   1 + 2i,
+		Tags:    []string{"a", "b"},
+		IDs:     []uint64{1, 1<<64 - 1},
+		Timeout: 30 * time.Second,
+		Due:     time.Date(2016, 10, 26, 0, 0, 0, 0, time.UTC),
+		Note:    &note,
+		Addr:    address{City: "Rome", Zip: "00100"},
+		IP:      net.ParseIP("10.0.0.1"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	q, _ := url.ParseQuery("email=ann&n=11&price=cheap&tag=a&tag=d&tag=b" +
+		"&timeout=2m&limit=300&ship.postcode=1")
+	var o order
+	err := UnpackValues(q, &o)
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("error %v (%T), want Errors", err, err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Param+"/"+e.Rule)
+	}
+	want := []string{
+		"limit/",        // out of range for int8
+		"name/required", // absent
+		"email/email",   // not an address
+		"n/max",         // 11 > 10
+		"price/",        // not a number
+		"tag/max",       // 3 values
+		"tag/oneof",     // d
+		"timeout/max",   // 2m > 1m
+		"addr.city/required",
+		"ship.city/required", // ship was given, so its city is required
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("errors %q,\nwant %q", got, want)
+	}
+	if e := errs[0]; !errors.Is(e, strconv.ErrRange) || e.Value != "300" {
+		t.Errorf("errs[0] = %#v", e)
+	}
+	if msg := errs[7].Error(); msg != "timeout: must be at most 1m0s" {
+		t.Errorf("timeout error %q", msg)
+	}
+
+	// A single parse error reads as it did before validation.
+	var data struct{ Max int }
+	err = UnpackValues(url.Values{"max": {"lots"}}, &data)
+	if want := `max: strconv.ParseInt: parsing "lots": invalid syntax`; err == nil || err.Error() != want {
+		t.Errorf("error %v, want %s", err, want)
+	}
+
+	if err := UnpackValues(nil, data); err == nil {
+		t.Error("no error unpacking into a non-pointer")
+	}
+}
+
+// Embedded pointers to unexported structs cannot be allocated, so their
+// fields are not parameters.
+func TestUnexportedEmbedded(t *testing.T) {
+	type inner struct{ X int }
+	type outer struct{ Z int }
+	var data struct {
+		*inner
+		outer
+		Y int
+	}
+	err := UnpackValues(url.Values{"x": {"1"}, "y": {"2"}, "z": {"3"}}, &data)
+	if err != nil || data.inner != nil || data.Y != 2 || data.Z != 3 {
+		t.Errorf("got %+v, %v; want Y=2, Z=3, nil inner", data, err)
+	}
+}
+
+func TestBadTag(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for malformed validate tag")
+		}
+	}()
+	var data struct {
+		N int `validate:"min=one"`
+	}
+	UnpackValues(nil, &data)
+}
+
+func TestJSON(t *testing.T) {
+	body := `{"name":"bob","n":4,"tag":["a","c"],"addr":{"city":"Oslo","postcode":null},"page":1,"ship":null}`
+	req := httptest.NewRequest("POST", "/order?email=bob@example.com", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	var got order
+	if err := Unpack(req, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := order{
+		Paging: Paging{Page: 1},
+		Name:   "bob",
+		Email:  "bob@example.com",
+		Qty:    4,
+		Tags:   []string{"a", "c"},
+		Addr:   address{City: "Oslo"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	req = httptest.NewRequest("POST", "/order", strings.NewReader(`["bob"]`))
+	req.Header.Set("Content-Type", "application/json")
+	if err := Unpack(req, &got); err == nil {
+		t.Error("no error for a JSON array body")
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("title", "holiday")
+	for _, name := range []string{"a.jpg", "b.jpg"} {
+		fw, _ := w.CreateFormFile("photo", name)
+		fw.Write([]byte("JPEG"))
+	}
+	w.Close()
+	req := httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	var data struct {
+		Title  string
+		Photos []*multipart.FileHeader `http:"photo" validate:"required,max=3"`
+		Cover  *multipart.FileHeader   `validate:"required"`
+	}
+	err := Unpack(req, &data)
+	if err == nil || err.Error() != "cover: required" {
+		t.Errorf("error %v, want cover: required", err)
+	}
+	if data.Title != "holiday" || len(data.Photos) != 2 || data.Photos[1].Filename != "b.jpg" {
+		t.Errorf("got %+v", data)
+	}
+}
+
+func TestForm(t *testing.T) {
+	req := httptest.NewRequest("POST", "/search?l=go", strings.NewReader("l=reflect&max=5"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var data struct {
+		Labels     []string `http:"l"`
+		MaxResults int      `http:"max"`
+	}
+	if err := Unpack(req, &data); err != nil {
+		t.Fatal(err)
+	}
+	// The body's values precede the URL's.
+	if got := strings.Join(data.Labels, " "); got != "reflect go" || data.MaxResults != 5 {
+		t.Errorf("got %+v", data)
+	}
+}
+
+func TestPack(t *testing.T) {
+	note := "hi"
+	in := order{
+		Paging:  Paging{Page: 2},
+		Name:    "a&b=c",
+		Email:   "ann+x@example.com",
+		Qty:     3,
+		Price:   0.1,
+		Ratio:   1 - 2.5i,
+		Tags:    []string{"c", "c"},
+		IDs:     []uint64{1<<64 - 1},
+		Timeout: 1500 * time.Millisecond,
+		Due:     time.Date(2016, 10, 26, 9, 30, 0, 1, time.UTC),
+		Note:    &note,
+		Ship:    &address{City: "Rome"},
+		IP:      net.ParseIP("::1"),
+	}
+	q, err := Pack(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := q["addr.city"]; !ok {
+		t.Errorf("Pack omitted zero field addr.city: %v", q)
+	}
+	var out order
+	if err := UnpackValues(q, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip through %s:\ngot  %+v\nwant %+v", q.Encode(), out, in)
+	}
+
+	var opt struct {
+		Labels []string `http:"l,omitempty"`
+		Max    int      `http:"max,omitempty"`
+		Exact  bool     `http:"x"`
+		Addr   *address
+		Skip   map[string]int `http:"-"`
+	}
+	if q, err := Pack(opt); err != nil || q.Encode() != "x=false" {
+		t.Errorf("Pack(zero) = %s, %v; want x=false", q.Encode(), err)
+	}
+	var bad struct{ M map[string]int }
+	if _, err := Pack(&bad); err == nil {
+		t.Error("no error packing a map")
+	}
+}
+
+// A client of the search handler in gopl.io/ch12/search builds its
+// request from the same struct that the handler unpacks.
+func ExamplePack() {
+	type search struct {
+		Labels     []string `http:"l"`
+		MaxResults int      `http:"max,omitempty"`
+		Exact      bool     `http:"x,omitempty"`
+	}
+	q, _ := Pack(&search{Labels: []string{"golang", "programming"}, MaxResults: 100})
+	u := url.URL{Scheme: "http", Host: "localhost:12345", Path: "/search", RawQuery: q.Encode()}
+	fmt.Println(u.String())
+	// Output:
+	// http://localhost:12345/search?l=golang&l=programming&max=100
+}
+
+func TestParameters(t *testing.T) {
+	in := order{Name: "x", Tags: []string{"a"}, Timeout: time.Second, Paging: Paging{Limit: 20}}
+	params, err := Parameters(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, p := range params {
+		b, _ := json.Marshal(p)
+		got[p.Name] = string(b)
+	}
+	for name, want := range map[string]string{
+		"page":      `{"name":"page","in":"query","schema":{"type":"integer","minimum":1}}`,
+		"limit":     `{"name":"limit","in":"query","schema":{"type":"integer","format":"int32","default":20,"maximum":100}}`,
+		"name":      `{"name":"name","in":"query","required":true,"schema":{"type":"string","default":"x","maxLength":5}}`,
+		"email":     `{"name":"email","in":"query","schema":{"type":"string","format":"email"}}`,
+		"tag":       `{"name":"tag","in":"query","schema":{"type":"array","items":{"type":"string","enum":["a","b","c"]},"default":["a"],"maxItems":2}}`,
+		"timeout":   `{"name":"timeout","in":"query","schema":{"type":"string","format":"duration","default":"1s"}}`,
+		"due":       `{"name":"due","in":"query","schema":{"type":"string","format":"date-time"}}`,
+		"ship.city": `{"name":"ship.city","in":"query","required":true,"schema":{"type":"string"}}`,
+	} {
+		if got[name] != want {
+			t.Errorf("%s:\ngot  %s\nwant %s", name, got[name], want)
+		}
+	}
+	if len(params) != 17 {
+		t.Errorf("%d parameters, want 17", len(params))
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	a := &api{title: "test", version: "1"}
+	mux := http.NewServeMux()
+	search := struct {
+		Labels     []string `http:"l"`
+		MaxResults int      `http:"max"`
+	}{MaxResults: 10}
+	a.handleFunc(mux, "/search", &search, func(http.ResponseWriter, *http.Request) {})
+	a.handleFunc(mux, "/order", &order{}, func(http.ResponseWriter, *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc struct {
+		OpenAPI string
+		Paths   map[string]map[string]struct{ Parameters []Parameter }
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths) != 2 {
+		t.Fatalf("document %s", rec.Body)
+	}
+	ps := doc.Paths["/search"]["get"].Parameters
+	if len(ps) != 2 || ps[0].Schema.Type != "array" || ps[1].Schema.Default != 10.0 {
+		t.Errorf("/search parameters %+v", ps)
+	}
+}
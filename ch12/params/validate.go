@@ -0,0 +1,176 @@
+package params
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A rule is one constraint of a validate tag.
+type rule struct {
+	name  string   // required, min, max, email or oneof
+	bound float64  // min, max
+	words []string // oneof
+}
+
+// parseRules parses a validate tag such as "required,min=1,max=100"
+// for a field of type t.
+func parseRules(tag string, t reflect.Type) ([]rule, error) {
+	var rules []rule
+	for _, r := range strings.Split(tag, ",") {
+		name, arg := r, ""
+		if i := strings.IndexByte(r, '='); i >= 0 {
+			name, arg = r[:i], r[i+1:]
+		}
+		switch name {
+		case "required", "email":
+			if arg != "" {
+				return nil, fmt.Errorf("validate rule %s takes no argument", name)
+			}
+			rules = append(rules, rule{name: name})
+		case "min", "max":
+			bound, err := parseBound(arg, t)
+			if err != nil {
+				return nil, fmt.Errorf("validate rule %s: %v", r, err)
+			}
+			rules = append(rules, rule{name: name, bound: bound})
+		case "oneof":
+			words := strings.Fields(arg)
+			if len(words) == 0 {
+				return nil, fmt.Errorf("validate rule oneof needs a list of values")
+			}
+			rules = append(rules, rule{name: name, words: words})
+		default:
+			return nil, fmt.Errorf("unknown validate rule %q", r)
+		}
+	}
+	return rules, nil
+}
+
+// parseBound parses the bound of a min or max rule. For a duration it
+// is a duration, such as 1m30s.
+func parseBound(arg string, t reflect.Type) (float64, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		d, err := time.ParseDuration(arg)
+		return float64(d), err
+	}
+	return strconv.ParseFloat(arg, 64)
+}
+
+// validate checks the value v of field f, whose parameter values were
+// values, against f's rules. Rules other than required apply only to
+// parameters that are present, so that a default need not obey them.
+func validate(f *field, v reflect.Value, values []string) []*FieldError {
+	var errs []*FieldError
+	fail := func(r rule, value, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{
+			Param: f.name,
+			Value: value,
+			Rule:  r.name,
+			Err:   fmt.Errorf(format, args...),
+		})
+	}
+	for _, r := range f.rules {
+		if len(values) == 0 {
+			if r.name == "required" {
+				fail(r, "", "required")
+			}
+			continue
+		}
+		switch r.name {
+		case "min", "max":
+			n, unit, ok := measure(v)
+			if !ok {
+				continue
+			}
+			if r.name == "min" && n < r.bound {
+				fail(r, strings.Join(values, ","), "must be at least %s%s", formatBound(f.typ, r.bound), unit)
+			} else if r.name == "max" && n > r.bound {
+				fail(r, strings.Join(values, ","), "must be at most %s%s", formatBound(f.typ, r.bound), unit)
+			}
+		case "email":
+			for _, s := range values {
+				if a, err := mail.ParseAddress(s); err != nil || a.Address != s {
+					fail(r, s, "invalid email address %q", s)
+				}
+			}
+		case "oneof":
+		values:
+			for _, s := range values {
+				for _, w := range r.words {
+					if s == w {
+						continue values
+					}
+				}
+				fail(r, s, "must be one of %s", strings.Join(r.words, ", "))
+			}
+		}
+	}
+	return errs
+}
+
+// measure returns the quantity that min and max rules limit: the value
+// of a number, the length of a string in characters, or the length of
+// a slice, with the unit in which to report it.
+func measure(v reflect.Value) (n float64, unit string, ok bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, "", false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), " characters", true
+	case reflect.Slice:
+		return float64(v.Len()), " values", true
+	}
+	return 0, "", false
+}
+
+func formatBound(t reflect.Type, bound float64) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return time.Duration(bound).String()
+	}
+	return strconv.FormatFloat(bound, 'g', -1, 64)
+}
+
+// A FieldError reports a parameter that could not be parsed or that
+// failed validation.
+type FieldError struct {
+	Param string // parameter name, such as "addr.city"
+	Value string // the offending value, if any
+	Rule  string // the validate rule that failed, or "" for a parse error
+	Err   error
+}
+
+func (e *FieldError) Error() string { return e.Param + ": " + e.Err.Error() }
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// Errors is the list of all the FieldErrors found by Unpack, in the
+// order of the struct's fields.
+type Errors []*FieldError
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
@@ -26,8 +26,8 @@ func TestBzip2(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	// Check the size of the compressed stream.
-	if got, want := compressed.Len(), 255; got != want {
+	// Check the size of the compressed stream, which is libbz2's.
+	if got, want := compressed.Len(), 255; got != want && !bzip.PureGo {
 		t.Errorf("1 million hellos compressed to %d bytes, want %d", got, want)
 	}
 
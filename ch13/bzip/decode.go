@@ -0,0 +1,415 @@
+package bzip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrFormat is returned, perhaps wrapped, by a reader whose input
+	// is not a valid bzip2 stream.
+	ErrFormat = errors.New("bzip: invalid format")
+
+	// ErrChecksum is returned by a reader whose input decompresses to
+	// data that does not match the CRC recorded with it.
+	ErrChecksum = errors.New("bzip: checksum mismatch")
+)
+
+func corrupt(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrFormat, fmt.Sprintf(format, args...))
+}
+
+type goReader struct {
+	br        *bitReader
+	blockSize int    // largest block of the current stream
+	crc       uint32 // combined CRC of the blocks read so far
+	inStream  bool   // within a stream, between header and trailer
+	streams   int    // streams begun
+	err       error
+	closed    bool
+
+	// The current block.
+	tt       []uint32 // inverse BWT: byte in the low 8 bits, next index above
+	tPos     uint32   // index in tt of the next byte
+	left     int      // bytes of tt not yet read
+	wantCRC  uint32
+	blockCRC uint32
+
+	// Undoing rle1.
+	last    byte // the last byte read from tt
+	run     int  // how many times in a row it has occurred
+	repeats int  // copies of last still to be output
+}
+
+// newGoReader returns a reader for bzip2-compressed streams that is
+// written entirely in Go. Like bzip2, it reads a concatenation of
+// streams as one.
+func newGoReader(in io.Reader) io.ReadCloser {
+	return &goReader{br: newBitReader(in)}
+}
+
+func (r *goReader) Read(p []byte) (int, error) {
+	if r.closed {
+		panic("closed")
+	}
+	n := 0
+	for n < len(p) && r.err == nil {
+		if r.repeats > 0 {
+			p[n] = r.last
+			r.blockCRC = updateCRC(r.blockCRC, r.last)
+			r.repeats--
+			n++
+			continue
+		}
+		if r.left == 0 {
+			r.err = r.nextBlock()
+			continue
+		}
+		v := r.tt[r.tPos]
+		b := byte(v)
+		r.tPos = v >> 8
+		r.left--
+		if r.run == 4 {
+			r.repeats, r.run = int(b), 0
+			continue
+		}
+		if b == r.last && r.run > 0 {
+			r.run++
+		} else {
+			r.last, r.run = b, 1
+		}
+		p[n] = b
+		r.blockCRC = updateCRC(r.blockCRC, b)
+		n++
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, r.err
+}
+
+// Close releases the decompressor. It does not close the underlying
+// io.Reader.
+func (r *goReader) Close() error {
+	if r.closed {
+		panic("closed")
+	}
+	r.closed = true
+	r.tt = nil
+	return nil
+}
+
+// nextBlock checks the CRC of the block just read, if any, then reads
+// the next one, first reading the header of the next stream, or the
+// trailer of the current one, as needed. It returns io.EOF at the end
+// of the last stream.
+func (r *goReader) nextBlock() error {
+	if r.tt != nil {
+		if ^r.blockCRC != r.wantCRC {
+			return ErrChecksum
+		}
+		r.crc = r.crc<<1 | r.crc>>31 ^ r.wantCRC
+		r.tt = r.tt[:0]
+	}
+	br := r.br
+	for {
+		if !r.inStream {
+			if err := r.readHeader(); err != nil {
+				return err
+			}
+		}
+		magic := br.readBits(48)
+		switch {
+		case br.err != nil:
+			return br.err
+		case magic == blockMagic:
+			return r.readBlock()
+		case magic != endMagic:
+			return corrupt("bad block magic %#x", magic)
+		}
+		want := uint32(br.readBits(32))
+		if br.err != nil {
+			return br.err
+		}
+		if want != r.crc {
+			return ErrChecksum
+		}
+		br.align()
+		r.inStream = false
+	}
+}
+
+// readHeader reads the header of a stream, or returns io.EOF if the
+// input is at its end after the trailer of another.
+func (r *goReader) readHeader() error {
+	br := r.br
+	if r.streams > 0 && br.atEOF() {
+		return io.EOF
+	}
+	magic := br.readBits(24)
+	level := int(br.readBits(8)) - '0'
+	if br.err != nil {
+		return br.err
+	}
+	if magic != 'B'<<16|'Z'<<8|'h' || level < 1 || level > 9 {
+		return corrupt("bad stream header")
+	}
+	r.blockSize = level * 100000
+	r.inStream = true
+	r.streams++
+	r.crc = 0
+	return nil
+}
+
+// readBlock reads the rest of a block after its magic number, leaving
+// its bytes in r.tt.
+func (r *goReader) readBlock() (err error) {
+	br := r.br
+	defer func() {
+		// Bits read past the end are zeros, which may look corrupt.
+		if err != nil && br.err != nil {
+			err = br.err
+		}
+	}()
+	r.wantCRC = uint32(br.readBits(32))
+	if br.readBits(1) != 0 {
+		return corrupt("randomized blocks are not supported")
+	}
+	origPtr := int(br.readBits(24))
+
+	var seqToUnseq []byte
+	used16 := br.readBits(16)
+	for i := 0; i < 16; i++ {
+		if used16&(1<<(15-i)) == 0 {
+			continue
+		}
+		bits := br.readBits(16)
+		for j := 0; j < 16; j++ {
+			if bits&(1<<(15-j)) != 0 {
+				seqToUnseq = append(seqToUnseq, byte(i*16+j))
+			}
+		}
+	}
+	if len(seqToUnseq) == 0 {
+		return corrupt("no symbols in block")
+	}
+	alphaSize := len(seqToUnseq) + 2
+
+	nGroups := int(br.readBits(3))
+	nSelectors := int(br.readBits(15))
+	if nGroups < 2 || nGroups > 6 || nSelectors == 0 {
+		return corrupt("bad table counts")
+	}
+	order := []byte{0, 1, 2, 3, 4, 5}[:nGroups]
+	selectors := make([]byte, nSelectors)
+	for i := range selectors {
+		j := 0
+		for br.readBits(1) == 1 {
+			j++
+			if j >= nGroups {
+				return corrupt("bad selector")
+			}
+		}
+		s := order[j]
+		copy(order[1:j+1], order[:j])
+		order[0] = s
+		selectors[i] = s
+	}
+
+	decoders := make([]huffDecoder, nGroups)
+	for g := range decoders {
+		lengths := make([]uint8, alphaSize)
+		curr := int(br.readBits(5))
+		for s := range lengths {
+			for {
+				if curr < 1 || curr > 20 {
+					return corrupt("bad code length")
+				}
+				if br.readBits(1) == 0 {
+					break
+				}
+				if br.readBits(1) == 0 {
+					curr++
+				} else {
+					curr--
+				}
+			}
+			lengths[s] = uint8(curr)
+		}
+		decoders[g] = newHuffDecoder(lengths)
+	}
+	if br.err != nil {
+		return br.err
+	}
+
+	// Decode the symbols, undoing the move-to-front coding and the
+	// RUNA/RUNB coding of runs of zeros.
+	var counts [256]int
+	tt := r.tt[:0]
+	var mtf [256]byte
+	for i := range seqToUnseq {
+		mtf[i] = byte(i)
+	}
+	eob := alphaSize - 1
+	zeros, weight := 0, 1
+	for i := 0; ; i++ {
+		if i/groupSize >= nSelectors {
+			return corrupt("too few selectors")
+		}
+		s, err := decoders[selectors[i/groupSize]].decode(br)
+		if err != nil {
+			return err
+		}
+		if s == runA || s == runB {
+			zeros += (s + 1) * weight
+			weight <<= 1
+			if zeros > r.blockSize {
+				return corrupt("block too long")
+			}
+			continue
+		}
+		if zeros > 0 {
+			if len(tt)+zeros > r.blockSize {
+				return corrupt("block too long")
+			}
+			b := seqToUnseq[mtf[0]]
+			counts[b] += zeros
+			for ; zeros > 0; zeros-- {
+				tt = append(tt, uint32(b))
+			}
+			weight = 1
+		}
+		if s == eob {
+			break
+		}
+		if len(tt) >= r.blockSize {
+			return corrupt("block too long")
+		}
+		j := s - 1
+		seq := mtf[j]
+		copy(mtf[1:j+1], mtf[:j])
+		mtf[0] = seq
+		b := seqToUnseq[seq]
+		counts[b]++
+		tt = append(tt, uint32(b))
+	}
+	if origPtr >= len(tt) {
+		return corrupt("origin pointer out of range")
+	}
+
+	// Link each byte of the last column of the sorted rotations to the
+	// byte that follows it in the original, by way of the first column,
+	// where the nth occurrence of a byte is the same as in the last.
+	sum := 0
+	for b, c := range counts {
+		counts[b] = sum
+		sum += c
+	}
+	for i := range tt {
+		b := tt[i] & 0xff
+		tt[counts[b]] |= uint32(i) << 8
+		counts[b]++
+	}
+	r.tt = tt
+	r.tPos = tt[origPtr] >> 8
+	r.left = len(tt)
+	r.blockCRC = crcInit
+	r.run, r.repeats = 0, 0
+	return nil
+}
+
+// A huffDecoder decodes a canonical Huffman code, one bit at a time.
+type huffDecoder struct {
+	maxLen int
+	first  [21]int // first code of each length
+	count  [21]int // number of codes of each length
+	offset [21]int // index in perm of the first symbol of each length
+	perm   []int   // symbols in order of code
+}
+
+func newHuffDecoder(lengths []uint8) huffDecoder {
+	var d huffDecoder
+	for l := 1; l <= 20; l++ {
+		d.offset[l] = len(d.perm)
+		for s, sl := range lengths {
+			if int(sl) == l {
+				d.perm = append(d.perm, s)
+				d.count[l]++
+				d.maxLen = l
+			}
+		}
+	}
+	code := 0
+	for l := 1; l <= 20; l++ {
+		d.first[l] = code
+		code = (code + d.count[l]) << 1
+	}
+	return d
+}
+
+func (d *huffDecoder) decode(br *bitReader) (int, error) {
+	code := 0
+	for l := 1; l <= d.maxLen; l++ {
+		code = code<<1 | int(br.readBits(1))
+		if i := code - d.first[l]; i >= 0 && i < d.count[l] {
+			return d.perm[d.offset[l]+i], br.err
+		}
+	}
+	if br.err != nil {
+		return 0, br.err
+	}
+	return 0, corrupt("bad Huffman code")
+}
+
+// bitReader reads bits, most significant first. After an error, it
+// returns zeros.
+type bitReader struct {
+	r    *bufio.Reader
+	bits uint64 // unread bits, in the low n
+	n    uint
+	err  error
+}
+
+func newBitReader(r io.Reader) *bitReader {
+	return &bitReader{r: bufio.NewReader(r)}
+}
+
+// readBits reads n bits, n <= 48. The end of the input is an error,
+// io.ErrUnexpectedEOF.
+func (br *bitReader) readBits(n uint) uint64 {
+	for br.n < n {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if br.err == nil {
+				br.err = err
+			}
+			return 0
+		}
+		br.bits = br.bits<<8 | uint64(b)
+		br.n += 8
+	}
+	br.n -= n
+	return br.bits >> br.n & (1<<n - 1)
+}
+
+// align discards the bits that remain of the current byte.
+func (br *bitReader) align() {
+	br.n -= br.n % 8
+}
+
+// atEOF reports whether all of the input has been read.
+func (br *bitReader) atEOF() bool {
+	if br.n > 0 || br.err != nil {
+		return false
+	}
+	_, err := br.r.Peek(1)
+	if err != nil && err != io.EOF {
+		br.err = err
+	}
+	return err == io.EOF
+}
@@ -0,0 +1,436 @@
+package bzip
+
+import (
+	"bufio"
+	"io"
+)
+
+// This file is a pure Go bzip2 compressor. A stream is a header such
+// as "BZh9", which limits blocks to 9×100,000 bytes, followed by the
+// blocks, each compressed independently by these stages:
+//
+//	run-length encoding of runs of 4 to 255 equal bytes (rle1)
+//	the Burrows–Wheeler transform, which groups similar contexts
+//	move-to-front coding, with runs of zeros coded as RUNA/RUNB
+//	Huffman coding with up to 6 tables, chosen per 50 symbols
+//
+// and then a trailer holding a CRC of all the blocks' CRCs.
+
+const (
+	blockMagic    = 0x314159265359 // digits of pi
+	endMagic      = 0x177245385090 // digits of sqrt(pi)
+	groupSize     = 50             // symbols coded by one table
+	maxCodeLength = 17
+	runA, runB    = 0, 1
+)
+
+type goWriter struct {
+	bw       *bitWriter
+	maxBlock int    // of rle1 output, as bzip2 allows
+	block    []byte // rle1 output of the current block
+	blockCRC uint32
+	crc      uint32 // combined CRC of the finished blocks
+	run      byte   // the byte of the current run
+	runLen   int    // length of the current run, 0 to 255
+	closed   bool
+	pool     *pool // if non-nil, the workers that compress blocks
+}
+
+// newGoWriter returns a writer for bzip2-compressed streams that is
+// written entirely in Go.
+func newGoWriter(out io.Writer) io.WriteCloser {
+	return newLevelWriter(out, 9)
+}
+
+// newLevelWriter returns a Go writer whose blocks are of level×100 KB.
+func newLevelWriter(out io.Writer, level int) *goWriter {
+	w := &goWriter{
+		bw:       newBitWriter(out),
+		maxBlock: level*100000 - 19,
+		blockCRC: crcInit,
+	}
+	w.bw.writeBits(8*4, 'B'<<24|'Z'<<16|'h'<<8|uint64('0'+level))
+	return w
+}
+
+func (w *goWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		panic("closed")
+	}
+	for _, b := range data {
+		if b == w.run && w.runLen > 0 && w.runLen < 255 {
+			w.runLen++
+			continue
+		}
+		w.endRun()
+		w.run, w.runLen = b, 1
+	}
+	return len(data), w.bw.err
+}
+
+// endRun adds the current run to the block, compressing the block
+// first if it is full.
+func (w *goWriter) endRun() {
+	if w.runLen == 0 {
+		return
+	}
+	if len(w.block)+5 > w.maxBlock {
+		w.endBlock()
+	}
+	for i := 0; i < w.runLen; i++ {
+		w.blockCRC = updateCRC(w.blockCRC, w.run)
+		if i < 4 {
+			w.block = append(w.block, w.run)
+		}
+	}
+	if w.runLen >= 4 {
+		w.block = append(w.block, byte(w.runLen-4))
+	}
+	w.runLen = 0
+}
+
+func (w *goWriter) endBlock() {
+	if len(w.block) == 0 {
+		return
+	}
+	crc := ^w.blockCRC
+	w.crc = w.crc<<1 | w.crc>>31 ^ crc
+	if w.pool != nil {
+		w.pool.compress(w.bw, w.block, crc)
+		w.block = nil // now the pool's
+	} else {
+		writeBlock(w.bw, w.block, crc)
+		w.block = w.block[:0]
+	}
+	w.blockCRC = crcInit
+}
+
+// Close flushes the compressed data and closes the stream.
+// It does not close the underlying io.Writer.
+func (w *goWriter) Close() error {
+	if w.closed {
+		panic("closed")
+	}
+	w.closed = true
+	w.endRun()
+	w.endBlock()
+	if w.pool != nil {
+		w.pool.close(w.bw)
+	}
+	writeTrailer(w.bw, w.crc)
+	return w.bw.flush()
+}
+
+func writeTrailer(bw *bitWriter, crc uint32) {
+	bw.writeBits(48, endMagic)
+	bw.writeBits(32, uint64(crc))
+}
+
+// writeBlock writes the block header and compressed form of block,
+// the rle1 output of data whose CRC is crc.
+func writeBlock(bw *bitWriter, block []byte, crc uint32) {
+	bwt, origPtr := transform(block)
+
+	// Record which bytes occur, and number them.
+	var inUse [256]bool
+	for _, b := range block {
+		inUse[b] = true
+	}
+	var seqToUnseq []byte
+	for b, used := range inUse {
+		if used {
+			seqToUnseq = append(seqToUnseq, byte(b))
+		}
+	}
+	syms := mtf(bwt, seqToUnseq)
+	alphaSize := len(seqToUnseq) + 2
+	tables, selectors := huffmanTables(syms, alphaSize)
+
+	bw.writeBits(48, blockMagic)
+	bw.writeBits(32, uint64(crc))
+	bw.writeBits(1, 0) // not randomized
+	bw.writeBits(24, uint64(origPtr))
+
+	var used16 uint64
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				used16 |= 1 << (15 - i)
+				break
+			}
+		}
+	}
+	bw.writeBits(16, used16)
+	for i := 0; i < 16; i++ {
+		if used16&(1<<(15-i)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				bits |= 1 << (15 - j)
+			}
+		}
+		bw.writeBits(16, bits)
+	}
+
+	bw.writeBits(3, uint64(len(tables)))
+	bw.writeBits(15, uint64(len(selectors)))
+	order := []byte{0, 1, 2, 3, 4, 5}[:len(tables)]
+	for _, s := range selectors {
+		j := 0
+		for order[j] != s {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = s
+		for ; j > 0; j-- {
+			bw.writeBits(1, 1)
+		}
+		bw.writeBits(1, 0)
+	}
+
+	for _, t := range tables {
+		curr := t.lengths[0]
+		bw.writeBits(5, uint64(curr))
+		for _, l := range t.lengths {
+			for ; curr < l; curr++ {
+				bw.writeBits(2, 2)
+			}
+			for ; curr > l; curr-- {
+				bw.writeBits(2, 3)
+			}
+			bw.writeBits(1, 0)
+		}
+	}
+
+	for i, s := range syms {
+		t := &tables[selectors[i/groupSize]]
+		bw.writeBits(uint(t.lengths[s]), uint64(t.codes[s]))
+	}
+}
+
+// transform returns the Burrows–Wheeler transform of block, the last
+// column of the sorted matrix of its rotations, and the row of that
+// matrix that holds block itself.
+func transform(block []byte) ([]byte, int) {
+	p := sortRotations(block)
+	n := len(block)
+	out := make([]byte, n)
+	origPtr := 0
+	for i, r := range p {
+		if r == 0 {
+			origPtr = i
+		}
+		out[i] = block[(int(r)+n-1)%n]
+	}
+	return out, origPtr
+}
+
+// sortRotations returns the starting offsets of the rotations of s in
+// sorted order, by prefix doubling: after the round for h, the
+// rotations are sorted, and ranked into equivalence classes, by their
+// first 2h bytes. Each round is a counting sort, so the whole takes
+// O(n log n).
+func sortRotations(s []byte) []int32 {
+	n := int32(len(s))
+	p := make([]int32, n)  // rotations in sorted order
+	c := make([]int32, n)  // class of each rotation
+	pn := make([]int32, n) // scratch
+	cn := make([]int32, n) // scratch
+	if n == 0 {
+		return p
+	}
+
+	// The first round sorts by the first two bytes.
+	key := func(i int32) int {
+		j := i + 1
+		if j == n {
+			j = 0
+		}
+		return int(s[i])<<8 | int(s[j])
+	}
+	cnt := make([]int32, 1<<16)
+	for i := int32(0); i < n; i++ {
+		cnt[key(i)]++
+	}
+	for i := 1; i < len(cnt); i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		k := key(i)
+		cnt[k]--
+		p[cnt[k]] = i
+	}
+	classes := int32(1)
+	for i := int32(1); i < n; i++ {
+		if key(p[i]) != key(p[i-1]) {
+			classes++
+		}
+		c[p[i]] = classes - 1
+	}
+	if int(n) > len(cnt) {
+		cnt = make([]int32, n)
+	}
+
+	for h := int32(2); h < n && classes < n; h <<= 1 {
+		// Sort by the second half of each 2h-byte prefix, which is
+		// already sorted as the first half of another rotation...
+		for i, r := range p {
+			if r -= h; r < 0 {
+				r += n
+			}
+			pn[i] = r
+		}
+		// ...then stably by the first half.
+		for i := int32(0); i < classes; i++ {
+			cnt[i] = 0
+		}
+		for _, r := range pn {
+			cnt[c[r]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			r := pn[i]
+			cnt[c[r]]--
+			p[cnt[c[r]]] = r
+		}
+		second := func(r int32) int32 {
+			if r += h; r >= n {
+				r -= n
+			}
+			return c[r]
+		}
+		cn[p[0]] = 0
+		classes = 1
+		for i := int32(1); i < n; i++ {
+			if c[p[i]] != c[p[i-1]] || second(p[i]) != second(p[i-1]) {
+				classes++
+			}
+			cn[p[i]] = classes - 1
+		}
+		c, cn = cn, c
+	}
+	return p
+}
+
+// mtf returns the move-to-front coding of the transformed block, in
+// the symbols of the Huffman stage: runs of zeros as RUNA and RUNB
+// digits of their length in bijective base 2, other positions j as
+// j+1, and finally the end-of-block symbol.
+func mtf(data []byte, seqToUnseq []byte) []uint16 {
+	var order [256]byte
+	var unseqToSeq [256]byte
+	for i, b := range seqToUnseq {
+		order[i] = byte(i)
+		unseqToSeq[b] = byte(i)
+	}
+	eob := uint16(len(seqToUnseq) + 1)
+
+	syms := make([]uint16, 0, len(data)+1)
+	zeros := 0
+	flushZeros := func() {
+		for zeros--; ; zeros = (zeros - 2) / 2 {
+			syms = append(syms, uint16(zeros&1)) // runA or runB
+			if zeros < 2 {
+				break
+			}
+		}
+		zeros = 0
+	}
+	for _, b := range data {
+		seq := unseqToSeq[b]
+		if order[0] == seq {
+			zeros++
+			continue
+		}
+		if zeros > 0 {
+			flushZeros()
+		}
+		j := 1
+		for order[j] != seq {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = seq
+		syms = append(syms, uint16(j+1))
+	}
+	if zeros > 0 {
+		flushZeros()
+	}
+	return append(syms, eob)
+}
+
+// bitWriter writes bits, most significant first.
+type bitWriter struct {
+	w     *bufio.Writer
+	bits  uint64 // pending bits, in the low n
+	n     uint
+	err   error
+	total int64 // bits written
+}
+
+func newBitWriter(w io.Writer) *bitWriter {
+	return &bitWriter{w: bufio.NewWriter(w)}
+}
+
+// writeBits writes the low n bits of v, n <= 48.
+func (bw *bitWriter) writeBits(n uint, v uint64) {
+	bw.bits = bw.bits<<n | v&(1<<n-1)
+	bw.n += n
+	bw.total += int64(n)
+	for bw.n >= 8 {
+		bw.n -= 8
+		if err := bw.w.WriteByte(byte(bw.bits >> bw.n)); err != nil && bw.err == nil {
+			bw.err = err
+		}
+	}
+}
+
+// writeBitString writes the first n bits of data.
+func (bw *bitWriter) writeBitString(data []byte, n int64) {
+	for ; n >= 8; n -= 8 {
+		bw.writeBits(8, uint64(data[0]))
+		data = data[1:]
+	}
+	if n > 0 {
+		bw.writeBits(uint(n), uint64(data[0]>>(8-n)))
+	}
+}
+
+// flush writes any pending bits, padded with zeros to a byte.
+func (bw *bitWriter) flush() error {
+	if bw.n > 0 {
+		bw.writeBits(8-bw.n, 0)
+	}
+	if err := bw.w.Flush(); err != nil && bw.err == nil {
+		bw.err = err
+	}
+	return bw.err
+}
+
+// bzip2's CRC is the CRC-32 of IEEE 802.3 computed most significant
+// bit first, unlike that of hash/crc32.
+const crcInit = 0xffffffff
+
+var crcTable [256]uint32
+
+func init() {
+	for i := range crcTable {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		crcTable[i] = c
+	}
+}
+
+func updateCRC(crc uint32, b byte) uint32 {
+	return crc<<8 ^ crcTable[byte(crc>>24)^b]
+}
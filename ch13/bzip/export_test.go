@@ -0,0 +1,9 @@
+package bzip
+
+// The Go implementations, for comparison with those of libbz2.
+var (
+	NewGoWriter = newGoWriter
+	NewGoReader = newGoReader
+)
+
+const PureGo = pureGo
@@ -0,0 +1,185 @@
+package bzip
+
+// A huffTable is one of the Huffman codes of a block, giving each
+// symbol of its alphabet a code of lengths[sym] bits.
+type huffTable struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+// huffmanTables chooses the Huffman tables for the symbols of a block
+// and, for each group of 50 symbols, the table that codes it. As in
+// bzip2, it starts from tables that each favour a range of the
+// alphabet, then alternates between choosing the cheapest table for
+// each group and refitting each table to the groups that chose it.
+func huffmanTables(syms []uint16, alphaSize int) ([]huffTable, []byte) {
+	nGroups := 6
+	switch n := len(syms); {
+	case n < 200:
+		nGroups = 2
+	case n < 600:
+		nGroups = 3
+	case n < 1200:
+		nGroups = 4
+	case n < 2400:
+		nGroups = 5
+	}
+
+	freq := make([]int, alphaSize)
+	for _, s := range syms {
+		freq[s]++
+	}
+	lengths := make([][]uint8, nGroups)
+	remaining := len(syms)
+	lo := 0
+	for g := nGroups; g > 0; g-- {
+		// Give table g the next range of symbols holding about
+		// 1/g of those that remain.
+		target := remaining / g
+		hi, sum := lo, 0
+		for sum < target && hi < alphaSize {
+			sum += freq[hi]
+			hi++
+		}
+		if hi > lo+1 && g != nGroups && g > 1 && (nGroups-g)%2 == 1 {
+			// As bzip2 does, leave the last symbol to the next
+			// table on every other table.
+			hi--
+			sum -= freq[hi]
+		}
+		t := make([]uint8, alphaSize)
+		for s := range t {
+			t[s] = 15
+			if lo <= s && s < hi {
+				t[s] = 0
+			}
+		}
+		lengths[nGroups-g] = t
+		remaining -= sum
+		lo = hi
+	}
+
+	selectors := make([]byte, (len(syms)+groupSize-1)/groupSize)
+	for iter := 0; iter < 4; iter++ {
+		freqs := make([][]int, nGroups)
+		for g := range freqs {
+			freqs[g] = make([]int, alphaSize)
+		}
+		for i := range selectors {
+			group := syms[i*groupSize:]
+			if len(group) > groupSize {
+				group = group[:groupSize]
+			}
+			best, bestCost := 0, -1
+			for g, t := range lengths {
+				cost := 0
+				for _, s := range group {
+					cost += int(t[s])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = g, cost
+				}
+			}
+			selectors[i] = byte(best)
+			for _, s := range group {
+				freqs[best][s]++
+			}
+		}
+		for g := range lengths {
+			lengths[g] = codeLengths(freqs[g], maxCodeLength)
+		}
+	}
+
+	tables := make([]huffTable, nGroups)
+	for g, l := range lengths {
+		tables[g] = huffTable{lengths: l, codes: canonicalCodes(l)}
+	}
+	return tables, selectors
+}
+
+// codeLengths returns the lengths of a Huffman code for symbols of the
+// given frequencies, none longer than maxLen. Every symbol gets a code,
+// even one that does not occur, as the format requires. If the code is
+// too deep, the frequencies are flattened and it is built again.
+func codeLengths(freq []int, maxLen int) []uint8 {
+	weights := make([]int, len(freq))
+	for i, f := range freq {
+		weights[i] = f
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+	for {
+		lengths, depth := huffman(weights)
+		if depth <= maxLen {
+			return lengths
+		}
+		for i, w := range weights {
+			weights[i] = 1 + w/2
+		}
+	}
+}
+
+// huffman returns the code lengths of a Huffman code for the weights,
+// and the greatest of them. The alphabet is at most 258 symbols, so
+// the two lightest trees are found by a linear scan.
+func huffman(weights []int) ([]uint8, int) {
+	n := len(weights)
+	parent := make([]int, 2*n-1)
+	weight := append(make([]int, 0, 2*n-1), weights...)
+	var roots []int // trees not yet merged
+	for i := 0; i < n; i++ {
+		roots = append(roots, i)
+	}
+	lightest := func() int {
+		j := 0
+		for i := range roots {
+			if weight[roots[i]] < weight[roots[j]] {
+				j = i
+			}
+		}
+		r := roots[j]
+		roots = append(roots[:j], roots[j+1:]...)
+		return r
+	}
+	for len(roots) > 1 {
+		a, b := lightest(), lightest()
+		node := len(weight)
+		weight = append(weight, weight[a]+weight[b])
+		parent[a], parent[b] = node, node
+		roots = append(roots, node)
+	}
+
+	lengths := make([]uint8, n)
+	depth := 0
+	root := len(weight) - 1
+	for i := range lengths {
+		l := 0
+		for j := i; j != root; j = parent[j] {
+			l++
+		}
+		lengths[i] = uint8(l)
+		if l > depth {
+			depth = l
+		}
+	}
+	return lengths, depth
+}
+
+// canonicalCodes returns the canonical Huffman code for the given code
+// lengths: codes of each length are consecutive, in order of symbol,
+// and follow those of the shorter lengths.
+func canonicalCodes(lengths []uint8) []uint32 {
+	codes := make([]uint32, len(lengths))
+	code := uint32(0)
+	for l := uint8(1); l <= 32; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
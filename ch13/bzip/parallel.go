@@ -0,0 +1,90 @@
+package bzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// NewParallelWriter returns a writer for bzip2-compressed streams that
+// compresses up to workers blocks at once, for throughput on several
+// cores. The blocks are of blockSize×100 KB, where blockSize is from 1
+// to 9, as for the -1 to -9 options of bzip2; 9 compresses best. If
+// workers is zero or negative, it is runtime.GOMAXPROCS(0).
+//
+// The result is a single stream, the same as one compressed by a
+// single worker. The blocks are compressed in Go, whichever version
+// NewWriter is, and at most 2×workers of them are held in memory.
+func NewParallelWriter(out io.Writer, workers, blockSize int) io.WriteCloser {
+	if blockSize < 1 || blockSize > 9 {
+		panic(fmt.Sprintf("bzip: block size %d not in [1, 9]", blockSize))
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	w := newLevelWriter(out, blockSize)
+	w.pool = newPool(workers)
+	return w
+}
+
+// A pool compresses blocks concurrently, and writes them in the order
+// they were given.
+type pool struct {
+	jobs    chan *job
+	pending []*job // in order of submission
+	workers int
+}
+
+// A job is the compression of one block.
+type job struct {
+	block []byte
+	crc   uint32
+	out   bytes.Buffer
+	bits  int64 // length of the compressed block in out
+	done  chan struct{}
+}
+
+func newPool(workers int) *pool {
+	p := &pool{jobs: make(chan *job, workers), workers: workers}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range p.jobs {
+				bw := newBitWriter(&j.out)
+				writeBlock(bw, j.block, j.crc)
+				j.bits = bw.total
+				bw.flush() // a bytes.Buffer cannot fail
+				j.block = nil
+				close(j.done)
+			}
+		}()
+	}
+	return p
+}
+
+// compress queues the block for compression, first writing the oldest
+// blocks to bw if too many are pending.
+func (p *pool) compress(bw *bitWriter, block []byte, crc uint32) {
+	for len(p.pending) >= 2*p.workers {
+		p.writeOldest(bw)
+	}
+	j := &job{block: block, crc: crc, done: make(chan struct{})}
+	p.pending = append(p.pending, j)
+	p.jobs <- j
+}
+
+// writeOldest waits for the oldest pending block and writes it to bw.
+func (p *pool) writeOldest(bw *bitWriter) {
+	j := p.pending[0]
+	p.pending = p.pending[1:]
+	<-j.done
+	bw.writeBitString(j.out.Bytes(), j.bits)
+}
+
+// close writes all the pending blocks to bw and stops the workers.
+func (p *pool) close(bw *bitWriter) {
+	for len(p.pending) > 0 {
+		p.writeOldest(bw)
+	}
+	close(p.jobs)
+}
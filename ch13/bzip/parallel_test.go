@@ -0,0 +1,64 @@
+package bzip_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"gopl.io/ch13/bzip"
+)
+
+func TestParallelWriter(t *testing.T) {
+	data := inputs()
+	for _, name := range []string{"empty", "runs", "zeros", "text"} {
+		want := compress(t, bzip.NewGoWriter, data[name])
+		for _, workers := range []int{1, 4} {
+			for _, blockSize := range []int{1, 9} {
+				got := compress(t, func(w io.Writer) io.WriteCloser {
+					return bzip.NewParallelWriter(w, workers, blockSize)
+				}, data[name])
+				if blockSize == 9 && !bytes.Equal(got, want) {
+					t.Errorf("%s: %d workers: stream differs from that of one", name, workers)
+				}
+				out, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(got)))
+				if err != nil || !bytes.Equal(out, data[name]) {
+					t.Errorf("%s: %d workers, block size %d: decompressed %d bytes, %v; want %d",
+						name, workers, blockSize, len(out), err, len(data[name]))
+				}
+			}
+		}
+	}
+}
+
+func TestParallelWriterBlockSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("block size 10 did not panic")
+		}
+	}()
+	bzip.NewParallelWriter(ioutil.Discard, 1, 10)
+}
+
+func benchmarkWriter(b *testing.B, newWriter func(io.Writer) io.WriteCloser) {
+	data := inputs()["text"]
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		w := newWriter(ioutil.Discard)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewWriter(b *testing.B) {
+	benchmarkWriter(b, bzip.NewWriter)
+}
+
+func BenchmarkParallelWriter(b *testing.B) {
+	benchmarkWriter(b, func(w io.Writer) io.WriteCloser {
+		return bzip.NewParallelWriter(w, 0, 9)
+	})
+}
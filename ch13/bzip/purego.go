@@ -0,0 +1,23 @@
+//go:build !cgo || purego
+// +build !cgo purego
+
+package bzip
+
+import "io"
+
+// pureGo reports whether NewReader and NewWriter are the Go versions.
+const pureGo = true
+
+// NewWriter returns a writer for bzip2-compressed streams.
+func NewWriter(out io.Writer) io.WriteCloser {
+	return newGoWriter(out)
+}
+
+// NewReader returns a reader that decompresses bzip2-compressed
+// streams. Like bzip2, it reads a concatenation of streams as one.
+// Corrupt input is reported as ErrChecksum or ErrFormat, and truncated
+// input as io.ErrUnexpectedEOF. The caller should call Close to release
+// the decompressor.
+func NewReader(in io.Reader) io.ReadCloser {
+	return newGoReader(in)
+}
@@ -0,0 +1,119 @@
+//go:build cgo && !purego
+// +build cgo,!purego
+
+package bzip
+
+/*
+#cgo CFLAGS: -I/usr/include
+#cgo LDFLAGS: -L/usr/lib -lbz2
+#include <bzlib.h>
+#include <stdlib.h>
+bz_stream* bz2alloc();
+int bz2decompress(bz_stream *s,
+                  char *in, unsigned *inlen, char *out, unsigned *outlen);
+void bz2free(bz_stream* s);
+*/
+import "C"
+
+import (
+	"io"
+	"unsafe"
+)
+
+// pureGo reports whether NewReader and NewWriter are the Go versions.
+const pureGo = false
+
+type reader struct {
+	r      io.Reader // underlying input stream
+	stream *C.bz_stream
+	inbuf  [64 * 1024]byte
+	in     []byte // unconsumed part of inbuf
+	eof    bool   // r is exhausted
+	ended  bool   // the current stream has ended
+	err    error
+}
+
+// NewReader returns a reader that decompresses bzip2-compressed
+// streams. Like bzip2, it reads a concatenation of streams as one.
+// Corrupt input is reported as ErrChecksum or ErrFormat, and truncated
+// input as io.ErrUnexpectedEOF. The caller should call Close to release
+// the decompressor.
+func NewReader(in io.Reader) io.ReadCloser {
+	r := &reader{r: in, stream: C.bz2alloc()}
+	C.BZ2_bzDecompressInit(r.stream, 0, 0)
+	return r
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.stream == nil {
+		panic("closed")
+	}
+	for r.err == nil && len(p) > 0 {
+		if len(r.in) == 0 && !r.eof {
+			n, err := r.r.Read(r.inbuf[:])
+			r.in = r.inbuf[:n]
+			if err == io.EOF {
+				r.eof = true
+			} else if err != nil {
+				r.err = err
+				break
+			}
+		}
+		if r.ended {
+			// Another stream may follow.
+			if len(r.in) == 0 {
+				if r.eof {
+					r.err = io.EOF
+				}
+				continue
+			}
+			C.BZ2_bzDecompressEnd(r.stream)
+			C.BZ2_bzDecompressInit(r.stream, 0, 0)
+			r.ended = false
+		}
+
+		inlen, outlen := C.uint(len(r.in)), C.uint(len(p))
+		var in *C.char
+		if inlen > 0 {
+			in = (*C.char)(unsafe.Pointer(&r.in[0]))
+		}
+		ret := C.bz2decompress(r.stream, in, &inlen,
+			(*C.char)(unsafe.Pointer(&p[0])), &outlen)
+		r.in = r.in[inlen:]
+		switch ret {
+		case C.BZ_OK:
+			if inlen == 0 && outlen == 0 && len(r.in) == 0 && r.eof {
+				r.err = io.ErrUnexpectedEOF
+			}
+		case C.BZ_STREAM_END:
+			r.ended = true
+		case C.BZ_DATA_ERROR:
+			// libbz2 reports all corruption detected after the
+			// header this way, most often as a bad CRC.
+			r.err = ErrChecksum
+		case C.BZ_DATA_ERROR_MAGIC:
+			r.err = ErrFormat
+		default:
+			r.err = corrupt("libbz2 error %d", int(ret))
+		}
+		if outlen > 0 {
+			return int(outlen), nil
+		}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return 0, r.err
+}
+
+// Close releases the decompressor.
+// It does not close the underlying io.Reader.
+func (r *reader) Close() error {
+	if r.stream == nil {
+		panic("closed")
+	}
+	C.BZ2_bzDecompressEnd(r.stream)
+	C.bz2free(r.stream)
+	r.stream = nil
+	return nil
+}
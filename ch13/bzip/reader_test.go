@@ -0,0 +1,129 @@
+package bzip_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"gopl.io/ch13/bzip"
+)
+
+// inputs returns data of kinds that exercise each stage of bzip2.
+func inputs() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 100000)
+	rng.Read(random)
+	words := strings.Fields("the quick brown fox jumps over a lazy dog while bzip2 sorts rotations")
+	var text bytes.Buffer
+	for text.Len() < 2000000 { // several blocks
+		text.WriteString(words[rng.Intn(len(words))])
+		text.WriteByte(" \n"[rng.Intn(2)])
+	}
+	var runs bytes.Buffer
+	for _, n := range []int{1, 3, 4, 5, 254, 255, 256, 259, 1000} {
+		runs.Write(bytes.Repeat([]byte{byte(n)}, n))
+	}
+	var all []byte
+	for i := 0; i < 256; i++ {
+		all = append(all, byte(i))
+	}
+	return map[string][]byte{
+		"empty":  {},
+		"byte":   {'x'},
+		"hello":  []byte("hello, world\n"),
+		"zeros":  make([]byte, 1000000),
+		"runs":   runs.Bytes(),
+		"all":    bytes.Repeat(all, 10),
+		"random": random,
+		"text":   text.Bytes(),
+	}
+}
+
+func compress(t *testing.T, newWriter func(io.Writer) io.WriteCloser, data []byte) []byte {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCrossCheck(t *testing.T) {
+	writers := []struct {
+		name      string
+		newWriter func(io.Writer) io.WriteCloser
+	}{
+		{"NewWriter", bzip.NewWriter},
+		{"Go", bzip.NewGoWriter},
+	}
+	readers := []struct {
+		name      string
+		newReader func(io.Reader) io.Reader
+	}{
+		{"NewReader", func(r io.Reader) io.Reader { return bzip.NewReader(r) }},
+		{"Go", func(r io.Reader) io.Reader { return bzip.NewGoReader(r) }},
+		{"compress/bzip2", bzip2.NewReader},
+	}
+	for name, data := range inputs() {
+		for _, w := range writers {
+			compressed := compress(t, w.newWriter, data)
+			for _, r := range readers {
+				got, err := ioutil.ReadAll(r.newReader(bytes.NewReader(compressed)))
+				if err != nil {
+					t.Errorf("%s: %s to %s: %v", name, w.name, r.name, err)
+				} else if !bytes.Equal(got, data) {
+					t.Errorf("%s: %s to %s: got %d bytes, want %d", name, w.name, r.name, len(got), len(data))
+				}
+			}
+		}
+	}
+}
+
+func TestConcatenated(t *testing.T) {
+	var streams []byte
+	streams = append(streams, compress(t, bzip.NewWriter, []byte("hello, "))...)
+	streams = append(streams, compress(t, bzip.NewGoWriter, []byte("world"))...)
+	for _, newReader := range []func(io.Reader) io.ReadCloser{bzip.NewReader, bzip.NewGoReader} {
+		r := newReader(bytes.NewReader(streams))
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || string(got) != "hello, world" {
+			t.Errorf("read %q, %v; want %q", got, err, "hello, world")
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	good := compress(t, bzip.NewGoWriter, []byte(strings.Repeat("hello, world\n", 100)))
+	// The block CRC follows the 4-byte header and 6-byte block magic.
+	badCRC := append([]byte(nil), good...)
+	badCRC[10] ^= 1
+	for _, test := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"header", []byte("BZh0"), bzip.ErrFormat},
+		{"gzip", []byte{0x1f, 0x8b, 8, 0}, bzip.ErrFormat},
+		{"crc", badCRC, bzip.ErrChecksum},
+		{"truncated", good[:len(good)/2], io.ErrUnexpectedEOF},
+		{"empty", nil, io.ErrUnexpectedEOF},
+	} {
+		for _, newReader := range []func(io.Reader) io.ReadCloser{bzip.NewReader, bzip.NewGoReader} {
+			r := newReader(bytes.NewReader(test.data))
+			_, err := ioutil.ReadAll(r)
+			r.Close()
+			if !errors.Is(err, test.want) {
+				t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+			}
+		}
+	}
+}
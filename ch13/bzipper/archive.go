@@ -0,0 +1,418 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// options controls the operations on files.
+type options struct {
+	codec   *codec // for compression; decompression detects the format
+	keep    bool   // keep input files
+	force   bool   // overwrite existing output files
+	workers int    // blocks to compress at once, for bzip2
+	verbose io.Writer
+}
+
+// compress compresses the file or directory at path, a directory as a
+// tar archive, and removes it unless o.keep.
+func (o *options) compress(path string) (err error) {
+	path = filepath.Clean(path)
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	var out string
+	switch {
+	case fi.IsDir():
+		out = path + ".tar" + o.codec.ext
+	case !fi.Mode().IsRegular():
+		return fmt.Errorf("%s is not a regular file or directory", path)
+	case strings.HasSuffix(path, o.codec.ext):
+		return fmt.Errorf("%s already has %s suffix", path, o.codec.ext)
+	default:
+		out = path + o.codec.ext
+	}
+
+	perm := fi.Mode().Perm() | 0600
+	if fi.IsDir() {
+		perm = 0666 // not the directory's search bits
+	}
+	f, err := create(out, perm, o.force)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(out)
+		}
+	}()
+	var compressed byteCounter
+	zw := o.codec.newWriter(io.MultiWriter(f, &compressed), o.workers)
+	prog := newProgress(o.verbose, path, fi.Size())
+	w := io.MultiWriter(zw, prog)
+	if fi.IsDir() {
+		prog.total = 0 // the size of the tar archive is unknown
+		err = writeTar(w, path)
+	} else {
+		err = copyFile(w, path)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		os.Chtimes(out, fi.ModTime(), fi.ModTime())
+	}
+	prog.done("compressed", compressed)
+	if o.keep {
+		return nil
+	}
+	return os.RemoveAll(path)
+}
+
+// decompress decompresses the file at path, extracting a tar archive
+// into the directory that holds it, and removes the file unless o.keep.
+func (o *options) decompress(path string) (err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	a, err := openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	out, isTar := outputName(path)
+	prog := newProgress(o.verbose, path, 0)
+	r := io.TeeReader(a, prog)
+	if isTar {
+		err = extractTar(r, filepath.Dir(path), o.force)
+		if err == nil {
+			err = drain(r)
+		}
+	} else {
+		var f *os.File
+		if f, err = create(out, fi.Mode().Perm(), o.force); err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(out)
+		} else {
+			os.Chtimes(out, fi.ModTime(), fi.ModTime())
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	prog.done("decompressed", a.compressed)
+	if o.keep {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// test decompresses the file at path, and reads any tar archive it
+// holds, without writing anything, to check that it is intact.
+func (o *options) test(path string) error {
+	a, err := openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	prog := newProgress(o.verbose, path, 0)
+	r := io.TeeReader(a, prog)
+	if _, isTar := outputName(path); isTar {
+		err = readTar(r, func(*tar.Header, io.Reader) error { return nil })
+	}
+	if err == nil {
+		err = drain(r)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	prog.done("ok", a.compressed)
+	return nil
+}
+
+// listFile writes to w the compressed and uncompressed sizes of the
+// file at path and, if it is a tar archive, the files it holds.
+func listFile(w io.Writer, path string) error {
+	a, err := openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	var size byteCounter
+	r := io.TeeReader(a, &size)
+	out, isTar := outputName(path)
+	var entries []*tar.Header
+	if isTar {
+		err = readTar(r, func(hdr *tar.Header, _ io.Reader) error {
+			entries = append(entries, hdr)
+			return nil
+		})
+	}
+	if err == nil {
+		err = drain(r)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	ratio := 0.0
+	if size > 0 {
+		ratio = 100 * float64(a.compressed) / float64(size)
+	}
+	fmt.Fprintf(w, "%-5s %12d %12d %5.1f%% %s\n", a.codec.name, a.compressed, size, ratio, out)
+	for _, hdr := range entries {
+		fmt.Fprintf(w, "%31s %v %12d %s\n", "", hdr.FileInfo().Mode(), hdr.Size, hdr.Name)
+	}
+	return nil
+}
+
+// An archive is a compressed file open for reading, whose format is
+// detected from its first bytes.
+type archive struct {
+	f          *os.File
+	rc         io.ReadCloser
+	codec      *codec
+	compressed byteCounter // bytes of f read so far
+}
+
+func openArchive(path string) (*archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	a := &archive{f: f}
+	a.rc, a.codec, err = sniffCodec(io.TeeReader(f, &a.compressed))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return a, nil
+}
+
+func (a *archive) Read(p []byte) (int, error) { return a.rc.Read(p) }
+
+func (a *archive) Close() error {
+	a.rc.Close()
+	return a.f.Close()
+}
+
+// drain reads r to its end. A decompressor verifies the checksums at
+// the end of its input only when it gets there, which a tar reader,
+// stopping at the end of the archive, may not.
+func drain(r io.Reader) error {
+	_, err := io.Copy(ioutil.Discard, r)
+	return err
+}
+
+// outputName returns the name of the file, or directory if isTar, that
+// the compressed file at path holds.
+func outputName(path string) (name string, isTar bool) {
+	for _, c := range codecs {
+		if strings.HasSuffix(path, ".tar"+c.ext) {
+			return strings.TrimSuffix(path, ".tar"+c.ext), true
+		}
+	}
+	for _, c := range codecs {
+		if strings.HasSuffix(path, c.ext) && len(path) > len(c.ext) {
+			return strings.TrimSuffix(path, c.ext), false
+		}
+	}
+	return path + ".out", false // as bzip2 does
+}
+
+// create creates the named file, which must not exist unless force.
+func create(name string, perm os.FileMode, force bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(name, flags, perm)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%s already exists; use -f to overwrite it", name)
+	}
+	return f, err
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// writeTar writes a tar archive of the tree at root to w, naming each
+// file by its path from the directory that holds root. Files other
+// than regular files, directories and symbolic links are skipped.
+func writeTar(w io.Writer, root string) error {
+	tw := tar.NewWriter(w)
+	base := filepath.Dir(root)
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var link string
+		switch mode := fi.Mode(); {
+		case mode&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !mode.IsRegular() && !mode.IsDir():
+			log.Printf("bzipper: skipping %s: %v", path, mode)
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			return copyFile(tw, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// readTar calls visit for each file of the tar archive read from r,
+// with a reader of its contents.
+func readTar(r io.Reader, visit func(hdr *tar.Header, contents io.Reader) error) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := visit(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// extractTar extracts the tar archive read from r into dir. It rejects
+// files outside dir and files beneath a symbolic link, which may lead
+// outside dir. Symbolic links that lead outside dir, which writeTar
+// archives as it finds them, are logged and skipped.
+func extractTar(r io.Reader, dir string, force bool) error {
+	return readTar(r, func(hdr *tar.Header, contents io.Reader) error {
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if !local(name) {
+			return fmt.Errorf("%s is outside the archive's directory", hdr.Name)
+		}
+		parent := filepath.Dir(name)
+		if hdr.Typeflag == tar.TypeDir {
+			parent = name
+		}
+		if err := checkLinks(dir, parent); err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+		target := filepath.Join(dir, name)
+		perm := hdr.FileInfo().Mode().Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(target, perm|0700)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+				return err
+			}
+			if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 && force {
+				os.Remove(target) // rather than write through it
+			}
+			f, err := create(target, perm, force)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, contents)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(link) || !local(filepath.Join(filepath.Dir(name), link)) {
+				log.Printf("bzipper: skipping %s: links outside the archive's directory", hdr.Name)
+				return nil
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+				return err
+			}
+			if force {
+				os.Remove(target)
+			}
+			return os.Symlink(link, target)
+		default:
+			log.Printf("bzipper: skipping %s: type %q", hdr.Name, hdr.Typeflag)
+			return nil
+		}
+	})
+}
+
+// checkLinks returns an error if any of the existing directories on
+// the relative path from dir to dir/path is a symbolic link.
+func checkLinks(dir, path string) error {
+	if path == "." {
+		return nil
+	}
+	for _, elem := range strings.Split(path, string(filepath.Separator)) {
+		dir = filepath.Join(dir, elem)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil // created by extractTar as a directory
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symbolic link", dir)
+		}
+	}
+	return nil
+}
+
+// local reports whether the relative path name stays within its root.
+func local(name string) bool {
+	name = filepath.Clean(name)
+	return !filepath.IsAbs(name) && name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
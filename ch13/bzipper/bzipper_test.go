@@ -0,0 +1,244 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files in dir from a map of slash-separated names to
+// contents.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func checkTree(t *testing.T, dir string, files map[string]string) {
+	for name, want := range files {
+		got, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+var files = map[string]string{
+	"file.txt":         strings.Repeat("hello, world\n", 1000),
+	"tree/a":           "a",
+	"tree/sub/b":       strings.Repeat("b", 100000),
+	"tree/sub/empty":   "",
+	"tree/deeper/x/yz": "xyz",
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, c := range codecs {
+		dir := t.TempDir()
+		writeTree(t, dir, files)
+		o := &options{codec: c, workers: 2}
+		file, tree := filepath.Join(dir, "file.txt"), filepath.Join(dir, "tree")
+		for _, path := range []string{file, tree} {
+			if err := o.compress(path); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+		}
+		if exists(file) || exists(tree) {
+			t.Errorf("%s: inputs not removed", c.name)
+		}
+
+		archives := []string{file + c.ext, tree + ".tar" + c.ext}
+		var list bytes.Buffer
+		for _, path := range archives {
+			if err := o.test(path); err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+			if err := listFile(&list, path); err != nil {
+				t.Errorf("%s: %v", c.name, err)
+			}
+		}
+		for _, want := range []string{c.name, " 13000 ", file + "\n", "100000 tree/sub/b\n", "tree/deeper/x/\n"} {
+			if !strings.Contains(list.String(), want) {
+				t.Errorf("%s: list lacks %q:\n%s", c.name, want, list.String())
+			}
+		}
+
+		o.keep = true
+		for _, path := range archives {
+			if err := o.decompress(path); err != nil {
+				t.Fatalf("%s: %v", c.name, err)
+			}
+			if !exists(path) {
+				t.Errorf("%s: -k did not keep %s", c.name, path)
+			}
+		}
+		checkTree(t, dir, files)
+	}
+}
+
+func TestForce(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"f": "new", "f.bz2": "old"})
+	o := &options{codec: codecs[0], keep: true, workers: 1}
+	path := filepath.Join(dir, "f")
+	if err := o.compress(path); err == nil || !strings.Contains(err.Error(), "-f") {
+		t.Errorf("compress over existing file: got %v, want error suggesting -f", err)
+	}
+	checkTree(t, dir, map[string]string{"f.bz2": "old"})
+	o.force = true
+	if err := o.compress(path); err != nil {
+		t.Fatal(err)
+	}
+	o.force = false
+	if err := o.decompress(path + ".bz2"); err == nil {
+		t.Error("decompress over existing file succeeded")
+	}
+	os.Remove(path)
+	if err := o.decompress(path + ".bz2"); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, map[string]string{"f": "new"})
+}
+
+func TestCorrupt(t *testing.T) {
+	for _, c := range codecs {
+		dir := t.TempDir()
+		writeTree(t, dir, files)
+		path := filepath.Join(dir, "file.txt")
+		o := &options{codec: c, workers: 1}
+		if err := o.compress(path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path + c.ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Flip a bit of the checksum at the end of the data (or, for
+		// bzip2, of the block CRC after the header and block magic).
+		i := len(data) - 5
+		if c.name == "bzip2" {
+			i = 10
+		}
+		data[i] ^= 1
+		ioutil.WriteFile(path+c.ext, data, 0666)
+		if err := o.test(path + c.ext); err == nil {
+			t.Errorf("%s: test of corrupt file succeeded", c.name)
+		}
+		if err := o.decompress(path + c.ext); err == nil {
+			t.Errorf("%s: decompression of corrupt file succeeded", c.name)
+		}
+		if exists(path) {
+			t.Errorf("%s: partial output of corrupt file not removed", c.name)
+		}
+	}
+}
+
+func TestExtractOutside(t *testing.T) {
+	for _, hdr := range []*tar.Header{
+		{Name: "../evil", Typeflag: tar.TypeReg},
+		{Name: "/evil", Typeflag: tar.TypeReg},
+	} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(hdr)
+		tw.Close()
+		if err := extractTar(&buf, t.TempDir(), false); err == nil {
+			t.Errorf("extracted %s -> %q", hdr.Name, hdr.Linkname)
+		}
+	}
+
+	// A link leading out is skipped rather than made.
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "d/link", Typeflag: tar.TypeSymlink, Linkname: "../../etc"})
+	tw.Close()
+	if err := extractTar(&buf, dir, false); err != nil || exists(filepath.Join(dir, "d", "link")) {
+		t.Errorf("link outside: err %v, made %t", err, exists(filepath.Join(dir, "d", "link")))
+	}
+
+	// Each link stays within the directory by its text, but the second
+	// is made beneath the first, so it would lead out.
+	parent := t.TempDir()
+	dir = filepath.Join(parent, "dir")
+	os.Mkdir(dir, 0755)
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "sub/up", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "sub/up/esc", Typeflag: tar.TypeSymlink, Linkname: ".."},
+		{Name: "sub/up/esc/pwned", Typeflag: tar.TypeReg, Mode: 0644},
+	} {
+		tw.WriteHeader(hdr)
+	}
+	tw.Close()
+	if err := extractTar(&buf, dir, false); err == nil {
+		t.Error("extracted through symbolic links")
+	}
+	if exists(filepath.Join(parent, "pwned")) || exists(filepath.Join(parent, "esc")) {
+		t.Error("wrote outside the extraction directory")
+	}
+
+	// With -f, a file replaces a symbolic link rather than being
+	// written through it.
+	outside := filepath.Join(parent, "outside")
+	writeTree(t, parent, map[string]string{"outside": "safe"})
+	os.Symlink(outside, filepath.Join(dir, "f"))
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "f", Typeflag: tar.TypeReg, Mode: 0644, Size: 3})
+	tw.Write([]byte("new"))
+	tw.Close()
+	if err := extractTar(&buf, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, parent, map[string]string{"outside": "safe", "dir/f": "new"})
+}
+
+// A directory holding links that lead outside it is compressed, and
+// extracted without them, rather than lost.
+func TestLinksOutside(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"d/f": "f"})
+	d := filepath.Join(dir, "d")
+	if err := os.Symlink("/etc/hostname", filepath.Join(d, "abs")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	os.Symlink("../../outside", filepath.Join(d, "up"))
+	os.Symlink("f", filepath.Join(d, "in"))
+	o := &options{codec: codecs[0], workers: 1}
+	if err := o.compress(d); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(d + ".tar" + codecs[0].ext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&0111 != 0 {
+		t.Errorf("archive mode %v is executable", fi.Mode())
+	}
+	if err := o.decompress(d + ".tar" + codecs[0].ext); err != nil {
+		t.Fatal(err)
+	}
+	checkTree(t, dir, map[string]string{"d/f": "f", "d/in": "f"})
+	if exists(filepath.Join(d, "abs")) || exists(filepath.Join(d, "up")) {
+		t.Error("extracted links leading outside")
+	}
+}
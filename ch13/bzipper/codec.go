@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"gopl.io/ch13/bzip"
+)
+
+// A codec is a compression format. Each format's reader verifies the
+// checksums it records: the block and stream CRCs of bzip2, the CRC-32
+// and length of gzip, and the Adler-32 of zlib.
+type codec struct {
+	name      string
+	ext       string // file name suffix, with the dot
+	newWriter func(w io.Writer, workers int) io.WriteCloser
+	newReader func(r io.Reader) (io.ReadCloser, error)
+	sniff     func(header []byte) bool // reports whether data begins this way
+}
+
+var codecs = []*codec{
+	{
+		name: "bzip2",
+		ext:  ".bz2",
+		newWriter: func(w io.Writer, workers int) io.WriteCloser {
+			if workers == 1 {
+				return bzip.NewWriter(w)
+			}
+			return bzip.NewParallelWriter(w, workers, 9)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return bzip.NewReader(r), nil
+		},
+		sniff: func(h []byte) bool {
+			return len(h) >= 4 && bytes.HasPrefix(h, []byte("BZh")) && '1' <= h[3] && h[3] <= '9'
+		},
+	},
+	{
+		name: "gzip",
+		ext:  ".gz",
+		newWriter: func(w io.Writer, workers int) io.WriteCloser {
+			return gzip.NewWriter(w)
+		},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+		sniff: func(h []byte) bool {
+			return len(h) >= 2 && h[0] == 0x1f && h[1] == 0x8b
+		},
+	},
+	{
+		name: "zlib",
+		ext:  ".zz",
+		newWriter: func(w io.Writer, workers int) io.WriteCloser {
+			return zlib.NewWriter(w)
+		},
+		newReader: zlib.NewReader,
+		sniff: func(h []byte) bool {
+			// Deflate, with a header check that is a multiple of 31.
+			return len(h) >= 2 && h[0]&0x0f == 8 && (uint(h[0])<<8|uint(h[1]))%31 == 0
+		},
+	},
+}
+
+// lookupCodec returns the codec of the given name.
+func lookupCodec(name string) (*codec, error) {
+	for _, c := range codecs {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown codec %q (want bzip2, gzip or zlib)", name)
+}
+
+// sniffCodec returns a reader that decompresses r in the format of its
+// first bytes.
+func sniffCodec(r io.Reader) (io.ReadCloser, *codec, error) {
+	br := bufio.NewReader(r)
+	header, _ := br.Peek(4)
+	for _, c := range codecs {
+		if c.sniff(header) {
+			rc, err := c.newReader(br)
+			return rc, c, err
+		}
+	}
+	return nil, nil, fmt.Errorf("not compressed in a known format")
+}
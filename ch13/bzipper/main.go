@@ -6,24 +6,128 @@
 //!+
 
 // Bzipper reads input, bzip2-compresses it, and writes it out.
+// With -j, it compresses that many blocks at once (0 means one per CPU).
+//
+// Given files or directories, it compresses each into a file of the
+// same name with a suffix, .bz2 or, with -z, .gz or .zz for gzip or
+// zlib; a directory is first made into a tar archive, with a suffix
+// such as .tar.bz2. The input is removed unless -k is given, and an
+// existing output is not overwritten unless -f is given.
+//
+// With -d it decompresses instead, detecting the format from the data,
+// and extracting tar archives alongside them; with -t it decompresses
+// without writing anything, to verify the checksums; and with -l it
+// lists the compressed and uncompressed sizes, and the files of tar
+// archives. With -v it reports progress and compression ratios.
+//
+// Usage:
+//
+//	$ bzipper < file > file.bz2
+//	$ bzipper -z gzip -k dir       # writes dir.tar.gz
+//	$ bzipper -t dir.tar.gz
+//	$ bzipper -d dir.tar.gz
 package main
 
 import (
+	"flag"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+)
 
-	"gopl.io/ch13/bzip"
+var (
+	workers   = flag.Int("j", 1, "number of blocks to compress at once (0 means one per CPU)")
+	codecName = flag.String("z", "bzip2", "compress with `codec`: bzip2, gzip or zlib")
+	dFlag     = flag.Bool("d", false, "decompress")
+	tFlag     = flag.Bool("t", false, "test the integrity of compressed files")
+	lFlag     = flag.Bool("l", false, "list the contents of compressed files")
+	kFlag     = flag.Bool("k", false, "keep input files")
+	fFlag     = flag.Bool("f", false, "overwrite existing output files")
+	vFlag     = flag.Bool("v", false, "report progress")
 )
 
 func main() {
-	w := bzip.NewWriter(os.Stdout)
+	flag.Parse()
+	log.SetFlags(0)
+	c, err := lookupCodec(*codecName)
+	if err != nil {
+		log.Fatalf("bzipper: %v", err)
+	}
+	if btoi(*dFlag)+btoi(*tFlag)+btoi(*lFlag) > 1 {
+		log.Fatal("bzipper: at most one of -d, -t and -l is allowed")
+	}
+	o := &options{codec: c, keep: *kFlag, force: *fFlag, workers: *workers}
+	if *vFlag {
+		o.verbose = os.Stderr
+	}
+
+	if flag.NArg() == 0 {
+		if err := stream(o); err != nil {
+			log.Fatalf("bzipper: %v", err)
+		}
+		return
+	}
+	status := 0
+	if *lFlag {
+		fmt.Printf("%-5s %12s %12s %6s %s\n", "codec", "compressed", "size", "ratio", "name")
+	}
+	for _, path := range flag.Args() {
+		var err error
+		switch {
+		case *dFlag:
+			err = o.decompress(path)
+		case *tFlag:
+			if err = o.test(path); err == nil && !*vFlag {
+				fmt.Printf("%s: ok\n", path)
+			}
+		case *lFlag:
+			err = listFile(os.Stdout, path)
+		default:
+			err = o.compress(path)
+		}
+		if err != nil {
+			log.Printf("bzipper: %v", err)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+// stream compresses, decompresses or tests the standard input.
+func stream(o *options) error {
+	switch {
+	case *lFlag:
+		return fmt.Errorf("-l needs files")
+	case *dFlag, *tFlag:
+		rc, _, err := sniffCodec(os.Stdin)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		var out io.Writer = os.Stdout
+		if *tFlag {
+			out = ioutil.Discard
+		}
+		_, err = io.Copy(out, rc)
+		return err
+	}
+	w := o.codec.newWriter(os.Stdout, o.workers)
 	if _, err := io.Copy(w, os.Stdin); err != nil {
-		log.Fatalf("bzipper: %v\n", err)
+		return err
 	}
 	if err := w.Close(); err != nil {
-		log.Fatalf("bzipper: close: %v\n", err)
+		return fmt.Errorf("close: %v", err)
+	}
+	return nil
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
 	}
+	return 0
 }
 
 //!-
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// A byteCounter counts the bytes written to it, as in ch7/bytecounter.
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// A progress is a byteCounter that, as it grows, reports its count on
+// out, if out is not nil, at most every tick.
+type progress struct {
+	byteCounter
+	name  string
+	total int64 // expected count, or 0 if unknown
+	out   io.Writer
+	next  time.Time // of the next report
+}
+
+const tick = 250 * time.Millisecond
+
+func newProgress(out io.Writer, name string, total int64) *progress {
+	return &progress{name: name, total: total, out: out, next: time.Now().Add(tick)}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.byteCounter.Write(b)
+	if p.out != nil && time.Now().After(p.next) {
+		if p.total > 0 {
+			fmt.Fprintf(p.out, "\r%s: %3.0f%%", p.name, 100*float64(p.byteCounter)/float64(p.total))
+		} else {
+			fmt.Fprintf(p.out, "\r%s: %d bytes", p.name, p.byteCounter)
+		}
+		p.next = time.Now().Add(tick)
+	}
+	return len(b), nil
+}
+
+// done reports the outcome, given the compressed size of the data this
+// progress counted.
+func (p *progress) done(msg string, compressed byteCounter) {
+	if p.out == nil {
+		return
+	}
+	ratio := 0.0
+	if p.byteCounter > 0 {
+		ratio = float64(compressed) / float64(p.byteCounter)
+	}
+	fmt.Fprintf(p.out, "\r%s: %s, %d bytes, %d compressed (%.1f%%)\n",
+		p.name, msg, p.byteCounter, compressed, 100*ratio)
+}
@@ -0,0 +1,326 @@
+package equal
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"unsafe"
+)
+
+// A Difference is a place at which two values differ.
+type Difference struct {
+	// Path locates the place within the values, as a sequence of
+	// field selectors, slice indices and map keys such as
+	// .Items[3].User.Login or ["key"]. Pointers and interfaces are
+	// followed silently. Path is empty if the values differ at the top.
+	Path string
+
+	// X and Y are the differing values. One is nil if an element of a
+	// slice or map has no counterpart in the other. A value that cannot
+	// be copied out, such as one reached through an unexported field
+	// of a map element, is given as its reflect.Value.
+	X, Y interface{}
+}
+
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "(top)"
+	}
+	return fmt.Sprintf("%s: %v != %v", path, d.X, d.Y)
+}
+
+// Options adjust the comparisons made by Diff and Equal. Besides its
+// fields, an Options holds the comparers, transformers and field
+// filters registered with its methods. The zero Options is ready to use.
+type Options struct {
+	// FloatTolerance is the greatest difference at which two floating
+	// point numbers, or the parts of two complex numbers, compare equal.
+	FloatTolerance float64
+
+	// IgnoreUnexported causes unexported struct fields to be skipped.
+	IgnoreUnexported bool
+
+	// EquateEmpty causes a nil slice or map to equal an empty one, as
+	// it does for the function Equal. Without it, the methods Diff and
+	// Equal, like the function Diff, tell them apart.
+	EquateEmpty bool
+
+	// Unordered causes slices to be compared as multisets, in which
+	// each element of one must be matched by a distinct equal element
+	// of the other, in any position.
+	Unordered bool
+
+	comparers    map[reflect.Type]reflect.Value // func(T, T) bool
+	transformers map[reflect.Type]reflect.Value // func(T) U
+	filters      []func(reflect.Type, reflect.StructField) bool
+}
+
+// Diff returns the places at which x and y differ, in the order in
+// which they occur, or none if they are deeply equal. It compares as
+// Equal does, except that a nil slice or map differs from an empty one.
+func Diff(x, y interface{}) []Difference {
+	return new(Options).Diff(x, y)
+}
+
+// Diff is like the function Diff but compares according to o.
+func (o *Options) Diff(x, y interface{}) []Difference {
+	d := &differ{opts: o, seen: make(map[comparison]bool)}
+	d.diff(addressable(x), addressable(y), "")
+	return d.diffs
+}
+
+// addressable returns a Value holding a copy of x whose fields and
+// elements are addressable, so that they can be copied out by iface
+// even when unexported.
+func addressable(x interface{}) reflect.Value {
+	v := reflect.ValueOf(x)
+	if !v.IsValid() {
+		return v
+	}
+	p := reflect.New(v.Type()).Elem()
+	p.Set(v)
+	return p
+}
+
+// A differ accumulates the differences found in one call to Diff.
+// If quick is set, it stops at the first.
+type differ struct {
+	opts  *Options
+	seen  map[comparison]bool
+	diffs []Difference
+	quick bool
+	skip  reflect.Type // whose transformer made the values being compared
+}
+
+func (d *differ) done() bool { return d.quick && len(d.diffs) > 0 }
+
+func (d *differ) report(path string, x, y reflect.Value) {
+	d.diffs = append(d.diffs, Difference{Path: path, X: iface(x), Y: iface(y)})
+}
+
+// diff records the places at which x and y differ, using the same
+// cycle check as equal.
+func (d *differ) diff(x, y reflect.Value, path string) {
+	if !x.IsValid() || !y.IsValid() {
+		if x.IsValid() != y.IsValid() {
+			d.report(path, x, y)
+		}
+		return
+	}
+	if x.Type() != y.Type() {
+		d.report(path, x, y)
+		return
+	}
+
+	if d.custom(x, y, path) {
+		return
+	}
+
+	if x.CanAddr() && y.CanAddr() {
+		xptr := unsafe.Pointer(x.UnsafeAddr())
+		yptr := unsafe.Pointer(y.UnsafeAddr())
+		if xptr == yptr {
+			return // identical references
+		}
+		c := comparison{xptr, yptr, x.Type()}
+		if d.seen[c] {
+			return // already seen
+		}
+		d.seen[c] = true
+	}
+
+	switch x.Kind() {
+	case reflect.Bool:
+		if x.Bool() != y.Bool() {
+			d.report(path, x, y)
+		}
+
+	case reflect.String:
+		if x.String() != y.String() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		if x.Int() != y.Int() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		if x.Uint() != y.Uint() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Float32, reflect.Float64:
+		if !d.floatEqual(x.Float(), y.Float()) {
+			d.report(path, x, y)
+		}
+
+	case reflect.Complex64, reflect.Complex128:
+		cx, cy := x.Complex(), y.Complex()
+		if !d.floatEqual(real(cx), real(cy)) || !d.floatEqual(imag(cx), imag(cy)) {
+			d.report(path, x, y)
+		}
+
+	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
+		if x.Pointer() != y.Pointer() {
+			d.report(path, x, y)
+		}
+
+	case reflect.Ptr, reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			if x.IsNil() != y.IsNil() {
+				d.report(path, x, y)
+			}
+			return
+		}
+		d.diff(x.Elem(), y.Elem(), path)
+
+	case reflect.Array:
+		d.elems(x, y, path)
+
+	case reflect.Slice:
+		if !d.opts.EquateEmpty && x.IsNil() != y.IsNil() {
+			d.report(path, x, y)
+			return
+		}
+		if d.opts.Unordered {
+			d.unordered(x, y, path)
+		} else {
+			d.elems(x, y, path)
+		}
+
+	case reflect.Struct:
+		t := x.Type()
+		for i, n := 0, x.NumField(); i < n && !d.done(); i++ {
+			if d.ignored(t, t.Field(i)) {
+				continue
+			}
+			d.diff(x.Field(i), y.Field(i), path+"."+t.Field(i).Name)
+		}
+
+	case reflect.Map:
+		if !d.opts.EquateEmpty && x.IsNil() != y.IsNil() {
+			d.report(path, x, y)
+			return
+		}
+		for _, k := range mapKeys(x, y) {
+			if d.done() {
+				break
+			}
+			d.diff(x.MapIndex(k), y.MapIndex(k), path+"["+formatKey(k)+"]")
+		}
+
+	default:
+		panic("unreachable")
+	}
+}
+
+func (d *differ) floatEqual(x, y float64) bool {
+	return x == y || math.Abs(x-y) <= d.opts.FloatTolerance
+}
+
+// elems compares the elements of two slices or arrays in order.
+// Elements of the longer with no counterpart differ from nothing.
+func (d *differ) elems(x, y reflect.Value, path string) {
+	n := x.Len()
+	if y.Len() > n {
+		n = y.Len()
+	}
+	for i := 0; i < n && !d.done(); i++ {
+		var xi, yi reflect.Value
+		if i < x.Len() {
+			xi = x.Index(i)
+		}
+		if i < y.Len() {
+			yi = y.Index(i)
+		}
+		p := path + "[" + strconv.Itoa(i) + "]"
+		if !xi.IsValid() || !yi.IsValid() {
+			d.report(p, xi, yi)
+			continue
+		}
+		d.diff(xi, yi, p)
+	}
+}
+
+// unordered compares the elements of two slices as multisets. Each
+// element of x is matched with the first unmatched equal element of y;
+// those left over on either side differ from nothing.
+func (d *differ) unordered(x, y reflect.Value, path string) {
+	matched := make([]bool, y.Len())
+	var extra []int // indices of unmatched elements of x
+	for i := 0; i < x.Len(); i++ {
+		found := false
+		for j := 0; j < y.Len() && !found; j++ {
+			if !matched[j] && d.equal(x.Index(i), y.Index(j)) {
+				matched[j], found = true, true
+			}
+		}
+		if !found {
+			extra = append(extra, i)
+		}
+	}
+	for _, i := range extra {
+		if d.done() {
+			return
+		}
+		d.report(path+"["+strconv.Itoa(i)+"]", x.Index(i), reflect.Value{})
+	}
+	for j, ok := range matched {
+		if d.done() {
+			return
+		}
+		if !ok {
+			d.report(path+"["+strconv.Itoa(j)+"]", reflect.Value{}, y.Index(j))
+		}
+	}
+}
+
+// equal reports whether x and y are equal under d's options. It has its
+// own cycle check, since a pair that proves unequal in a trial match
+// must not be taken as equal, as seen, by a later comparison.
+func (d *differ) equal(x, y reflect.Value) bool {
+	trial := &differ{opts: d.opts, seen: make(map[comparison]bool), quick: true}
+	trial.diff(x, y, "")
+	return len(trial.diffs) == 0
+}
+
+// mapKeys returns the union of the keys of maps x and y, in an order
+// that does not depend on the maps' iteration order.
+func mapKeys(x, y reflect.Value) []reflect.Value {
+	keys := x.MapKeys()
+	for _, k := range y.MapKeys() {
+		if !x.MapIndex(k).IsValid() {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return formatKey(keys[i]) < formatKey(keys[j])
+	})
+	return keys
+}
+
+// formatKey formats a map key as it appears in a path.
+func formatKey(k reflect.Value) string {
+	return fmt.Sprintf("%#v", iface(k))
+}
+
+// iface returns the value held by v, or nil if v is invalid. Values
+// reached through unexported fields are copied out by way of their
+// address, if they have one.
+func iface(v reflect.Value) interface{} {
+	switch {
+	case !v.IsValid():
+		return nil
+	case v.CanInterface():
+		return v.Interface()
+	case v.CanAddr():
+		return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem().Interface()
+	}
+	return v
+}
@@ -0,0 +1,188 @@
+package equal
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+type user struct {
+	Login string
+	admin bool
+}
+
+type item struct {
+	Name  string
+	User  *user
+	Price float64
+}
+
+type order struct {
+	Items []item
+	Tags  map[string]int
+	Notes interface{}
+}
+
+func TestDiff(t *testing.T) {
+	newOrder := func() order {
+		var items []item
+		for _, name := range []string{"a", "b", "c", "d"} {
+			items = append(items, item{Name: name, User: &user{Login: "ann"}, Price: 1.5})
+		}
+		return order{Items: items, Tags: map[string]int{"x": 1, "y": 2}, Notes: []int{1}}
+	}
+	x, y := newOrder(), newOrder()
+	if diffs := Diff(x, y); diffs != nil {
+		t.Fatalf("equal values differ: %v", diffs)
+	}
+
+	y.Items[3].User.Login = "bob"
+	y.Items[1].User.admin = true
+	y.Items[2].Price = 1.5000001
+	delete(y.Tags, "x")
+	y.Tags["z"] = 3
+	y.Notes = []int{1, 2}
+	got := fmt.Sprint(Diff(x, y))
+	want := "[.Items[1].User.admin: false != true" +
+		" .Items[2].Price: 1.5 != 1.5000001" +
+		" .Items[3].User.Login: ann != bob" +
+		` .Tags["x"]: 1 != <nil>` +
+		` .Tags["z"]: <nil> != 3` +
+		" .Notes[1]: <nil> != 2]"
+	if got != want {
+		t.Errorf("Diff =\n%s, want\n%s", got, want)
+	}
+
+	o := &Options{FloatTolerance: 1e-6, IgnoreUnexported: true}
+	if diffs := o.Diff(x.Items, y.Items); len(diffs) != 1 || diffs[0].Path != "[3].User.Login" {
+		t.Errorf("Diff with options = %v", diffs)
+	}
+}
+
+func TestDiffOptions(t *testing.T) {
+	for _, test := range []struct {
+		opts  Options
+		x, y  interface{}
+		paths []string
+	}{
+		{Options{}, []int(nil), []int{}, []string{""}},
+		{Options{EquateEmpty: true}, []int(nil), []int{}, nil},
+		{Options{}, map[string]int{}, map[string]int(nil), []string{""}},
+		{Options{EquateEmpty: true}, map[string]int{}, map[string]int(nil), nil},
+		{Options{}, []int{1, 2, 2}, []int{2, 1, 2}, []string{"[0]", "[1]"}},
+		{Options{Unordered: true}, []int{1, 2, 2}, []int{2, 1, 2}, nil},
+		{Options{Unordered: true}, []int{1, 2, 2}, []int{2, 1, 1}, []string{"[2]", "[2]"}},
+		{Options{}, 1.0, 1.1, []string{""}},
+		{Options{FloatTolerance: 0.2}, 1.0, 1.1, nil},
+		{Options{FloatTolerance: 0.2}, 1 + 1i, 1.1 + 2i, []string{""}},
+		{Options{}, 1, int64(1), []string{""}},
+		{Options{}, nil, 0, []string{""}},
+		{Options{}, [2]string{"a", "b"}, [2]string{"a", "c"}, []string{"[1]"}},
+		{Options{}, map[int]bool{2: true, 10: false}, map[int]bool{2: false, 10: true}, []string{"[10]", "[2]"}},
+	} {
+		var paths []string
+		for _, d := range test.opts.Diff(test.x, test.y) {
+			paths = append(paths, d.Path)
+		}
+		if !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("%+v.Diff(%#v, %#v) paths = %q, want %q", test.opts, test.x, test.y, paths, test.paths)
+		}
+	}
+}
+
+func TestEquateEmpty(t *testing.T) {
+	// The function Equal treats nil and empty alike; the zero Options,
+	// like Diff, does not.
+	for _, test := range []struct{ x, y interface{} }{
+		{[]int(nil), []int{}},
+		{map[string]int(nil), map[string]int{}},
+	} {
+		if !Equal(test.x, test.y) {
+			t.Errorf("Equal(%#v, %#v) = false", test.x, test.y)
+		}
+		if new(Options).Equal(test.x, test.y) {
+			t.Errorf("new(Options).Equal(%#v, %#v) = true", test.x, test.y)
+		}
+		o := Options{EquateEmpty: true}
+		if !o.Equal(test.x, test.y) {
+			t.Errorf("%+v.Equal(%#v, %#v) = false", o, test.x, test.y)
+		}
+	}
+}
+
+func TestDiffCycle(t *testing.T) {
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b, c := &link{value: "a"}, &link{value: "b"}, &link{value: "a"}
+	a.tail, b.tail, c.tail = b, a, c
+	if diffs := Diff(a, a); diffs != nil {
+		t.Errorf("Diff(a, a) = %v", diffs)
+	}
+	if got := fmt.Sprint(Diff(a, c)); got != "[.tail.value: b != a]" {
+		t.Errorf("Diff(a, c) = %s", got)
+	}
+}
+
+type event struct {
+	When   time.Time
+	Amount *big.Int
+	Seq    int `equal:"-"`
+	Tags   []string
+	cache  map[string]int
+}
+
+func TestOptionsRegistry(t *testing.T) {
+	utc := time.Date(2016, 10, 26, 9, 0, 0, 0, time.UTC)
+	x := event{When: utc, Amount: big.NewInt(100), Seq: 1, Tags: []string{"b", "a"}, cache: map[string]int{"k": 1}}
+	y := event{When: utc.In(time.FixedZone("EST", -5*3600)), Amount: new(big.Int).SetInt64(100), Seq: 2, Tags: []string{"a", "b"}}
+
+	var o Options
+	if o.Equal(x, y) {
+		t.Fatal("events equal without options")
+	}
+	o.Comparer(func(x, y time.Time) bool { return x.Equal(y) })
+	o.Comparer(func(x, y *big.Int) bool { return x.Cmp(y) == 0 })
+	o.IgnoreTag("equal")
+	o.IgnoreFields("event.cache")
+	o.Transformer(func(s []string) []string {
+		s = append([]string(nil), s...)
+		sort.Strings(s)
+		return s
+	})
+	if diffs := o.Diff(x, y); diffs != nil {
+		t.Errorf("Diff with registry = %v", diffs)
+	}
+
+	y.Amount.SetInt64(101)
+	y.Tags = append(y.Tags, "c")
+	got := fmt.Sprint(o.Diff(&x, &y))
+	if want := "[.Amount: 100 != 101 .Tags[2]: <nil> != c]"; got != want {
+		t.Errorf("Diff = %s, want %s", got, want)
+	}
+	if o.Equal([]event{x}, []event{y}) {
+		t.Error("Equal ignores registered comparer's verdict")
+	}
+
+	// Comparers apply to unexported fields too.
+	var p Options
+	p.Comparer(func(x, y map[string]int) bool { return true })
+	z := x
+	z.cache = nil
+	if diffs := p.Diff(x, z); diffs != nil {
+		t.Errorf("Diff(x, z) = %v", diffs)
+	}
+}
+
+func TestComparerPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic registering a bad comparer")
+		}
+	}()
+	new(Options).Comparer(func(x int, y string) bool { return false })
+}
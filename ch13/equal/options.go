@@ -0,0 +1,150 @@
+package equal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Equal reports whether x and y are deeply equal under o, that is,
+// whether o.Diff finds no differences. Unlike the function Equal, it
+// distinguishes a nil slice or map from an empty one unless
+// o.EquateEmpty is set.
+func (o *Options) Equal(x, y interface{}) bool {
+	d := &differ{opts: o, seen: make(map[comparison]bool), quick: true}
+	d.diff(addressable(x), addressable(y), "")
+	return len(d.diffs) == 0
+}
+
+// Comparer registers f, a function of the form func(x, y T) bool, to
+// decide whether two values of type T are equal in place of the usual
+// rules. For example:
+//
+//	o.Comparer(func(x, y time.Time) bool { return x.Equal(y) })
+//	o.Comparer(func(x, y *big.Int) bool { return x.Cmp(y) == 0 })
+//
+// A comparer applies only to values whose type is exactly T, but it
+// receives nil pointers, maps and slices too. Comparer panics if f is
+// not such a function.
+func (o *Options) Comparer(f interface{}) {
+	fv := reflect.ValueOf(f)
+	t := fv.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || t.In(0) != t.In(1) ||
+		t.NumOut() != 1 || t.Out(0).Kind() != reflect.Bool || t.IsVariadic() {
+		panic(fmt.Sprintf("equal: Comparer of %s, want func(T, T) bool", t))
+	}
+	if o.comparers == nil {
+		o.comparers = make(map[reflect.Type]reflect.Value)
+	}
+	o.comparers[t.In(0)] = fv
+}
+
+// Transformer registers f, a function of the form func(T) U, so that
+// two values of type T are compared by comparing their images under f.
+// For example, a transformer that sorts a copy of a []string makes the
+// order of its elements irrelevant. A transformer whose result is of
+// type T too is not applied again to its own result. Transformer
+// panics if f is not such a function.
+func (o *Options) Transformer(f interface{}) {
+	fv := reflect.ValueOf(f)
+	t := fv.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 1 || t.IsVariadic() {
+		panic(fmt.Sprintf("equal: Transformer of %s, want func(T) U", t))
+	}
+	if o.transformers == nil {
+		o.transformers = make(map[reflect.Type]reflect.Value)
+	}
+	o.transformers[t.In(0)] = fv
+}
+
+// FilterFields registers ignore, which reports whether a field of the
+// struct type t should be left out of comparisons.
+func (o *Options) FilterFields(ignore func(t reflect.Type, f reflect.StructField) bool) {
+	o.filters = append(o.filters, ignore)
+}
+
+// IgnoreFields leaves out of comparisons the struct fields with the
+// given names. A name may be qualified by the name of its struct type,
+// as in "User.LastLogin", to ignore only that type's field.
+func (o *Options) IgnoreFields(names ...string) {
+	o.FilterFields(func(t reflect.Type, f reflect.StructField) bool {
+		for _, name := range names {
+			if name == f.Name || name == t.Name()+"."+f.Name {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// IgnoreTag leaves out of comparisons the struct fields whose tag has
+// the given key and whose value for it, up to any comma, is "-", as in
+// `equal:"-"` for IgnoreTag("equal").
+func (o *Options) IgnoreTag(key string) {
+	o.FilterFields(func(t reflect.Type, f reflect.StructField) bool {
+		v, ok := f.Tag.Lookup(key)
+		return ok && strings.Split(v, ",")[0] == "-"
+	})
+}
+
+// ignored reports whether field f of struct type t is left out.
+func (d *differ) ignored(t reflect.Type, f reflect.StructField) bool {
+	if d.opts.IgnoreUnexported && f.PkgPath != "" {
+		return true
+	}
+	for _, ignore := range d.opts.filters {
+		if ignore(t, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// custom compares x and y, of the same type, with a registered comparer
+// or transformer for their type, and reports whether it did.
+func (d *differ) custom(x, y reflect.Value, path string) bool {
+	t := x.Type()
+	skip := d.skip
+	d.skip = nil
+	if t == skip {
+		return false
+	}
+	cmp, isCmp := d.opts.comparers[t]
+	tr, isTr := d.opts.transformers[t]
+	if !isCmp && !isTr {
+		return false
+	}
+	xe, ok1 := exported(x)
+	ye, ok2 := exported(y)
+	if !ok1 || !ok2 {
+		return false // not callable; compare as usual
+	}
+	if isCmp {
+		if !cmp.Call([]reflect.Value{xe, ye})[0].Bool() {
+			d.report(path, x, y)
+		}
+		return true
+	}
+	xt := tr.Call([]reflect.Value{xe})[0]
+	yt := tr.Call([]reflect.Value{ye})[0]
+	if xt.Type() == t {
+		d.skip = t
+	}
+	d.diff(xt, yt, path)
+	d.skip = nil
+	return true
+}
+
+// exported returns a Value holding the same value as v that may be
+// passed to a function, or false if there is none.
+func exported(v reflect.Value) (reflect.Value, bool) {
+	if v.CanInterface() {
+		return v, true
+	}
+	if x := iface(v); x != nil {
+		if _, isValue := x.(reflect.Value); !isValue {
+			return reflect.ValueOf(x), true
+		}
+	}
+	return reflect.Value{}, false
+}
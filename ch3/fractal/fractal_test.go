@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func newView(t *testing.T, set, x, y string, zoom float64, size string, iter int) *view {
+	t.Helper()
+	v := &view{zoom: zoom, iter: iter, ss: 1, smooth: true}
+	if err := v.parse(set, x, y, "-0.4,0.6", size, "classic"); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestEscape(t *testing.T) {
+	v := newView(t, "mandelbrot", "0", "0", 1, "1x1", 100)
+	for _, test := range []struct {
+		p      complex128
+		inside bool
+	}{
+		{0, true},
+		{-1, true},
+		{complex(-0.12, 0.75), true},
+		{complex(2, 2), false},
+		{complex(0.5, 0.5), false},
+	} {
+		if mu, _ := v.escape(test.p); (mu < 0) != test.inside {
+			t.Errorf("escape(%v) = %g, want inside=%t", test.p, mu, test.inside)
+		}
+	}
+
+	v.kind = newton
+	for i, r := range roots {
+		if mu, root := v.escape(r * 1.1); mu < 0 || root != i {
+			t.Errorf("newton near root %v converged to root %d after %g iterations", r, root, mu)
+		}
+	}
+}
+
+// Big.Float arithmetic at float64 precision should agree with float64
+// arithmetic except for the odd pixel on a boundary.
+func TestBigMatchesFloat(t *testing.T) {
+	for _, set := range []string{"mandelbrot", "julia", "burningship"} {
+		v := newView(t, set, "-0.5", "-0.25", 2, "32x32", 100)
+		want := mustRender(t, v)
+		v.prec = 53
+		got := mustRender(t, v)
+		if d := diff(got, want); d > len(got.Pix)/4/50 {
+			t.Errorf("%s: big.Float and float64 renderings differ in %d pixels", set, d)
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	v := newView(t, "mandelbrot", "-0.5", "0", 1, "40x33", 50)
+	v.ss = 2
+	v.workers = 1
+	want := mustRender(t, v)
+	for _, n := range []int{2, 7, 64} {
+		v.workers = n
+		if d := diff(mustRender(t, v), want); d != 0 {
+			t.Errorf("%d workers: %d pixels differ from 1 worker", n, d)
+		}
+	}
+}
+
+// At a deep zoom, float64 cannot tell neighboring pixels apart, but
+// big.Float can.
+func TestDeepZoom(t *testing.T) {
+	v := newView(t, "mandelbrot", "-0.743643887037158704752191506114774",
+		"0.131825904205311970493132056385139", 1e17, "8x8", 12000)
+	if v.prec == 0 {
+		t.Fatalf("zoom 1e17 did not select big.Float arithmetic")
+	}
+	v.period = 64
+	deep := same(mustRender(t, v))
+	v.prec = 0
+	shallow := same(mustRender(t, v))
+	if deep*2 > shallow {
+		t.Errorf("%d pixels match their left neighbor with big.Float, %d with float64", deep, shallow)
+	}
+}
+
+func TestPalette(t *testing.T) {
+	p := palette{{0, 0, 0, 0xFF}, {200, 100, 0, 0xFF}}
+	for _, test := range []struct {
+		t    float64
+		want color.RGBA
+	}{
+		{0, p[0]},
+		{0.5, p[1]},
+		{0.25, color.RGBA{100, 50, 0, 0xFF}},
+		{0.75, color.RGBA{100, 50, 0, 0xFF}}, // back toward the first color
+		{1, p[0]},
+		{3.5, p[1]},
+		{-0.5, p[1]},
+	} {
+		if got := p.at(test.t); got != test.want {
+			t.Errorf("at(%g) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, args := range [][6]string{
+		{"cantor", "0", "0", "0,0", "8x8", "gray"},
+		{"mandelbrot", "zero", "0", "0,0", "8x8", "gray"},
+		{"mandelbrot", "0", "0", "0,0", "8", "gray"},
+		{"mandelbrot", "0", "0", "0,0", "0x8", "gray"},
+		{"julia", "0", "0", "i", "8x8", "gray"},
+		{"mandelbrot", "0", "0", "0,0", "8x8", "plaid"},
+	} {
+		v := &view{zoom: 1, iter: 10, ss: 1}
+		if err := v.parse(args[0], args[1], args[2], args[3], args[4], args[5]); err == nil {
+			t.Errorf("parse%q succeeded", args)
+		}
+	}
+	v := &view{kind: newton, zoom: 1e20, iter: 10, ss: 1}
+	if err := v.parse("newton", "0", "0", "0,0", "8x8", "gray"); err == nil {
+		t.Errorf("newton at zoom 1e20 succeeded")
+	}
+}
+
+func mustRender(t *testing.T, v *view) *image.RGBA {
+	t.Helper()
+	img, err := v.render(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func diff(a, b *image.RGBA) int {
+	n := 0
+	for i := 0; i < len(a.Pix); i += 4 {
+		if a.Pix[i] != b.Pix[i] || a.Pix[i+1] != b.Pix[i+1] || a.Pix[i+2] != b.Pix[i+2] {
+			n++
+		}
+	}
+	return n
+}
+
+// same returns the number of pixels of img the same color as their left neighbor.
+func same(img *image.RGBA) int {
+	n := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X + 1; x < b.Max.X; x++ {
+			if img.RGBAAt(x, y) == img.RGBAAt(x-1, y) {
+				n++
+			}
+		}
+	}
+	return n
+}
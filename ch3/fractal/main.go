@@ -0,0 +1,127 @@
+// The fractal command renders the Mandelbrot, Julia, burning-ship and
+// Newton fractals as PNG images.
+//
+// The view is given by its center, a zoom factor (at zoom 1 the image
+// is 4 units wide) and a size in pixels. Escape-time fractals are colored
+// by their normalized iteration count, cycling through a palette every
+// -period iterations; -ss averages several samples per pixel.
+//
+// Beyond a zoom of about 10^12 float64 can no longer tell neighboring
+// pixels apart, so the orbits are computed in big.Float arithmetic with
+// enough precision for the zoom, or with -prec bits if that is given.
+// The center may be written with as many digits as the zoom requires.
+//
+// With -http, fractal instead serves the fractal as a map to be explored
+// in a browser, rendering 256×256 tiles at /tiles/{z}/{x}/{y}.png on
+// demand. Level z divides the 4×4 square about the center into 2^z×2^z
+// tiles. At most -limit tiles render at once, the most recently used
+// -cache tiles are kept, and a tile whose request is abandoned, as when
+// the map is panned past it, stops rendering. Deep levels are slow, as
+// big.Float arithmetic is.
+//
+// Usage:
+//
+//	$ go run ./ch3/fractal > m.png
+//	$ go run ./ch3/fractal -set=julia -c=-0.8,0.156 -palette=fire > j.png
+//	$ go run ./ch3/fractal -x=-0.743643887037158704752 -y=0.131825904205311970493 -zoom=1e15 -iter=5000 > deep.png
+//	$ go run ./ch3/fractal -http=localhost:8000 -palette=ocean
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"image/png"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"runtime"
+)
+
+func main() {
+	var v view
+	var set, x, y, c, size, pal string
+	flag.StringVar(&set, "set", "mandelbrot", "fractal: mandelbrot, julia, burningship or newton")
+	flag.StringVar(&x, "x", "-0.5", "real part of the center")
+	flag.StringVar(&y, "y", "0", "imaginary part of the center")
+	flag.Float64Var(&v.zoom, "zoom", 1, "magnification; the image is 4/zoom units wide")
+	flag.StringVar(&size, "size", "1024x1024", "image size `WxH` in pixels")
+	flag.IntVar(&v.iter, "iter", 200, "maximum number of iterations")
+	flag.StringVar(&c, "c", "-0.4,0.6", "Julia set parameter `re,im`")
+	flag.StringVar(&pal, "palette", "classic", "color palette: "+fmt.Sprint(paletteNames()))
+	flag.Float64Var(&v.period, "period", 32, "iterations per palette cycle; 0 spreads the palette over -iter")
+	flag.BoolVar(&v.smooth, "smooth", true, "smooth coloring by normalized iteration count")
+	flag.IntVar(&v.ss, "ss", 1, "supersample `n`×n points per pixel")
+	flag.UintVar(&v.prec, "prec", 0, "big.Float precision in `bits` (default: as the zoom requires)")
+	flag.IntVar(&v.workers, "j", 0, "number of rendering goroutines (default one per CPU)")
+	addr := flag.String("http", "", "serve a map of the fractal on `address`")
+	cacheSize := flag.Int("cache", 4096, "number of tiles to cache")
+	limit := flag.Int("limit", runtime.NumCPU(), "number of tiles to render at once")
+	flag.Parse()
+
+	if err := v.parse(set, x, y, c, size, pal); err != nil {
+		fmt.Fprintf(os.Stderr, "fractal: %v\n", err)
+		os.Exit(2)
+	}
+	if *addr != "" {
+		if *cacheSize < 1 || *limit < 1 {
+			fmt.Fprintln(os.Stderr, "fractal: -cache and -limit must be positive")
+			os.Exit(2)
+		}
+		s := newTileServer(v, *cacheSize, *limit)
+		log.Printf("serving on http://%s/", *addr)
+		log.Fatal(http.ListenAndServe(*addr, s.handler()))
+	}
+
+	img, err := v.render(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "fractal: %v\n", err)
+		os.Exit(1)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if err := png.Encode(out, img); err != nil {
+		fmt.Fprintf(os.Stderr, "fractal: %v\n", err)
+		os.Exit(1)
+	}
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "fractal: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parse fills in the fields of v given by the string flags and checks
+// the result.
+func (v *view) parse(set, x, y, c, size, pal string) error {
+	var err error
+	if v.kind, err = parseKind(set); err != nil {
+		return err
+	}
+	if v.pal, err = parsePalette(pal); err != nil {
+		return err
+	}
+	if _, err := fmt.Sscanf(size, "%dx%d", &v.width, &v.height); err != nil {
+		return fmt.Errorf("invalid size %q: want WxH", size)
+	}
+	var re, im float64
+	if _, err := fmt.Sscanf(c, "%g,%g", &re, &im); err != nil {
+		return fmt.Errorf("invalid Julia parameter %q: want re,im", c)
+	}
+	v.c = complex(re, im)
+	if v.prec == 0 {
+		v.prec = v.autoPrec()
+	}
+	// Parse the center with enough precision for its digits to count.
+	prec := v.prec
+	if prec < 53 {
+		prec = 53
+	}
+	if v.x, _, err = big.ParseFloat(x, 10, prec, big.ToNearestEven); err != nil {
+		return fmt.Errorf("invalid center x %q", x)
+	}
+	if v.y, _, err = big.ParseFloat(y, 10, prec, big.ToNearestEven); err != nil {
+		return fmt.Errorf("invalid center y %q", y)
+	}
+	return v.check()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// A palette is a cyclic gradient through a sequence of colors.
+type palette []color.RGBA
+
+var palettes = map[string]palette{
+	"classic": {{0, 7, 100, 0xFF}, {32, 107, 203, 0xFF}, {237, 255, 255, 0xFF}, {255, 170, 0, 0xFF}, {0, 2, 0, 0xFF}},
+	"fire":    {{0, 0, 0, 0xFF}, {128, 0, 0, 0xFF}, {255, 64, 0, 0xFF}, {255, 200, 0, 0xFF}, {255, 255, 224, 0xFF}},
+	"ocean":   {{0, 16, 32, 0xFF}, {0, 64, 128, 0xFF}, {0, 160, 192, 0xFF}, {192, 240, 255, 0xFF}},
+	"gray":    {{0, 0, 0, 0xFF}, {255, 255, 255, 0xFF}},
+	"rainbow": {{255, 0, 0, 0xFF}, {255, 255, 0, 0xFF}, {0, 255, 0, 0xFF}, {0, 255, 255, 0xFF}, {0, 0, 255, 0xFF}, {255, 0, 255, 0xFF}},
+}
+
+func parsePalette(name string) (palette, error) {
+	p, ok := palettes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown palette %q (have %v)", name, paletteNames())
+	}
+	return p, nil
+}
+
+func paletteNames() []string {
+	var names []string
+	for name := range palettes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// at returns the color a fraction t of the way around the palette,
+// interpolating linearly between its colors. Only the fractional part
+// of t matters, so the last color blends back into the first.
+func (p palette) at(t float64) color.RGBA {
+	t -= math.Floor(t)
+	f := t * float64(len(p))
+	i := int(f)
+	f -= float64(i)
+	if i >= len(p) { // t rounded up to 1
+		i, f = 0, 0
+	}
+	a, b := p[i], p[(i+1)%len(p)]
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x) + (float64(y)-float64(x))*f + 0.5)
+	}
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xFF}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"math/big"
+	"math/cmplx"
+	"runtime"
+	"sync"
+)
+
+// A kind is a family of fractals.
+type kind int
+
+const (
+	mandelbrot kind = iota
+	julia
+	burningShip
+	newton
+)
+
+var kindNames = [...]string{
+	mandelbrot:  "mandelbrot",
+	julia:       "julia",
+	burningShip: "burningship",
+	newton:      "newton",
+}
+
+func (k kind) String() string { return kindNames[k] }
+
+func parseKind(s string) (kind, error) {
+	for k, name := range kindNames {
+		if s == name {
+			return kind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown fractal %q", s)
+}
+
+// A view describes the image of a fractal to render.
+//
+// The center is held as a pair of big.Floats so that it can be given to
+// more digits than a float64 holds. At zoom 1 the image is 4 units wide.
+type view struct {
+	kind          kind
+	x, y          *big.Float // center
+	zoom          float64
+	width, height int
+	iter          int        // maximum number of iterations
+	c             complex128 // Julia set parameter
+	pal           palette
+	period        float64 // iterations per palette cycle; 0 for iter
+	smooth        bool    // color by normalized iteration count
+	ss            int     // samples per pixel along each axis
+	prec          uint    // mantissa bits for big.Float arithmetic; 0 for float64
+	workers       int
+}
+
+// bailout is the escape radius. It is much larger than the minimal 2
+// so that the normalized iteration count varies smoothly.
+const bailout = 256
+
+// Newton's method is applied to z³-1, whose roots are these.
+var roots = [3]complex128{1, complex(-0.5, math.Sqrt(3)/2), complex(-0.5, -math.Sqrt(3)/2)}
+
+// autoPrec returns the number of mantissa bits needed to distinguish
+// the pixels of v, or 0 if float64 arithmetic suffices.
+//
+// big.Rat would also do, but its numerators double in length with every
+// squaring, so big.Float's fixed precision is the only practical choice.
+func (v *view) autoPrec() uint {
+	bits := math.Log2(v.zoom * float64(v.width))
+	if bits <= 40 {
+		return 0
+	}
+	return uint(bits) + 32
+}
+
+// check reports whether v can be rendered.
+func (v *view) check() error {
+	switch {
+	case v.width <= 0 || v.height <= 0:
+		return fmt.Errorf("invalid size %dx%d", v.width, v.height)
+	case v.iter <= 0:
+		return fmt.Errorf("invalid iteration count %d", v.iter)
+	case !(v.zoom > 0) || math.IsInf(v.zoom, 0):
+		return fmt.Errorf("invalid zoom %g", v.zoom)
+	case v.ss < 1 || v.ss > 8:
+		return fmt.Errorf("supersampling %d out of range 1-8", v.ss)
+	case v.prec > 0 && v.kind == newton:
+		return fmt.Errorf("the newton fractal has no arbitrary precision mode")
+	}
+	return nil
+}
+
+// render computes the image described by v, dividing its rows among
+// v.workers goroutines, or one per CPU if v.workers is 0. It gives up,
+// returning ctx.Err(), if ctx is cancelled first.
+func (v *view) render(ctx context.Context) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, v.width, v.height))
+	workers := v.workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	rowsPerWorker := (v.height + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < v.height; start += rowsPerWorker {
+		end := start + rowsPerWorker
+		if end > v.height {
+			end = v.height
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			r := v.newRow()
+			for py := start; py < end && ctx.Err() == nil; py++ {
+				r.render(img, py)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// A row renders rows of pixels. Each goroutine has its own, since
+// the big.Float arithmetic needs scratch space.
+type row struct {
+	v      *view
+	cx, cy float64 // center, in float64 mode
+	scale  float64 // size of a pixel
+	big    *bigState
+}
+
+func (v *view) newRow() *row {
+	r := &row{v: v, scale: 4 / (v.zoom * float64(v.width))}
+	if v.prec > 0 {
+		r.big = newBigState(v)
+	} else {
+		r.cx, _ = v.x.Float64()
+		r.cy, _ = v.y.Float64()
+	}
+	return r
+}
+
+// render sets the pixels of row py of img, averaging v.ss×v.ss samples
+// per pixel.
+func (r *row) render(img *image.RGBA, py int) {
+	v := r.v
+	n := uint32(v.ss * v.ss)
+	for px := 0; px < v.width; px++ {
+		var sr, sg, sb uint32
+		for i := 0; i < v.ss; i++ {
+			for j := 0; j < v.ss; j++ {
+				dx := (float64(px-v.width/2) + (float64(j)+0.5)/float64(v.ss)) * r.scale
+				dy := -(float64(py-v.height/2) + (float64(i)+0.5)/float64(v.ss)) * r.scale
+				var mu float64
+				var root int
+				if r.big != nil {
+					mu = r.big.escape(dx, dy)
+				} else {
+					mu, root = v.escape(complex(r.cx+dx, r.cy+dy))
+				}
+				c := v.color(mu, root)
+				sr += uint32(c.R)
+				sg += uint32(c.G)
+				sb += uint32(c.B)
+			}
+		}
+		img.SetRGBA(px, py, color.RGBA{
+			uint8((sr + n/2) / n), uint8((sg + n/2) / n), uint8((sb + n/2) / n), 0xFF,
+		})
+	}
+}
+
+// escape returns the normalized iteration count at which the orbit of p
+// escapes, or -1 if it does not within v.iter iterations. For the Newton
+// fractal it also returns the index of the root to which p converges.
+func (v *view) escape(p complex128) (mu float64, root int) {
+	if v.kind == newton {
+		return v.converge(p)
+	}
+	z, c := complex(0, 0), p
+	if v.kind == julia {
+		z, c = p, v.c
+	}
+	for n := 0; n < v.iter; n++ {
+		if v.kind == burningShip {
+			z = complex(math.Abs(real(z)), math.Abs(imag(z)))
+		}
+		z = z*z + c
+		if r2 := real(z)*real(z) + imag(z)*imag(z); r2 > bailout*bailout {
+			return normalize(n, r2), 0
+		}
+	}
+	return -1, 0
+}
+
+// normalize returns the smooth iteration count for an orbit that
+// escaped at iteration n with squared modulus r2.
+func normalize(n int, r2 float64) float64 {
+	return float64(n) + 1 - math.Log2(math.Log(r2)/2)
+}
+
+// converge applies Newton's method to z³-1 starting at p and returns
+// the iteration count and root at which it converges.
+func (v *view) converge(z complex128) (mu float64, root int) {
+	const eps = 1e-6
+	for n := 0; n < v.iter; n++ {
+		z -= (z*z*z - 1) / (3 * z * z)
+		for i, r := range roots {
+			if d := cmplx.Abs(z - r); d < eps {
+				return float64(n), i
+			}
+		}
+	}
+	return -1, 0
+}
+
+// color returns the color of a sample with the given escape count and root.
+func (v *view) color(mu float64, root int) color.RGBA {
+	if mu < 0 {
+		return color.RGBA{0, 0, 0, 0xFF}
+	}
+	if !v.smooth {
+		mu = math.Floor(mu)
+	}
+	if v.kind == newton {
+		// Each root has its own hue, darkening with the iteration count.
+		c := v.pal.at(float64(root) / 3)
+		shade := math.Pow(0.9, mu)
+		return color.RGBA{
+			uint8(float64(c.R) * shade), uint8(float64(c.G) * shade), uint8(float64(c.B) * shade), 0xFF,
+		}
+	}
+	period := v.period
+	if period <= 0 {
+		period = float64(v.iter)
+	}
+	return v.pal.at(mu / period)
+}
+
+// A bigState holds the center of a view and scratch space for
+// iterating in big.Float arithmetic.
+type bigState struct {
+	v                   *view
+	cx, cy              *big.Float
+	zr, zi, cr, ci      *big.Float
+	zr2, zi2, t, dx, dy *big.Float
+}
+
+func newBigState(v *view) *bigState {
+	f := func() *big.Float { return new(big.Float).SetPrec(v.prec) }
+	return &bigState{
+		v: v, cx: f().Set(v.x), cy: f().Set(v.y),
+		zr: f(), zi: f(), cr: f(), ci: f(),
+		zr2: f(), zi2: f(), t: f(), dx: f(), dy: f(),
+	}
+}
+
+// escape is like view.escape for the point at offset (dx, dy) from the
+// center, but computes the orbit in big.Float arithmetic. The offset
+// itself fits in a float64; it is the sum that needs the precision.
+func (s *bigState) escape(dx, dy float64) float64 {
+	v := s.v
+	s.dx.SetFloat64(dx)
+	s.dy.SetFloat64(dy)
+	px := s.zr.Add(s.cx, s.dx)
+	py := s.zi.Add(s.cy, s.dy)
+	if v.kind == julia {
+		s.cr.SetFloat64(real(v.c))
+		s.ci.SetFloat64(imag(v.c))
+	} else {
+		s.cr.Set(px)
+		s.ci.Set(py)
+		s.zr.SetInt64(0)
+		s.zi.SetInt64(0)
+	}
+	for n := 0; ; n++ {
+		s.zr2.Mul(s.zr, s.zr)
+		s.zi2.Mul(s.zi, s.zi)
+		if n > 0 {
+			// The modulus is of ordinary size, so a float64 will do to test it.
+			if r2, _ := s.t.Add(s.zr2, s.zi2).Float64(); r2 > bailout*bailout {
+				return normalize(n-1, r2)
+			}
+		}
+		if n == v.iter {
+			break
+		}
+		if v.kind == burningShip {
+			s.zr.Abs(s.zr)
+			s.zi.Abs(s.zi)
+		}
+		s.t.Mul(s.zr, s.zi)
+		s.zi.Add(s.t, s.t).Add(s.zi, s.ci)
+		s.zr.Sub(s.zr2, s.zi2).Add(s.zr, s.cr)
+	}
+	return -1
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	_ "embed"
+	"image/png"
+	"log"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	tileSize = 256
+	maxZoom  = 46 // deepest level at which the page's float64 coordinates resolve pixels
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// A tileServer serves the fractal described by its base view as a
+// slippy map: /tiles/z/x/y.png is the tile in column x and row y of the
+// 2^z×2^z grid that covers the 4×4 square about the base view's center.
+type tileServer struct {
+	base  view
+	cache *lru
+	sema  chan struct{} // limits the number of tiles rendering at once
+}
+
+func newTileServer(base view, cacheSize, limit int) *tileServer {
+	return &tileServer{base: base, cache: newLRU(cacheSize), sema: make(chan struct{}, limit)}
+}
+
+func (s *tileServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.index)
+	mux.HandleFunc("/tiles/", s.tile)
+	return mux
+}
+
+func (s *tileServer) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *tileServer) tile(w http.ResponseWriter, r *http.Request) {
+	z, x, y, ok := parseTile(strings.TrimPrefix(r.URL.Path, "/tiles/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	key := strconv.Itoa(z) + "/" + strconv.Itoa(x) + "/" + strconv.Itoa(y)
+	data, ok := s.cache.get(key)
+	if !ok {
+		// Wait for a turn to render, unless the client gives up first.
+		ctx := r.Context()
+		select {
+		case s.sema <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		img, err := s.view(z, x, y).render(ctx)
+		<-s.sema
+		if err != nil {
+			return // abandoned; there is no one to reply to
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data = buf.Bytes()
+		s.cache.add(key, data)
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if _, err := w.Write(data); err != nil {
+		log.Print(err)
+	}
+}
+
+// parseTile parses a tile path of the form z/x/y.png.
+func parseTile(path string) (z, x, y int, ok bool) {
+	if !strings.HasSuffix(path, ".png") {
+		return 0, 0, 0, false
+	}
+	parts := strings.Split(strings.TrimSuffix(path, ".png"), "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, false
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return 0, 0, 0, false
+		}
+		n[i] = v
+	}
+	z, x, y = n[0], n[1], n[2]
+	if z > maxZoom || x >= 1<<z || y >= 1<<z {
+		return 0, 0, 0, false
+	}
+	return z, x, y, true
+}
+
+// view returns the view of tile x, y at level z. Each tile renders on
+// a single goroutine, since tiles are rendered concurrently, and deeper
+// tiles get more iterations, as points near the boundary need them.
+// Newton tiles stay in float64 arithmetic, and pixelate beyond level 32.
+func (s *tileServer) view(z, x, y int) *view {
+	v := s.base
+	v.zoom = math.Ldexp(1, z)
+	v.width, v.height = tileSize, tileSize
+	v.iter = s.base.iter + 40*z
+	v.workers = 1
+	if p := v.autoPrec(); p > v.prec && v.kind != newton {
+		v.prec = p
+	}
+
+	// The center of the tile is (2x+1-2^z)/2^(z-1) units from the
+	// center of the map, which is exact in binary.
+	prec := v.prec
+	if prec < 64+uint(z) {
+		prec = 64 + uint(z)
+	}
+	offset := func(i int) *big.Float {
+		f := new(big.Float).SetPrec(prec).SetInt64(int64(2*i+1) - 1<<z)
+		return f.SetMantExp(f, 1-z)
+	}
+	v.x = new(big.Float).SetPrec(prec).Add(s.base.x, offset(x))
+	v.y = new(big.Float).SetPrec(prec).Sub(s.base.y, offset(y))
+	return &v
+}
+
+// An lru is a cache of encoded tiles that, when full, discards the
+// least recently used one. It is safe for concurrent use.
+type lru struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List // of *entry, most recently used first
+	items map[string]*list.Element
+}
+
+type entry struct {
+	key  string
+	data []byte
+}
+
+func newLRU(max int) *lru {
+	return &lru{max: max, ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lru) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*entry).data, true
+}
+
+func (c *lru) add(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*entry).data = data
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key, data})
+	for c.ll.Len() > c.max {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*entry).key)
+	}
+}
+
+func (c *lru) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
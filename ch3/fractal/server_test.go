@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *tileServer {
+	v := newView(t, "mandelbrot", "-0.5", "0", 1, "1x1", 20)
+	return newTileServer(*v, 4, 2)
+}
+
+func get(t *testing.T, url string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestTiles(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.handler())
+	defer ts.Close()
+
+	if code, body := get(t, ts.URL+"/"); code != http.StatusOK || !strings.Contains(string(body), "/tiles/") {
+		t.Errorf("GET / = %d %.40q", code, body)
+	}
+
+	code, tile := get(t, ts.URL+"/tiles/1/0/1.png")
+	if code != http.StatusOK {
+		t.Fatalf("GET tile = %d %s", code, tile)
+	}
+	img, err := png.Decode(bytes.NewReader(tile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != tileSize || b.Dy() != tileSize {
+		t.Errorf("tile is %v, want %dx%[2]d", b, tileSize)
+	}
+	if n := s.cache.len(); n != 1 {
+		t.Errorf("%d tiles cached after one request", n)
+	}
+	if _, again := get(t, ts.URL+"/tiles/1/0/1.png"); !bytes.Equal(again, tile) {
+		t.Errorf("second request returned a different tile")
+	}
+
+	for _, path := range []string{
+		"/tiles/1/2/0.png",
+		"/tiles/1/0/2.png",
+		"/tiles/0/0/0.jpg",
+		"/tiles/0/0.png",
+		"/tiles/0/0/0/0.png",
+		"/tiles/a/0/0.png",
+		"/tiles/0/-1/0.png",
+		"/tiles/47/0/0.png",
+		"/favicon.ico",
+	} {
+		if code, _ := get(t, ts.URL+path); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, code)
+		}
+	}
+}
+
+func TestTileView(t *testing.T) {
+	s := newTestServer(t)
+	for _, test := range []struct {
+		z, x, y int
+		cx, cy  float64
+	}{
+		{0, 0, 0, -0.5, 0},
+		{1, 0, 0, -1.5, 1},
+		{1, 1, 1, 0.5, -1},
+		{2, 3, 0, 1, 1.5},
+	} {
+		v := s.view(test.z, test.x, test.y)
+		cx, _ := v.x.Float64()
+		cy, _ := v.y.Float64()
+		if cx != test.cx || cy != test.cy || v.prec != 0 {
+			t.Errorf("tile %d/%d/%d: center (%g, %g) prec %d, want (%g, %g) prec 0",
+				test.z, test.x, test.y, cx, cy, v.prec, test.cx, test.cy)
+		}
+	}
+
+	// Deep tiles need big.Float arithmetic, and the last tile's center
+	// is a tile's half-width short of the edge.
+	z := maxZoom
+	v := s.view(z, 1<<z-1, 0)
+	if v.prec == 0 {
+		t.Fatalf("level %d tile uses float64", z)
+	}
+	want := new(big.Float).SetInt64(3<<(z-2) - 1)
+	want.SetMantExp(want, 1-z) // 1.5 - 2^(1-z)
+	if v.x.Cmp(want) != 0 {
+		t.Errorf("level %d last tile center x = %s, want %s", z, v.x.Text('g', 30), want.Text('g', 30))
+	}
+}
+
+// An abandoned request renders nothing.
+func TestAbandoned(t *testing.T) {
+	s := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest("GET", "/tiles/0/0/0.png", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, req)
+	if w.Body.Len() != 0 || s.cache.len() != 0 {
+		t.Errorf("cancelled request wrote %d bytes and cached %d tiles", w.Body.Len(), s.cache.len())
+	}
+
+	// A request waiting for its turn gives up too.
+	for i := 0; i < cap(s.sema); i++ {
+		s.sema <- struct{}{}
+	}
+	w = httptest.NewRecorder()
+	s.handler().ServeHTTP(w, req)
+	if w.Body.Len() != 0 {
+		t.Errorf("waiting cancelled request wrote %d bytes", w.Body.Len())
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2)
+	c.add("a", []byte("1"))
+	c.add("b", []byte("2"))
+	c.get("a")
+	c.add("c", []byte("3")) // evicts b, the least recently used
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, ok := c.get(key); ok != want {
+			t.Errorf("get(%q) found = %t, want %t", key, ok, want)
+		}
+	}
+	c.add("a", []byte("4"))
+	if data, _ := c.get("a"); string(data) != "4" || c.len() != 2 {
+		t.Errorf("after replacing a: get = %q, len = %d", data, c.len())
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// writeOBJ writes m in Wavefront OBJ format, with vertex normals.
+func writeOBJ(w io.Writer, m *mesh) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %d vertices, %d triangles\n", len(m.verts), 2*len(m.quads))
+	for _, v := range m.verts {
+		fmt.Fprintf(bw, "v %g %g %g\n", v[0], v[1], v[2])
+	}
+	for _, n := range m.normals {
+		fmt.Fprintf(bw, "vn %.6g %.6g %.6g\n", n[0], n[1], n[2])
+	}
+	for _, t := range m.triangles() {
+		a, b, c := t[0]+1, t[1]+1, t[2]+1 // OBJ indices start at 1
+		fmt.Fprintf(bw, "f %d//%d %d//%d %d//%d\n", a, a, b, b, c, c)
+	}
+	return bw.Flush()
+}
+
+// writeSTL writes the triangles of m in binary STL format.
+func writeSTL(w io.Writer, m *mesh) error {
+	bw := bufio.NewWriter(w)
+	tris := m.triangles()
+	var header [80]byte
+	copy(header[:], "binary STL written by gopl.io/ch3/mesh")
+	bw.Write(header[:])
+	binary.Write(bw, binary.LittleEndian, uint32(len(tris)))
+	for _, t := range tris {
+		a, b, c := m.verts[t[0]], m.verts[t[1]], m.verts[t[2]]
+		rec := [12]float32{}
+		n := b.sub(a).cross(c.sub(a)).unit()
+		for i, v := range [4]vec{n, a, b, c} {
+			for j := range v {
+				rec[3*i+j] = float32(v[j])
+			}
+		}
+		binary.Write(bw, binary.LittleEndian, rec)
+		binary.Write(bw, binary.LittleEndian, uint16(0)) // attribute byte count
+	}
+	return bw.Flush()
+}
+
+// glTF 2.0 constants.
+const (
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+	gltfTriangles    = 4
+)
+
+type gltfDoc struct {
+	Asset       map[string]string `json:"asset"`
+	Scene       int               `json:"scene"`
+	Scenes      []gltfScene       `json:"scenes"`
+	Nodes       []gltfNode        `json:"nodes"`
+	Meshes      []gltfMesh        `json:"meshes"`
+	Buffers     []gltfBuffer      `json:"buffers"`
+	BufferViews []gltfBufferView  `json:"bufferViews"`
+	Accessors   []gltfAccessor    `json:"accessors"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Mesh int `json:"mesh"`
+}
+
+type gltfMesh struct {
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Mode       int            `json:"mode"`
+}
+
+type gltfBuffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+// writeGLTF writes m as a self-contained glTF 2.0 file, whose binary
+// data is embedded as a base64 data URI. As glTF requires, +y is up,
+// so the surface's z axis becomes y.
+func writeGLTF(w io.Writer, m *mesh) error {
+	yUp := func(v vec) [3]float32 { return [3]float32{float32(v[0]), float32(v[2]), float32(-v[1])} }
+
+	var buf bytes.Buffer
+	min := [3]float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	max := [3]float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	for _, v := range m.verts {
+		p := yUp(v)
+		for i := range p {
+			min[i] = float32(math.Min(float64(min[i]), float64(p[i])))
+			max[i] = float32(math.Max(float64(max[i]), float64(p[i])))
+		}
+		binary.Write(&buf, binary.LittleEndian, p)
+	}
+	posLen := buf.Len()
+	for _, n := range m.normals {
+		binary.Write(&buf, binary.LittleEndian, yUp(n))
+	}
+	normLen := buf.Len() - posLen
+	tris := m.triangles()
+	for _, t := range tris {
+		for _, i := range t {
+			binary.Write(&buf, binary.LittleEndian, uint32(i))
+		}
+	}
+	idxLen := buf.Len() - posLen - normLen
+
+	doc := gltfDoc{
+		Asset:  map[string]string{"version": "2.0", "generator": "gopl.io/ch3/mesh"},
+		Scenes: []gltfScene{{Nodes: []int{0}}},
+		Nodes:  []gltfNode{{Mesh: 0}},
+		Meshes: []gltfMesh{{Primitives: []gltfPrimitive{{
+			Attributes: map[string]int{"POSITION": 0, "NORMAL": 1},
+			Indices:    2,
+			Mode:       gltfTriangles,
+		}}}},
+		Buffers: []gltfBuffer{{
+			ByteLength: buf.Len(),
+			URI:        "data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		}},
+		BufferViews: []gltfBufferView{
+			{0, 0, posLen, gltfArrayBuffer},
+			{0, posLen, normLen, gltfArrayBuffer},
+			{0, posLen + normLen, idxLen, gltfElementArray},
+		},
+		Accessors: []gltfAccessor{
+			{BufferView: 0, ComponentType: gltfFloat, Count: len(m.verts), Type: "VEC3", Min: min[:], Max: max[:]},
+			{BufferView: 1, ComponentType: gltfFloat, Count: len(m.normals), Type: "VEC3"},
+			{BufferView: 2, ComponentType: gltfUnsignedInt, Count: 3 * len(tris), Type: "SCALAR"},
+		},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
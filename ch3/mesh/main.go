@@ -0,0 +1,112 @@
+// Mesh samples a surface function on the grid that gopl.io/ch3/surface
+// uses and writes it as a shaded SVG drawing or as a 3-D model in
+// Wavefront OBJ, binary STL or glTF format.
+//
+// The SVG drawing views the surface from a camera at the given azimuth
+// and elevation, draws its cells back to front, and shades each by the
+// angle between its normal and the light (Lambert's law). Cells at
+// which the function is NaN or infinite, such as the cell at the
+// origin of sin(r)/r, are left out of every format.
+//
+// Usage:
+//
+//	$ go run ./ch3/mesh > sinc.svg
+//	$ go run ./ch3/mesh -f=eggbox -azimuth=20 -elevation=50 -color=height > eggbox.svg
+//	$ go run ./ch3/mesh -f=moguls -format=gltf > moguls.gltf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+var funcs = map[string]func(x, y float64) float64{
+	"sinc": func(x, y float64) float64 {
+		r := math.Hypot(x, y) // distance from (0,0)
+		return math.Sin(r) / r
+	},
+	"eggbox": func(x, y float64) float64 {
+		return 0.3 * (math.Sin(x) + math.Sin(y))
+	},
+	"moguls": func(x, y float64) float64 {
+		return 0.1*(math.Sin(x*0.5)*math.Cos(y*0.5)+math.Sin(x*0.8)*math.Cos(y*0.8)) +
+			0.05*math.Sin(x*2)
+	},
+	"saddle": func(x, y float64) float64 {
+		return (x*x - y*y) / 500
+	},
+}
+
+func main() {
+	name := flag.String("f", "sinc", "surface function: "+fmt.Sprint(funcNames()))
+	format := flag.String("format", "svg", "output format: svg, obj, stl or gltf")
+	cells := flag.Int("cells", 100, "number of grid cells along each axis")
+	xyrange := flag.Float64("xyrange", 30, "the grid covers -xyrange/2..+xyrange/2")
+	zscale := flag.Float64("zscale", 12.8, "vertical exaggeration (ch3/surface's is 12.8)")
+	width := flag.Int("width", 600, "SVG canvas width in pixels")
+	height := flag.Int("height", 320, "SVG canvas height in pixels")
+	azimuth := flag.Float64("azimuth", 45, "SVG camera azimuth in degrees, clockwise from +y")
+	elevation := flag.Float64("elevation", 30, "SVG camera elevation in degrees")
+	lightAz := flag.Float64("light-azimuth", 0, "light azimuth in degrees")
+	lightEl := flag.Float64("light-elevation", 60, "light elevation in degrees")
+	colorBy := flag.String("color", "white", "SVG cell color: white or height")
+	stroke := flag.String("stroke", "grey", "SVG cell outline color, or none")
+	flag.Parse()
+
+	f, ok := funcs[*name]
+	if !ok {
+		fatalf("unknown function %q", *name)
+	}
+	if *cells < 1 || *cells > 2000 {
+		fatalf("cells %d out of range 1-2000", *cells)
+	}
+	if *colorBy != "white" && *colorBy != "height" {
+		fatalf("unknown color %q", *colorBy)
+	}
+	m := newMesh(f, *cells, *xyrange, *zscale)
+
+	var err error
+	switch *format {
+	case "svg":
+		const deg = math.Pi / 180
+		cam := &camera{
+			azimuth:   *azimuth * deg,
+			elevation: *elevation * deg,
+			light:     direction(*lightAz*deg, *lightEl*deg),
+			width:     *width,
+			height:    *height,
+		}
+		err = writeSVG(os.Stdout, m, cam, *colorBy == "height", *stroke)
+	case "obj", "stl", "gltf":
+		err = writers[*format](os.Stdout, m)
+	default:
+		fatalf("unknown format %q", *format)
+	}
+	if err != nil {
+		fatalf("%v", err)
+	}
+}
+
+var writers = map[string]func(io.Writer, *mesh) error{
+	"obj":  writeOBJ,
+	"stl":  writeSTL,
+	"gltf": writeGLTF,
+}
+
+func funcNames() []string {
+	var names []string
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "mesh: "+format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,117 @@
+package main
+
+import "math"
+
+// A vec is a point or direction in 3-D space.
+type vec [3]float64
+
+func (a vec) add(b vec) vec       { return vec{a[0] + b[0], a[1] + b[1], a[2] + b[2]} }
+func (a vec) sub(b vec) vec       { return vec{a[0] - b[0], a[1] - b[1], a[2] - b[2]} }
+func (a vec) scale(k float64) vec { return vec{k * a[0], k * a[1], k * a[2]} }
+func (a vec) dot(b vec) float64   { return a[0]*b[0] + a[1]*b[1] + a[2]*b[2] }
+
+func (a vec) cross(b vec) vec {
+	return vec{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+// unit returns a scaled to length 1, or the zero vector if a is zero.
+func (a vec) unit() vec {
+	n := math.Sqrt(a.dot(a))
+	if n == 0 {
+		return vec{}
+	}
+	return a.scale(1 / n)
+}
+
+// A mesh is a surface made of quadrilateral cells.
+type mesh struct {
+	verts   []vec
+	normals []vec    // unit normal at each vertex, pointing up
+	quads   [][4]int // vertex indices, counterclockwise seen from above
+}
+
+// newMesh samples f on a grid of cells×cells cells at the same points
+// as gopl.io/ch3/surface does for the same xyrange, multiplying heights
+// by zscale. A cell with a corner at which f is NaN or infinite is left
+// out, leaving a hole.
+func newMesh(f func(x, y float64) float64, cells int, xyrange, zscale float64) *mesh {
+	n := cells + 1
+	z := make([]float64, n*n)
+	index := make([]int, n*n) // vertex index of each grid point, or -1
+	for i := range z {
+		x := xyrange * (float64(i/n)/float64(cells) - 0.5)
+		y := xyrange * (float64(i%n)/float64(cells) - 0.5)
+		z[i] = f(x, y) * zscale
+		index[i] = -1
+	}
+
+	m := new(mesh)
+	vertex := func(i, j int) int {
+		k := i*n + j
+		if index[k] < 0 {
+			index[k] = len(m.verts)
+			x := xyrange * (float64(i)/float64(cells) - 0.5)
+			y := xyrange * (float64(j)/float64(cells) - 0.5)
+			m.verts = append(m.verts, vec{x, y, z[k]})
+		}
+		return index[k]
+	}
+	finite := func(i, j int) bool {
+		v := z[i*n+j]
+		return !math.IsNaN(v) && !math.IsInf(v, 0)
+	}
+	for i := 0; i < cells; i++ {
+		for j := 0; j < cells; j++ {
+			if !finite(i, j) || !finite(i+1, j) || !finite(i+1, j+1) || !finite(i, j+1) {
+				continue
+			}
+			m.quads = append(m.quads, [4]int{vertex(i, j), vertex(i+1, j), vertex(i+1, j+1), vertex(i, j+1)})
+		}
+	}
+
+	// Each vertex normal is the mean of the normals of its cells.
+	m.normals = make([]vec, len(m.verts))
+	for _, q := range m.quads {
+		n := m.normal(q)
+		for _, v := range q {
+			m.normals[v] = m.normals[v].add(n)
+		}
+	}
+	for i, n := range m.normals {
+		if n = n.unit(); n == (vec{}) {
+			n = vec{0, 0, 1}
+		}
+		m.normals[i] = n
+	}
+	return m
+}
+
+// normal returns the unit normal of cell q, the cross product of its
+// diagonals, which suits cells that are not quite flat.
+func (m *mesh) normal(q [4]int) vec {
+	a, b, c, d := m.verts[q[0]], m.verts[q[1]], m.verts[q[2]], m.verts[q[3]]
+	return c.sub(a).cross(d.sub(b)).unit()
+}
+
+// triangles returns the cells of m each split into two triangles.
+func (m *mesh) triangles() [][3]int {
+	tris := make([][3]int, 0, 2*len(m.quads))
+	for _, q := range m.quads {
+		tris = append(tris, [3]int{q[0], q[1], q[2]}, [3]int{q[0], q[2], q[3]})
+	}
+	return tris
+}
+
+// bounds returns the least and greatest coordinates of m's vertices.
+func (m *mesh) bounds() (min, max vec) {
+	for i := range min {
+		min[i], max[i] = math.Inf(1), math.Inf(-1)
+	}
+	for _, v := range m.verts {
+		for i := range v {
+			min[i] = math.Min(min[i], v[i])
+			max[i] = math.Max(max[i], v[i])
+		}
+	}
+	return min, max
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMesh(t *testing.T) {
+	// sin(r)/r is NaN at the origin, a corner of four cells.
+	m := newMesh(funcs["sinc"], 100, 30, 1)
+	if got, want := len(m.quads), 100*100-4; got != want {
+		t.Errorf("sinc: %d cells, want %d", got, want)
+	}
+	if got, want := len(m.verts), 101*101-1; got != want {
+		t.Errorf("sinc: %d vertices, want %d", got, want)
+	}
+
+	// A surface with a hole and an infinite edge.
+	f := func(x, y float64) float64 {
+		switch {
+		case x*x+y*y < 2.25:
+			return math.NaN()
+		case x >= 5:
+			return math.Inf(1)
+		}
+		return 0
+	}
+	m = newMesh(f, 10, 10, 1)
+	for _, q := range m.quads {
+		for _, v := range q {
+			if z := m.verts[v][2]; z != 0 {
+				t.Fatalf("vertex %v of a kept cell has z = %g", m.verts[v], z)
+			}
+		}
+	}
+	// The grid is x, y = -5..5 in steps of 1; the NaN disk covers the 3×3
+	// points within distance 1.5 of the origin and so 16 cells, and x = 5
+	// spoils the last column of 10.
+	if got, want := len(m.quads), 100-16-10; got != want {
+		t.Errorf("holey surface: %d cells, want %d", got, want)
+	}
+	for i, n := range m.normals {
+		if n != (vec{0, 0, 1}) {
+			t.Errorf("flat surface normal %d = %v", i, n)
+		}
+	}
+}
+
+func TestNormals(t *testing.T) {
+	// On the plane z = x, every normal is (-1, 0, 1)/√2.
+	m := newMesh(func(x, y float64) float64 { return x }, 4, 4, 1)
+	want := vec{-1, 0, 1}.unit()
+	for i, n := range m.normals {
+		if d := n.sub(want); d.dot(d) > 1e-20 {
+			t.Errorf("normal %d = %v, want %v", i, n, want)
+		}
+	}
+}
+
+func TestShade(t *testing.T) {
+	cam := &camera{azimuth: 0, elevation: math.Pi / 4, light: vec{0, 0, 1}}
+	for _, test := range []struct {
+		n    vec
+		want float64
+	}{
+		{vec{0, 0, 1}, 1},
+		{vec{0, 0, -1}, 1}, // seen from below, lit from below
+		{vec{1, 0, 0}, ambient},
+		{vec{0, 1, 1}.unit(), ambient + diffuse*math.Sqrt(0.5)},
+	} {
+		if got := cam.shade(test.n); math.Abs(got-test.want) > 1e-12 {
+			t.Errorf("shade(%v) = %g, want %g", test.n, got, test.want)
+		}
+	}
+}
+
+// The painter's algorithm draws nearer cells later.
+func TestSVG(t *testing.T) {
+	m := newMesh(funcs["eggbox"], 20, 30, 12.8)
+	for _, az := range []float64{0, 45, 160, 270} {
+		cam := &camera{azimuth: az * math.Pi / 180, elevation: math.Pi / 6, light: vec{0, 0, 1}, width: 600, height: 320}
+		prev := math.Inf(1)
+		for _, i := range cam.paintOrder(m) {
+			d := 0.0
+			for _, v := range m.quads[i] {
+				_, _, dv := cam.project(m.verts[v])
+				d += dv / 4
+			}
+			if d > prev {
+				t.Fatalf("azimuth %g: cell at depth %g drawn after one at %g", az, d, prev)
+			}
+			prev = d
+		}
+
+		var buf bytes.Buffer
+		if err := writeSVG(&buf, m, cam, true, "grey"); err != nil {
+			t.Fatal(err)
+		}
+		if n := strings.Count(buf.String(), "<polygon"); n != len(m.quads) {
+			t.Errorf("azimuth %g: %d polygons, want %d", az, n, len(m.quads))
+		}
+	}
+}
+
+func TestSTL(t *testing.T) {
+	m := newMesh(funcs["saddle"], 8, 30, 1)
+	var buf bytes.Buffer
+	if err := writeSTL(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	n := binary.LittleEndian.Uint32(data[80:])
+	if n != uint32(2*len(m.quads)) || len(data) != 84+50*int(n) {
+		t.Fatalf("STL has %d triangles in %d bytes, want %d", n, len(data), 2*len(m.quads))
+	}
+	var rec [12]float32
+	binary.Read(bytes.NewReader(data[84:]), binary.LittleEndian, &rec)
+	if rec[2] <= 0 {
+		t.Errorf("first facet normal %v points down", rec[:3])
+	}
+}
+
+func TestOBJ(t *testing.T) {
+	m := newMesh(funcs["sinc"], 6, 30, 1)
+	var buf bytes.Buffer
+	if err := writeOBJ(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		counts[f[0]]++
+		if f[0] == "f" {
+			for _, ref := range f[1:] {
+				i, err := strconv.Atoi(strings.Split(ref, "//")[0])
+				if err != nil || i < 1 || i > len(m.verts) {
+					t.Fatalf("bad face %q", sc.Text())
+				}
+			}
+		}
+	}
+	if counts["v"] != len(m.verts) || counts["vn"] != len(m.verts) || counts["f"] != 2*len(m.quads) {
+		t.Errorf("OBJ counts %v, want %d vertices and %d faces", counts, len(m.verts), 2*len(m.quads))
+	}
+}
+
+func TestGLTF(t *testing.T) {
+	m := newMesh(funcs["moguls"], 5, 30, 1)
+	var buf bytes.Buffer
+	if err := writeGLTF(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	var doc gltfDoc
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	const prefix = "data:application/octet-stream;base64,"
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(doc.Buffers[0].URI, prefix))
+	if err != nil || len(data) != doc.Buffers[0].ByteLength {
+		t.Fatalf("buffer: %d bytes, error %v; want %d", len(data), err, doc.Buffers[0].ByteLength)
+	}
+	pos, idx := doc.Accessors[0], doc.Accessors[2]
+	if pos.Count != len(m.verts) || idx.Count != 6*len(m.quads) {
+		t.Errorf("accessor counts %d, %d", pos.Count, idx.Count)
+	}
+	if end := doc.BufferViews[2].ByteOffset + doc.BufferViews[2].ByteLength; end != len(data) {
+		t.Errorf("buffer views end at %d, buffer is %d bytes", end, len(data))
+	}
+	// y is up: the first vertex's height is its second coordinate.
+	var p [3]float32
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, &p)
+	if v := m.verts[0]; p != [3]float32{float32(v[0]), float32(v[2]), float32(-v[1])} {
+		t.Errorf("first position %v, vertex %v", p, v)
+	}
+	if pos.Min[1] > p[1] || pos.Max[1] < p[1] {
+		t.Errorf("bounds %v..%v exclude %v", pos.Min, pos.Max, p)
+	}
+}
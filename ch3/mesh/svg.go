@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// A camera is an orthographic view of a mesh. The viewer looks toward
+// the origin from the given azimuth, measured clockwise from the +y
+// axis as seen from above, and elevation above the xy plane. At
+// azimuth 45° and elevation 30°, the view resembles gopl.io/ch3/surface.
+type camera struct {
+	azimuth, elevation float64 // radians
+	light              vec     // unit vector toward the light
+	width, height      int     // canvas size in pixels
+}
+
+// direction returns the unit vector from the origin toward a viewer or
+// light at the given azimuth and elevation.
+func direction(azimuth, elevation float64) vec {
+	return vec{
+		math.Sin(azimuth) * math.Cos(elevation),
+		math.Cos(azimuth) * math.Cos(elevation),
+		math.Sin(elevation),
+	}
+}
+
+// project returns the position of v on the screen, before scaling, and
+// its depth, which increases away from the viewer.
+func (c *camera) project(v vec) (sx, sy, depth float64) {
+	sinA, cosA := math.Sin(c.azimuth), math.Cos(c.azimuth)
+	sinE, cosE := math.Sin(c.elevation), math.Cos(c.elevation)
+	right := v[0]*cosA - v[1]*sinA
+	toward := v[0]*sinA + v[1]*cosA // horizontal distance toward the viewer
+	return right, toward*sinE - v[2]*cosE, -(toward*cosE + v[2]*sinE)
+}
+
+// Lambert shading: the light reflected is proportional to the cosine
+// of the angle between the surface normal and the light.
+const (
+	ambient = 0.25
+	diffuse = 1 - ambient
+)
+
+// shade returns the brightness, from ambient to 1, of a cell with the
+// given unit normal. Cells seen from below are lit as if from below.
+func (c *camera) shade(n vec) float64 {
+	if n.dot(direction(c.azimuth, c.elevation)) < 0 {
+		n = n.scale(-1)
+	}
+	return ambient + diffuse*math.Max(0, n.dot(c.light))
+}
+
+// paintOrder returns the indices of the cells of m, farthest first, so
+// that drawing them in that order lets nearer cells hide farther ones
+// (the painter's algorithm). A cell's depth is that of its center.
+func (c *camera) paintOrder(m *mesh) []int {
+	depth := make([]float64, len(m.verts))
+	for i, v := range m.verts {
+		_, _, depth[i] = c.project(v)
+	}
+	order := make([]int, len(m.quads))
+	cellDepth := make([]float64, len(m.quads))
+	for i, q := range m.quads {
+		order[i] = i
+		cellDepth[i] = (depth[q[0]] + depth[q[1]] + depth[q[2]] + depth[q[3]]) / 4
+	}
+	sort.SliceStable(order, func(i, j int) bool { return cellDepth[order[i]] > cellDepth[order[j]] })
+	return order
+}
+
+// writeSVG draws the cells of m as polygons in paint order, each colored by its
+// mean height if byHeight, or else white, and shaded. If stroke is not
+// empty, it is the color of the cell outlines.
+func writeSVG(w io.Writer, m *mesh, cam *camera, byHeight bool, stroke string) error {
+	type point struct{ x, y float64 }
+	screen := make([]point, len(m.verts))
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for i, v := range m.verts {
+		x, y, _ := cam.project(v)
+		screen[i] = point{x, y}
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+
+	// Fit the projection to the canvas, less a margin.
+	const margin = 10
+	scale := math.Min(
+		float64(cam.width-2*margin)/(maxX-minX),
+		float64(cam.height-2*margin)/(maxY-minY))
+	if math.IsInf(scale, 0) || math.IsNaN(scale) {
+		scale = 1
+	}
+	offX := float64(cam.width)/2 - scale*(minX+maxX)/2
+	offY := float64(cam.height)/2 - scale*(minY+maxY)/2
+
+	min, max := m.bounds()
+	bw := bufio.NewWriter(w)
+	if stroke == "" {
+		stroke = "none"
+	}
+	fmt.Fprintf(bw, "<svg xmlns='http://www.w3.org/2000/svg' "+
+		"style='stroke: %s; stroke-width: 0.3' "+
+		"width='%d' height='%d'>\n", stroke, cam.width, cam.height)
+	for _, i := range cam.paintOrder(m) {
+		q := m.quads[i]
+		r, g, b := 1.0, 1.0, 1.0
+		if byHeight && max[2] > min[2] {
+			z := (m.verts[q[0]][2] + m.verts[q[1]][2] + m.verts[q[2]][2] + m.verts[q[3]][2]) / 4
+			t := (z - min[2]) / (max[2] - min[2])
+			r, g, b = t, 0.2, 1-t // blue valleys, red peaks
+		}
+		k := cam.shade(m.normal(q)) * 255
+		bw.WriteString("<polygon points='")
+		for n, v := range q {
+			if n > 0 {
+				bw.WriteByte(' ')
+			}
+			fmt.Fprintf(bw, "%.2f,%.2f", offX+scale*screen[v].x, offY+scale*screen[v].y)
+		}
+		fmt.Fprintf(bw, "' fill='#%02x%02x%02x'/>\n", uint8(r*k+0.5), uint8(g*k+0.5), uint8(b*k+0.5))
+	}
+	fmt.Fprintln(bw, "</svg>")
+	return bw.Flush()
+}
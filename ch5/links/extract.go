@@ -0,0 +1,160 @@
+package links
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A Kind classifies a link by the element that contains it.
+type Kind int
+
+const (
+	Anchor     Kind = iota // <a href>
+	Image                  // <img src>, <img srcset>, <source srcset>
+	Script                 // <script src>
+	Stylesheet             // <link href>
+	Frame                  // <iframe src>
+	Form                   // <form action>
+)
+
+var kindNames = [...]string{"anchor", "image", "script", "stylesheet", "frame", "form"}
+
+func (k Kind) String() string {
+	if k >= 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// A Link is a reference from an HTML document to another resource.
+type Link struct {
+	URL     string // absolute URL
+	Kind    Kind
+	Element string // e.g., "img"
+	Attr    string // e.g., "srcset"
+	Line    int    // 1-based line of the element's start tag
+}
+
+// linkAttrs maps each element to the attributes that hold its links.
+var linkAttrs = map[string]struct {
+	kind  Kind
+	attrs []string
+}{
+	"a":      {Anchor, []string{"href"}},
+	"img":    {Image, []string{"src", "srcset"}},
+	"source": {Image, []string{"src", "srcset"}},
+	"script": {Script, []string{"src"}},
+	"link":   {Stylesheet, []string{"href"}},
+	"iframe": {Frame, []string{"src"}},
+	"form":   {Form, []string{"action"}},
+}
+
+// ExtractFrom parses the HTML document read from r and returns the
+// links it contains, in document order. Relative URLs are resolved
+// against base or, if the document has one, against its first
+// <base href>, which applies to every link in the document, even
+// those that precede it. Values that cannot be parsed as URLs are
+// ignored.
+func ExtractFrom(r io.Reader, base *url.URL) ([]Link, error) {
+	if base == nil {
+		base = new(url.URL)
+	}
+	var (
+		links   []Link
+		refs    []string // unresolved URL of each link
+		docBase *url.URL
+	)
+	// resolve resolves the links against the document's base URL,
+	// known only once the document has been read, and drops those
+	// that are not URLs.
+	resolve := func() []Link {
+		if docBase != nil {
+			base = docBase
+		}
+		out := links[:0]
+		for i, link := range links {
+			u, err := base.Parse(refs[i])
+			if err != nil {
+				continue // ignore bad URLs
+			}
+			link.URL = u.String()
+			out = append(out, link)
+		}
+		return out
+	}
+	line := 1
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if err := z.Err(); err != io.EOF {
+				return resolve(), err
+			}
+			return resolve(), nil
+		}
+		start := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tok := z.Token()
+		if tok.Data == "base" {
+			if href, ok := attr(tok, "href"); ok && docBase == nil {
+				if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+					docBase = u
+				}
+			}
+			continue
+		}
+		la, ok := linkAttrs[tok.Data]
+		if !ok {
+			continue
+		}
+		for _, name := range la.attrs {
+			val, ok := attr(tok, name)
+			if !ok {
+				continue
+			}
+			vals := []string{val}
+			if name == "srcset" {
+				vals = parseSrcset(val)
+			}
+			for _, ref := range vals {
+				refs = append(refs, strings.TrimSpace(ref))
+				links = append(links, Link{
+					Kind:    la.kind,
+					Element: tok.Data,
+					Attr:    name,
+					Line:    start,
+				})
+			}
+		}
+	}
+}
+
+// attr returns the value of the named attribute of tok.
+func attr(tok html.Token, name string) (string, bool) {
+	for _, a := range tok.Attr {
+		if a.Key == name && a.Namespace == "" {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// parseSrcset returns the URLs of a srcset attribute such as
+// "small.jpg 480w, large.jpg 1080w", dropping the descriptors.
+func parseSrcset(s string) []string {
+	var urls []string
+	for _, cand := range strings.Split(s, ",") {
+		if fields := strings.Fields(cand); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
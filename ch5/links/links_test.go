@@ -0,0 +1,75 @@
+package links
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<link rel="stylesheet" href="style.css">
+<script src="/js/app.js"></script>
+</head>
+<body>
+<a href="about.html#team">About</a>
+<img src="logo.png"
+     srcset="logo-2x.png 2x, logo-3x.png 3x">
+<iframe src="https://example.org/embed"></iframe>
+<form action="search"><input name="q"></form>
+<script>var s = "<a href='not-a-link'>";</script>
+<base href="https://cdn.example.com/assets/">
+<img src=late.png>
+<base href="/ignored/">
+<img src=last.png>
+</body>
+</html>
+`
+
+func TestExtractFrom(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/index.html")
+	got, err := ExtractFrom(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Link{
+		// The first <base href> applies to the whole document.
+		{"https://cdn.example.com/assets/style.css", Stylesheet, "link", "href", 4},
+		{"https://cdn.example.com/js/app.js", Script, "script", "src", 5},
+		{"https://cdn.example.com/assets/about.html#team", Anchor, "a", "href", 8},
+		{"https://cdn.example.com/assets/logo.png", Image, "img", "src", 9},
+		{"https://cdn.example.com/assets/logo-2x.png", Image, "img", "srcset", 9},
+		{"https://cdn.example.com/assets/logo-3x.png", Image, "img", "srcset", 9},
+		{"https://example.org/embed", Frame, "iframe", "src", 11},
+		{"https://cdn.example.com/assets/search", Form, "form", "action", 12},
+		{"https://cdn.example.com/assets/late.png", Image, "img", "src", 15},
+		{"https://cdn.example.com/assets/last.png", Image, "img", "src", 17},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ExtractFrom returned %d links, want %d:\n%v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	got := strings.Join(parseSrcset(" a.jpg 480w,b.jpg  1080w , c.jpg"), " ")
+	if want := "a.jpg b.jpg c.jpg"; got != want {
+		t.Errorf("parseSrcset = %q, want %q", got, want)
+	}
+}
+
+func TestExtractFromWithoutBase(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/index.html")
+	got, err := ExtractFrom(strings.NewReader(`<a href="about.html">x</a> <a href="%zz">bad</a>`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].URL != "https://example.com/docs/about.html" {
+		t.Errorf("ExtractFrom = %+v, want one link to https://example.com/docs/about.html", got)
+	}
+}
@@ -8,7 +8,9 @@ package intset
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"math/bits"
 )
 
 //!+intset
@@ -71,3 +73,139 @@ func (s *IntSet) String() string {
 }
 
 //!-string
+
+// Len returns the number of elements in the set.
+func (s *IntSet) Len() int {
+	n := 0
+	for _, word := range s.words {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// Remove removes the non-negative value x from the set.
+func (s *IntSet) Remove(x int) {
+	word, bit := x/64, uint(x%64)
+	if word < len(s.words) {
+		s.words[word] &^= 1 << bit
+	}
+}
+
+// Clear removes all elements from the set.
+func (s *IntSet) Clear() {
+	s.words = nil
+}
+
+// Copy returns a copy of the set.
+func (s *IntSet) Copy() *IntSet {
+	return &IntSet{words: append([]uint64(nil), s.words...)}
+}
+
+// AddAll adds the non-negative values xs to the set.
+func (s *IntSet) AddAll(xs ...int) {
+	for _, x := range xs {
+		s.Add(x)
+	}
+}
+
+// IntersectWith sets s to the intersection of s and t.
+func (s *IntSet) IntersectWith(t *IntSet) {
+	if len(s.words) > len(t.words) {
+		s.words = s.words[:len(t.words)]
+	}
+	for i := range s.words {
+		s.words[i] &= t.words[i]
+	}
+}
+
+// DifferenceWith sets s to the difference of s and t, the elements of
+// s that are not in t.
+func (s *IntSet) DifferenceWith(t *IntSet) {
+	for i := range s.words {
+		if i < len(t.words) {
+			s.words[i] &^= t.words[i]
+		}
+	}
+}
+
+// SymmetricDifference sets s to the symmetric difference of s and t,
+// the elements that are in one set but not both.
+func (s *IntSet) SymmetricDifference(t *IntSet) {
+	for i, tword := range t.words {
+		if i < len(s.words) {
+			s.words[i] ^= tword
+		} else {
+			s.words = append(s.words, tword)
+		}
+	}
+}
+
+// Elems returns the elements of the set in increasing order.
+func (s *IntSet) Elems() []int {
+	elems := make([]int, 0, s.Len())
+	s.Range(func(x int) bool {
+		elems = append(elems, x)
+		return true
+	})
+	return elems
+}
+
+// Range calls f for each element of the set in increasing order,
+// stopping if f returns false.
+func (s *IntSet) Range(f func(x int) bool) {
+	for i, word := range s.words {
+		for word != 0 {
+			j := bits.TrailingZeros64(word)
+			if !f(64*i + j) {
+				return
+			}
+			word &^= 1 << uint(j)
+		}
+	}
+}
+
+// Min returns the least element of the set, or false if it is empty.
+func (s *IntSet) Min() (int, bool) {
+	for i, word := range s.words {
+		if word != 0 {
+			return 64*i + bits.TrailingZeros64(word), true
+		}
+	}
+	return 0, false
+}
+
+// Max returns the greatest element of the set, or false if it is empty.
+func (s *IntSet) Max() (int, bool) {
+	for i := len(s.words) - 1; i >= 0; i-- {
+		if word := s.words[i]; word != 0 {
+			return 64*i + 63 - bits.LeadingZeros64(word), true
+		}
+	}
+	return 0, false
+}
+
+// MarshalBinary encodes the set as its bit vector, in little-endian
+// 64-bit words, without trailing zero words.
+func (s *IntSet) MarshalBinary() ([]byte, error) {
+	n := len(s.words)
+	for n > 0 && s.words[n-1] == 0 {
+		n--
+	}
+	data := make([]byte, 8*n)
+	for i, word := range s.words[:n] {
+		binary.LittleEndian.PutUint64(data[8*i:], word)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary sets s to the set encoded by MarshalBinary.
+func (s *IntSet) UnmarshalBinary(data []byte) error {
+	if len(data)%8 != 0 {
+		return fmt.Errorf("intset: encoding of %d bytes is not whole words", len(data))
+	}
+	s.words = make([]uint64, len(data)/8)
+	for i := range s.words {
+		s.words[i] = binary.LittleEndian.Uint64(data[8*i:])
+	}
+	return nil
+}
@@ -3,7 +3,15 @@
 
 package intset
 
-import "fmt"
+import (
+	"encoding"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/quick"
+)
 
 func Example_one() {
 	//!+main
@@ -48,3 +56,238 @@ func Example_two() {
 	// {1 9 42 144}
 	// {[4398046511618 0 65536]}
 }
+
+var (
+	_ encoding.BinaryMarshaler   = new(IntSet)
+	_ encoding.BinaryUnmarshaler = new(IntSet)
+)
+
+// A model is the map that an IntSet should behave as.
+type model map[int]bool
+
+func (m model) elems() []int {
+	elems := []int{}
+	for x := range m {
+		elems = append(elems, x)
+	}
+	sort.Ints(elems)
+	return elems
+}
+
+// set returns an IntSet and its model with the elements of xs, kept
+// small so that sets overlap.
+func set(xs []uint16) (*IntSet, model) {
+	s, m := new(IntSet), model{}
+	for _, x := range xs {
+		s.Add(int(x % 1000))
+		m[int(x%1000)] = true
+	}
+	return s, m
+}
+
+func equal(s *IntSet, m model) bool {
+	elems := s.Elems()
+	if len(elems) == 0 {
+		elems = []int{}
+	}
+	return reflect.DeepEqual(elems, m.elems()) && s.Len() == len(m)
+}
+
+func TestProperties(t *testing.T) {
+	binary := map[string]struct {
+		op    func(s, t *IntSet)
+		model func(x, y bool) bool
+	}{
+		"UnionWith":           {(*IntSet).UnionWith, func(x, y bool) bool { return x || y }},
+		"IntersectWith":       {(*IntSet).IntersectWith, func(x, y bool) bool { return x && y }},
+		"DifferenceWith":      {(*IntSet).DifferenceWith, func(x, y bool) bool { return x && !y }},
+		"SymmetricDifference": {(*IntSet).SymmetricDifference, func(x, y bool) bool { return x != y }},
+	}
+	for name, b := range binary {
+		b := b
+		f := func(xs, ys []uint16) bool {
+			s, ms := set(xs)
+			u, mu := set(ys)
+			want := model{}
+			for x := 0; x < 1000; x++ {
+				if b.model(ms[x], mu[x]) {
+					want[x] = true
+				}
+			}
+			b.op(s, u)
+			return equal(s, want) && equal(u, mu)
+		}
+		if err := quick.Check(f, nil); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	f := func(xs, removes []uint16) bool {
+		s, m := set(xs)
+		c := s.Copy()
+		for _, x := range removes {
+			s.Remove(int(x % 1000))
+			delete(m, int(x%1000))
+		}
+		for x := 0; x < 1000; x++ {
+			if s.Has(x) != m[x] {
+				return false
+			}
+		}
+		_, mc := set(xs)
+		return equal(s, m) && equal(c, mc)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Errorf("Remove: %v", err)
+	}
+
+	f = func(xs, _ []uint16) bool {
+		s, m := set(xs)
+		elems := m.elems()
+		min, minOK := s.Min()
+		max, maxOK := s.Max()
+		if len(elems) == 0 {
+			return !minOK && !maxOK
+		}
+		return minOK && maxOK && min == elems[0] && max == elems[len(elems)-1]
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Errorf("Min and Max: %v", err)
+	}
+
+	f = func(xs, _ []uint16) bool {
+		s, m := set(xs)
+		s.Add(5000)
+		s.Remove(5000) // leaves trailing zero words
+		data, err := s.MarshalBinary()
+		if err != nil {
+			return false
+		}
+		var u IntSet
+		if err := u.UnmarshalBinary(data); err != nil {
+			return false
+		}
+		return len(data)%8 == 0 && len(data) <= 8*(1000/64+1) && equal(&u, m)
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Errorf("MarshalBinary: %v", err)
+	}
+}
+
+func TestIntSet(t *testing.T) {
+	var s IntSet
+	s.AddAll(3, 1, 200, 64, 63)
+	if got, want := s.String(), "{1 3 63 64 200}"; got != want {
+		t.Errorf("String = %s, want %s", got, want)
+	}
+	var visited []int
+	s.Range(func(x int) bool {
+		visited = append(visited, x)
+		return x < 63
+	})
+	if want := []int{1, 3, 63}; !reflect.DeepEqual(visited, want) {
+		t.Errorf("Range stopping at 63 visited %v, want %v", visited, want)
+	}
+	s.Clear()
+	if s.Len() != 0 || s.String() != "{}" {
+		t.Errorf("after Clear, set is %s", &s)
+	}
+	if err := s.UnmarshalBinary(make([]byte, 7)); err == nil {
+		t.Error("UnmarshalBinary of 7 bytes succeeded")
+	}
+}
+
+// The benchmarks compare an IntSet with a map[int]bool holding the same
+// random elements.
+const benchElems, benchMax = 10000, 100000
+
+func benchData() []int {
+	rng := rand.New(rand.NewSource(1))
+	xs := make([]int, benchElems)
+	for i := range xs {
+		xs[i] = rng.Intn(benchMax)
+	}
+	return xs
+}
+
+func BenchmarkIntSetAdd(b *testing.B) {
+	xs := benchData()
+	for i := 0; i < b.N; i++ {
+		var s IntSet
+		for _, x := range xs {
+			s.Add(x)
+		}
+	}
+}
+
+func BenchmarkMapAdd(b *testing.B) {
+	xs := benchData()
+	for i := 0; i < b.N; i++ {
+		m := make(map[int]bool)
+		for _, x := range xs {
+			m[x] = true
+		}
+	}
+}
+
+func BenchmarkIntSetHas(b *testing.B) {
+	var s IntSet
+	s.AddAll(benchData()...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Has(i % benchMax)
+	}
+}
+
+func BenchmarkMapHas(b *testing.B) {
+	m := make(map[int]bool)
+	for _, x := range benchData() {
+		m[x] = true
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m[i%benchMax]
+	}
+}
+
+func BenchmarkIntSetUnionWith(b *testing.B) {
+	var s, t IntSet
+	xs := benchData()
+	s.AddAll(xs[:benchElems/2]...)
+	t.AddAll(xs[benchElems/2:]...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u := s.Copy()
+		u.UnionWith(&t)
+	}
+}
+
+func BenchmarkMapUnionWith(b *testing.B) {
+	s, t := make(map[int]bool), make(map[int]bool)
+	xs := benchData()
+	for _, x := range xs[:benchElems/2] {
+		s[x] = true
+	}
+	for _, x := range xs[benchElems/2:] {
+		t[x] = true
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u := make(map[int]bool, len(s)+len(t))
+		for x := range s {
+			u[x] = true
+		}
+		for x := range t {
+			u[x] = true
+		}
+	}
+}
+
+func BenchmarkIntSetLen(b *testing.B) {
+	var s IntSet
+	s.AddAll(benchData()...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Len()
+	}
+}
@@ -0,0 +1,780 @@
+package intset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// A RoaringSet is a set of integers, negative or not, with the same
+// methods as IntSet. Its cost depends on the number of elements and how
+// they cluster, not on their magnitude, so that it suits sparse sets.
+// Its zero value represents the empty set.
+//
+// As in Roaring bitmaps (roaringbitmap.org), the set is divided into
+// chunks of 65536 consecutive integers, each held in the most compact
+// of three containers: a sorted array of up to 4096 elements, a bitmap
+// of 65536 bits, or a list of runs of consecutive elements.
+type RoaringSet struct {
+	keys       []int // the high bits of the elements of each chunk, in order
+	containers []*container
+}
+
+const (
+	arrayMax    = 4096 // elements of the largest array container
+	bitmapWords = 1 << 16 / 64
+	bitmapSize  = 8 * bitmapWords // in bytes
+	runsMax     = 1 << 15         // most runs of a container: every other element
+
+	// The range of the keys of elements of type int.
+	maxKey = (1<<(bits.UintSize-1) - 1) >> 16
+	minKey = -1 << (bits.UintSize - 1) >> 16
+)
+
+type containerKind byte
+
+const (
+	arrayKind containerKind = iota
+	bitmapKind
+	runKind
+)
+
+// A container holds the low 16 bits of the elements of a chunk, in one
+// of three forms.
+type container struct {
+	kind   containerKind
+	n      int        // number of elements
+	array  []uint16   // sorted
+	bitmap []uint64   // bitmapWords long
+	runs   []interval // sorted, and neither overlapping nor adjacent
+}
+
+// An interval is a run of elements, from start to last inclusive.
+type interval struct{ start, last uint16 }
+
+func split(x int) (key int, low uint16) {
+	return x >> 16, uint16(x)
+}
+
+func join(key int, low uint16) int {
+	return key<<16 | int(low)
+}
+
+// find returns the index of the chunk with the given key, or where it
+// would be inserted, and whether it exists.
+func (s *RoaringSet) find(key int) (int, bool) {
+	i := sort.SearchInts(s.keys, key)
+	return i, i < len(s.keys) && s.keys[i] == key
+}
+
+// Has reports whether the set contains the value x.
+func (s *RoaringSet) Has(x int) bool {
+	key, low := split(x)
+	i, ok := s.find(key)
+	return ok && s.containers[i].has(low)
+}
+
+// Add adds the value x to the set.
+func (s *RoaringSet) Add(x int) {
+	s.add(x)
+}
+
+// add adds x, and returns its container.
+func (s *RoaringSet) add(x int) *container {
+	key, low := split(x)
+	i, ok := s.find(key)
+	if !ok {
+		s.insert(i, key, &container{kind: arrayKind})
+	}
+	c := s.containers[i]
+	c.add(low)
+	return c
+}
+
+func (s *RoaringSet) insert(i, key int, c *container) {
+	s.keys = append(s.keys, 0)
+	copy(s.keys[i+1:], s.keys[i:])
+	s.keys[i] = key
+	s.containers = append(s.containers, nil)
+	copy(s.containers[i+1:], s.containers[i:])
+	s.containers[i] = c
+}
+
+func (s *RoaringSet) delete(i int) {
+	s.keys = append(s.keys[:i], s.keys[i+1:]...)
+	s.containers = append(s.containers[:i], s.containers[i+1:]...)
+}
+
+// AddAll adds the values xs to the set, then makes the containers they
+// were added to as compact as possible.
+func (s *RoaringSet) AddAll(xs ...int) {
+	touched := make(map[*container]bool)
+	for _, x := range xs {
+		touched[s.add(x)] = true
+	}
+	for c := range touched {
+		c.optimize()
+	}
+}
+
+// Remove removes the value x from the set.
+func (s *RoaringSet) Remove(x int) {
+	key, low := split(x)
+	i, ok := s.find(key)
+	if !ok {
+		return
+	}
+	c := s.containers[i]
+	c.remove(low)
+	if c.n == 0 {
+		s.delete(i)
+	}
+}
+
+// Clear removes all elements from the set.
+func (s *RoaringSet) Clear() {
+	s.keys, s.containers = nil, nil
+}
+
+// Copy returns a copy of the set.
+func (s *RoaringSet) Copy() *RoaringSet {
+	t := &RoaringSet{
+		keys:       append([]int(nil), s.keys...),
+		containers: make([]*container, len(s.containers)),
+	}
+	for i, c := range s.containers {
+		t.containers[i] = c.clone()
+	}
+	return t
+}
+
+// Optimize converts each container to the most compact of the three
+// forms. Add and Remove change the form of a container only when its
+// current one becomes much worse; the set operations, AddAll and
+// UnmarshalBinary always choose the most compact.
+func (s *RoaringSet) Optimize() {
+	for _, c := range s.containers {
+		c.optimize()
+	}
+}
+
+// Len returns the number of elements in the set.
+func (s *RoaringSet) Len() int {
+	n := 0
+	for _, c := range s.containers {
+		n += c.n
+	}
+	return n
+}
+
+// UnionWith sets s to the union of s and t.
+func (s *RoaringSet) UnionWith(t *RoaringSet) {
+	s.combine(t, or, true)
+}
+
+// IntersectWith sets s to the intersection of s and t.
+func (s *RoaringSet) IntersectWith(t *RoaringSet) {
+	s.combine(t, and, false)
+}
+
+// DifferenceWith sets s to the difference of s and t, the elements of
+// s that are not in t.
+func (s *RoaringSet) DifferenceWith(t *RoaringSet) {
+	s.combine(t, andNot, false)
+}
+
+// SymmetricDifference sets s to the symmetric difference of s and t,
+// the elements that are in one set but not both.
+func (s *RoaringSet) SymmetricDifference(t *RoaringSet) {
+	s.combine(t, xor, true)
+}
+
+// combine sets s to the result of applying op to the chunks of s and t.
+// Chunks of s that are not in t are unchanged if op keeps elements of
+// s alone; chunks of t not in s are added if addT is set.
+func (s *RoaringSet) combine(t *RoaringSet, op setOp, addT bool) {
+	var keys []int
+	var containers []*container
+	i, j := 0, 0
+	for i < len(s.keys) || j < len(t.keys) {
+		switch {
+		case j == len(t.keys) || i < len(s.keys) && s.keys[i] < t.keys[j]:
+			if op != and {
+				keys = append(keys, s.keys[i])
+				containers = append(containers, s.containers[i])
+			}
+			i++
+		case i == len(s.keys) || t.keys[j] < s.keys[i]:
+			if addT {
+				keys = append(keys, t.keys[j])
+				containers = append(containers, t.containers[j].clone())
+			}
+			j++
+		default:
+			if c := combine(s.containers[i], t.containers[j], op); c != nil {
+				keys = append(keys, s.keys[i])
+				containers = append(containers, c)
+			}
+			i++
+			j++
+		}
+	}
+	s.keys, s.containers = keys, containers
+}
+
+// Elems returns the elements of the set in increasing order.
+func (s *RoaringSet) Elems() []int {
+	elems := make([]int, 0, s.Len())
+	s.Range(func(x int) bool {
+		elems = append(elems, x)
+		return true
+	})
+	return elems
+}
+
+// Range calls f for each element of the set in increasing order,
+// stopping if f returns false.
+func (s *RoaringSet) Range(f func(x int) bool) {
+	for i, c := range s.containers {
+		key := s.keys[i]
+		if !c.each(func(low uint16) bool { return f(join(key, low)) }) {
+			return
+		}
+	}
+}
+
+// Min returns the least element of the set, or false if it is empty.
+func (s *RoaringSet) Min() (int, bool) {
+	if len(s.keys) == 0 {
+		return 0, false
+	}
+	var min uint16
+	s.containers[0].each(func(low uint16) bool {
+		min = low
+		return false
+	})
+	return join(s.keys[0], min), true
+}
+
+// Max returns the greatest element of the set, or false if it is empty.
+func (s *RoaringSet) Max() (int, bool) {
+	if len(s.keys) == 0 {
+		return 0, false
+	}
+	last := len(s.keys) - 1
+	return join(s.keys[last], s.containers[last].max()), true
+}
+
+// String returns the set as a string of the form "{-1 2 3}".
+func (s *RoaringSet) String() string {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	s.Range(func(x int) bool {
+		if buf.Len() > len("{") {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%d", x)
+		return true
+	})
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// MarshalBinary encodes the set as a sequence of containers, each its
+// key as a varint, its kind as a byte, and its contents: for an array,
+// the number of elements as a uvarint and the elements; for a bitmap,
+// its words; for runs, the number of runs as a uvarint and the start
+// and last element of each. All numbers of fixed size are little-endian.
+func (s *RoaringSet) MarshalBinary() ([]byte, error) {
+	var data []byte
+	var tmp [binary.MaxVarintLen64]byte
+	data = append(data, tmp[:binary.PutUvarint(tmp[:], uint64(len(s.keys)))]...)
+	for i, c := range s.containers {
+		data = append(data, tmp[:binary.PutVarint(tmp[:], int64(s.keys[i]))]...)
+		data = append(data, byte(c.kind))
+		switch c.kind {
+		case arrayKind:
+			data = append(data, tmp[:binary.PutUvarint(tmp[:], uint64(len(c.array)))]...)
+			for _, x := range c.array {
+				data = append(data, byte(x), byte(x>>8))
+			}
+		case bitmapKind:
+			for _, w := range c.bitmap {
+				binary.LittleEndian.PutUint64(tmp[:], w)
+				data = append(data, tmp[:8]...)
+			}
+		case runKind:
+			data = append(data, tmp[:binary.PutUvarint(tmp[:], uint64(len(c.runs)))]...)
+			for _, r := range c.runs {
+				data = append(data, byte(r.start), byte(r.start>>8), byte(r.last), byte(r.last>>8))
+			}
+		}
+	}
+	return data, nil
+}
+
+var errRoaring = errors.New("intset: invalid RoaringSet encoding")
+
+// UnmarshalBinary sets s to the set encoded by MarshalBinary.
+func (s *RoaringSet) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	u16 := func() uint16 {
+		lo, _ := r.ReadByte()
+		hi, _ := r.ReadByte()
+		return uint16(lo) | uint16(hi)<<8
+	}
+	count, err := binary.ReadUvarint(r)
+	if err != nil || count > uint64(len(data)) {
+		return errRoaring
+	}
+	var t RoaringSet
+	for i := uint64(0); i < count; i++ {
+		key, err := binary.ReadVarint(r)
+		if err != nil || key < minKey || key > maxKey ||
+			len(t.keys) > 0 && int(key) <= t.keys[len(t.keys)-1] {
+			return errRoaring
+		}
+		kind, _ := r.ReadByte()
+		c := &container{kind: containerKind(kind)}
+		switch c.kind {
+		case arrayKind:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n == 0 || n > arrayMax || 2*n > uint64(r.Len()) {
+				return errRoaring
+			}
+			c.array = make([]uint16, n)
+			for j := range c.array {
+				c.array[j] = u16()
+				if j > 0 && c.array[j] <= c.array[j-1] {
+					return errRoaring
+				}
+			}
+		case bitmapKind:
+			if r.Len() < bitmapSize {
+				return errRoaring
+			}
+			c.bitmap = make([]uint64, bitmapWords)
+			for j := range c.bitmap {
+				c.bitmap[j] = uint64(u16()) | uint64(u16())<<16 | uint64(u16())<<32 | uint64(u16())<<48
+			}
+		case runKind:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n == 0 || n > runsMax || 4*n > uint64(r.Len()) {
+				return errRoaring
+			}
+			c.runs = make([]interval, n)
+			for j := range c.runs {
+				run := interval{u16(), u16()}
+				if run.last < run.start || j > 0 && int(run.start) <= int(c.runs[j-1].last)+1 {
+					return errRoaring
+				}
+				c.runs[j] = run
+			}
+		default:
+			return errRoaring
+		}
+		c.n = c.count()
+		if c.n == 0 {
+			return errRoaring
+		}
+		c.optimize()
+		t.keys = append(t.keys, int(key))
+		t.containers = append(t.containers, c)
+	}
+	if r.Len() != 0 {
+		return errRoaring
+	}
+	*s = t
+	return nil
+}
+
+// Containers.
+
+func (c *container) clone() *container {
+	return &container{
+		kind:   c.kind,
+		n:      c.n,
+		array:  append([]uint16(nil), c.array...),
+		bitmap: append([]uint64(nil), c.bitmap...),
+		runs:   append([]interval(nil), c.runs...),
+	}
+}
+
+// count returns the number of elements, computed afresh.
+func (c *container) count() int {
+	n := 0
+	switch c.kind {
+	case arrayKind:
+		n = len(c.array)
+	case bitmapKind:
+		for _, w := range c.bitmap {
+			n += bits.OnesCount64(w)
+		}
+	case runKind:
+		for _, r := range c.runs {
+			n += int(r.last-r.start) + 1
+		}
+	}
+	return n
+}
+
+// searchRuns returns the index of the first run that ends at or after x.
+func (c *container) searchRuns(x uint16) int {
+	return sort.Search(len(c.runs), func(i int) bool { return c.runs[i].last >= x })
+}
+
+// searchArray returns the index of the first element at or after x.
+func (c *container) searchArray(x uint16) int {
+	i, j := 0, len(c.array)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if c.array[h] < x {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i
+}
+
+func (c *container) has(x uint16) bool {
+	switch c.kind {
+	case arrayKind:
+		i := c.searchArray(x)
+		return i < len(c.array) && c.array[i] == x
+	case bitmapKind:
+		return c.bitmap[x/64]&(1<<(x%64)) != 0
+	default:
+		i := c.searchRuns(x)
+		return i < len(c.runs) && c.runs[i].start <= x
+	}
+}
+
+func (c *container) add(x uint16) {
+	if c.has(x) {
+		return
+	}
+	c.n++
+	switch c.kind {
+	case arrayKind:
+		if c.n > arrayMax {
+			c.convert(bitmapKind)
+			c.bitmap[x/64] |= 1 << (x % 64)
+			return
+		}
+		i := c.searchArray(x)
+		c.array = append(c.array, 0)
+		copy(c.array[i+1:], c.array[i:])
+		c.array[i] = x
+	case bitmapKind:
+		c.bitmap[x/64] |= 1 << (x % 64)
+	case runKind:
+		i := c.searchRuns(x) // the run after x, if any
+		joinsPrev := i > 0 && c.runs[i-1].last == x-1
+		joinsNext := i < len(c.runs) && c.runs[i].start == x+1
+		switch {
+		case joinsPrev && joinsNext:
+			c.runs[i-1].last = c.runs[i].last
+			c.runs = append(c.runs[:i], c.runs[i+1:]...)
+		case joinsPrev:
+			c.runs[i-1].last = x
+		case joinsNext:
+			c.runs[i].start = x
+		default:
+			c.runs = append(c.runs, interval{})
+			copy(c.runs[i+1:], c.runs[i:])
+			c.runs[i] = interval{x, x}
+		}
+		c.checkRuns()
+	}
+}
+
+func (c *container) remove(x uint16) {
+	if !c.has(x) {
+		return
+	}
+	c.n--
+	switch c.kind {
+	case arrayKind:
+		i := c.searchArray(x)
+		c.array = append(c.array[:i], c.array[i+1:]...)
+	case bitmapKind:
+		c.bitmap[x/64] &^= 1 << (x % 64)
+		if c.n <= arrayMax/2 { // not at arrayMax, lest it flip back and forth
+			c.convert(arrayKind)
+		}
+	case runKind:
+		i := c.searchRuns(x)
+		r := c.runs[i]
+		switch {
+		case r.start == r.last:
+			c.runs = append(c.runs[:i], c.runs[i+1:]...)
+		case x == r.start:
+			c.runs[i].start++
+		case x == r.last:
+			c.runs[i].last--
+		default:
+			c.runs = append(c.runs, interval{})
+			copy(c.runs[i+1:], c.runs[i:])
+			c.runs[i].last = x - 1
+			c.runs[i+1].start = x + 1
+		}
+		c.checkRuns()
+	}
+}
+
+// checkRuns converts a run container that has become much larger than
+// another form would be.
+func (c *container) checkRuns() {
+	if size := 4 * len(c.runs); size > 2*c.size(arrayKind) || size > 2*bitmapSize {
+		c.optimize()
+	}
+}
+
+// size returns the size in bytes of the contents in the given form,
+// counting runs only if the container is in that form.
+func (c *container) size(kind containerKind) int {
+	switch kind {
+	case arrayKind:
+		return 2 * c.n
+	case bitmapKind:
+		return bitmapSize
+	default:
+		return 4 * len(c.runs)
+	}
+}
+
+// optimize converts the container to its most compact form.
+func (c *container) optimize() {
+	nruns := c.countRuns()
+	best, size := arrayKind, 2*c.n
+	if c.n > arrayMax || bitmapSize < size {
+		best, size = bitmapKind, bitmapSize
+	}
+	if 4*nruns < size {
+		best = runKind
+	}
+	c.convert(best)
+}
+
+// countRuns returns the number of runs of consecutive elements.
+func (c *container) countRuns() int {
+	switch c.kind {
+	case runKind:
+		return len(c.runs)
+	case arrayKind:
+		n := 0
+		for i, x := range c.array {
+			if i == 0 || x != c.array[i-1]+1 {
+				n++
+			}
+		}
+		return n
+	default:
+		// A run starts at each set bit whose predecessor is clear.
+		n, carry := 0, uint64(0)
+		for _, w := range c.bitmap {
+			n += bits.OnesCount64(w &^ (w<<1 | carry))
+			carry = w >> 63
+		}
+		return n
+	}
+}
+
+// convert changes the container to the given form.
+func (c *container) convert(kind containerKind) {
+	if kind == c.kind {
+		return
+	}
+	var d container
+	d.kind, d.n = kind, c.n
+	switch kind {
+	case arrayKind:
+		d.array = make([]uint16, 0, c.n)
+		c.each(func(x uint16) bool {
+			d.array = append(d.array, x)
+			return true
+		})
+	case bitmapKind:
+		d.bitmap = c.words()
+	case runKind:
+		c.each(func(x uint16) bool {
+			if n := len(d.runs); n > 0 && d.runs[n-1].last == x-1 {
+				d.runs[n-1].last = x
+			} else {
+				d.runs = append(d.runs, interval{x, x})
+			}
+			return true
+		})
+	}
+	*c = d
+}
+
+// words returns the contents as a bitmap, which the caller may modify.
+func (c *container) words() []uint64 {
+	if c.kind == bitmapKind {
+		return append([]uint64(nil), c.bitmap...)
+	}
+	w := make([]uint64, bitmapWords)
+	switch c.kind {
+	case arrayKind:
+		for _, x := range c.array {
+			w[x/64] |= 1 << (x % 64)
+		}
+	case runKind:
+		for _, r := range c.runs {
+			setRange(w, int(r.start), int(r.last)+1)
+		}
+	}
+	return w
+}
+
+// setRange sets bits lo to hi-1 of the bitmap w.
+func setRange(w []uint64, lo, hi int) {
+	for lo < hi {
+		i, bit := lo/64, uint(lo%64)
+		n := 64 - int(bit) // bits to the end of the word
+		if hi-lo < n {
+			n = hi - lo
+		}
+		w[i] |= (1<<uint(n) - 1) << bit
+		lo += n
+	}
+}
+
+// each calls f for each element in increasing order, stopping if f
+// returns false, and reports whether it did not stop.
+func (c *container) each(f func(x uint16) bool) bool {
+	switch c.kind {
+	case arrayKind:
+		for _, x := range c.array {
+			if !f(x) {
+				return false
+			}
+		}
+	case bitmapKind:
+		for i, w := range c.bitmap {
+			for w != 0 {
+				j := bits.TrailingZeros64(w)
+				if !f(uint16(64*i + j)) {
+					return false
+				}
+				w &^= 1 << uint(j)
+			}
+		}
+	case runKind:
+		for _, r := range c.runs {
+			for x := int(r.start); x <= int(r.last); x++ {
+				if !f(uint16(x)) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (c *container) max() uint16 {
+	switch c.kind {
+	case arrayKind:
+		return c.array[len(c.array)-1]
+	case runKind:
+		return c.runs[len(c.runs)-1].last
+	default:
+		for i := len(c.bitmap) - 1; ; i-- {
+			if w := c.bitmap[i]; w != 0 {
+				return uint16(64*i + 63 - bits.LeadingZeros64(w))
+			}
+		}
+	}
+}
+
+// A setOp is a set operation on containers.
+type setOp int
+
+const (
+	or setOp = iota
+	and
+	andNot
+	xor
+)
+
+// combine returns the result of applying op to a and b, or nil if it
+// is empty, in its most compact form. It does not modify a or b.
+func combine(a, b *container, op setOp) *container {
+	// An array of a is filtered by membership of b, and vice versa
+	// for an intersection.
+	if a.kind != arrayKind && b.kind == arrayKind && op == and {
+		a, b = b, a
+	}
+	if a.kind == arrayKind && (op == and || op == andNot) {
+		c := &container{kind: arrayKind}
+		for _, x := range a.array {
+			if b.has(x) == (op == and) {
+				c.array = append(c.array, x)
+			}
+		}
+		c.n = len(c.array)
+		return nonEmpty(c)
+	}
+	if a.kind == arrayKind && b.kind == arrayKind && a.n+b.n <= arrayMax {
+		c := &container{kind: arrayKind, array: mergeArrays(a.array, b.array, op == xor)}
+		c.n = len(c.array)
+		c.optimize()
+		return nonEmpty(c)
+	}
+
+	w, bw := a.words(), b.words()
+	n := 0
+	for i := range w {
+		switch op {
+		case or:
+			w[i] |= bw[i]
+		case and:
+			w[i] &= bw[i]
+		case andNot:
+			w[i] &^= bw[i]
+		case xor:
+			w[i] ^= bw[i]
+		}
+		n += bits.OnesCount64(w[i])
+	}
+	c := &container{kind: bitmapKind, n: n, bitmap: w}
+	c.optimize()
+	return nonEmpty(c)
+}
+
+func nonEmpty(c *container) *container {
+	if c.n == 0 {
+		return nil
+	}
+	return c
+}
+
+// mergeArrays returns the sorted union of x and y, or if exclusive,
+// their symmetric difference.
+func mergeArrays(x, y []uint16, exclusive bool) []uint16 {
+	z := make([]uint16, 0, len(x)+len(y))
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] < y[j]:
+			z = append(z, x[i])
+			i++
+		case y[j] < x[i]:
+			z = append(z, y[j])
+			j++
+		default:
+			if !exclusive {
+				z = append(z, x[i])
+			}
+			i++
+			j++
+		}
+	}
+	z = append(z, x[i:]...)
+	return append(z, y[j:]...)
+}
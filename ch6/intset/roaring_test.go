@@ -0,0 +1,332 @@
+package intset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func ExampleRoaringSet() {
+	var x RoaringSet
+	x.AddAll(-1, 1<<40, 9)
+	for i := 100; i < 200; i++ {
+		x.Add(i)
+	}
+	x.Remove(150)
+	fmt.Println(x.Len(), x.Has(1<<40), x.Has(150))
+	min, _ := x.Min()
+	max, _ := x.Max()
+	fmt.Println(min, max)
+
+	var y RoaringSet
+	y.AddAll(-1, 9, 1<<40+1)
+	y.IntersectWith(&x)
+	fmt.Println(&y)
+	// Output:
+	// 102 true false
+	// -1 1099511627776
+	// {-1 9}
+}
+
+// randomValue returns a value drawn from one of several distributions,
+// so that the chunks of a set take each of the three forms.
+func randomValue(rng *rand.Rand) int {
+	switch rng.Intn(4) {
+	case 0: // sparse, wide and of either sign
+		return rng.Intn(1<<41) - 1<<40
+	case 1: // dense, around a chunk boundary
+		return rng.Intn(1<<15) - 1<<14
+	case 2: // runs
+		return 1<<20 + rng.Intn(50)*1000 + rng.Intn(20)
+	default: // small
+		return rng.Intn(300)
+	}
+}
+
+// checkRoaring reports whether s has the elements of m, and its
+// containers are consistent.
+func checkRoaring(t *testing.T, what string, s *RoaringSet, m model) {
+	t.Helper()
+	if got, want := s.Elems(), m.elems(); len(got) != len(want) || len(got) > 0 && !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s: got %d elements, want %d", what, len(got), len(want))
+	}
+	if s.Len() != len(m) {
+		t.Fatalf("%s: Len = %d, want %d", what, s.Len(), len(m))
+	}
+	for x := range m {
+		if !s.Has(x) || s.Has(x+1) != m[x+1] {
+			t.Fatalf("%s: Has(%d) or Has(%d) is wrong", what, x, x+1)
+		}
+	}
+	for i, c := range s.containers {
+		if i > 0 && s.keys[i] <= s.keys[i-1] {
+			t.Fatalf("%s: keys out of order", what)
+		}
+		if c.n == 0 || c.n != c.count() {
+			t.Fatalf("%s: container %d has n = %d, count = %d", what, i, c.n, c.count())
+		}
+		if c.kind == arrayKind && c.n > arrayMax || c.kind == bitmapKind && len(c.bitmap) != bitmapWords {
+			t.Fatalf("%s: container %d of kind %d holds %d", what, i, c.kind, c.n)
+		}
+	}
+}
+
+func TestRoaringModel(t *testing.T) {
+	kinds := make(map[containerKind]bool)
+	for seed := int64(0); seed < 10; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		var s, u RoaringSet
+		ms, mu := model{}, model{}
+		for step := 0; step < 20; step++ {
+			switch op := rng.Intn(10); {
+			case op < 3:
+				n := rng.Intn(10000)
+				xs := make([]int, n)
+				for i := range xs {
+					xs[i] = randomValue(rng)
+					mu[xs[i]] = true
+				}
+				u.AddAll(xs...)
+			case op < 5:
+				for i := rng.Intn(5000); i > 0; i-- {
+					x := randomValue(rng)
+					s.Add(x)
+					ms[x] = true
+				}
+			case op < 6:
+				for x := range ms {
+					if rng.Intn(2) == 0 {
+						s.Remove(x)
+						delete(ms, x)
+					}
+				}
+			default:
+				name := []string{"UnionWith", "IntersectWith", "DifferenceWith", "SymmetricDifference"}[op-6]
+				want := model{}
+				for x := range ms {
+					if op == 6 || op != 7 && !mu[x] || op == 7 && mu[x] {
+						want[x] = true
+					}
+				}
+				for x := range mu {
+					if op == 6 || op == 9 && !ms[x] {
+						want[x] = true
+					}
+				}
+				reflect.ValueOf(&s).MethodByName(name).Call([]reflect.Value{reflect.ValueOf(&u)})
+				ms = want
+			}
+			for _, c := range append(s.containers, u.containers...) {
+				kinds[c.kind] = true
+			}
+			checkRoaring(t, fmt.Sprintf("seed %d step %d: s", seed, step), &s, ms)
+			checkRoaring(t, fmt.Sprintf("seed %d step %d: u", seed, step), &u, mu)
+
+			c := s.Copy()
+			c.Optimize()
+			data, err := c.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var d RoaringSet
+			if err := d.UnmarshalBinary(data); err != nil {
+				t.Fatalf("seed %d step %d: UnmarshalBinary: %v", seed, step, err)
+			}
+			checkRoaring(t, fmt.Sprintf("seed %d step %d: decoded", seed, step), &d, ms)
+		}
+	}
+	if len(kinds) != 3 {
+		t.Errorf("containers took only the forms %v", kinds)
+	}
+}
+
+func TestRoaringAgreesWithIntSet(t *testing.T) {
+	var r RoaringSet
+	var s IntSet
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		x := rng.Intn(200000)
+		r.Add(x)
+		s.Add(x)
+	}
+	if r.String() != s.String() {
+		t.Error("String differs from that of IntSet")
+	}
+	rmin, _ := r.Min()
+	smin, _ := s.Min()
+	rmax, _ := r.Max()
+	smax, _ := s.Max()
+	if rmin != smin || rmax != smax {
+		t.Errorf("Min, Max = %d, %d; IntSet has %d, %d", rmin, rmax, smin, smax)
+	}
+}
+
+func TestRoaringRuns(t *testing.T) {
+	var s RoaringSet
+	for x := -100000; x < 100000; x++ {
+		s.Add(x)
+	}
+	s.Optimize()
+	for _, c := range s.containers {
+		if c.kind != runKind || len(c.runs) != 1 {
+			t.Fatalf("a range is held as %d containers of kind %d, %d runs", len(s.containers), c.kind, len(c.runs))
+		}
+	}
+	s.Remove(0)
+	s.Remove(5)
+	s.Add(0)
+	if got, want := s.Len(), 199999; got != want {
+		t.Errorf("Len = %d, want %d", got, want)
+	}
+	if s.Has(5) || !s.Has(0) || !s.Has(4) || !s.Has(6) {
+		t.Error("removing from a run gave the wrong elements")
+	}
+}
+
+func TestRoaringUnmarshalErrors(t *testing.T) {
+	var s RoaringSet
+	s.AddAll(1, 2, 3)
+	good, _ := s.MarshalBinary()
+	// varint returns the bytes that encode x, signed or not.
+	varint := func(x int64, signed bool) []byte {
+		b := make([]byte, binary.MaxVarintLen64)
+		if signed {
+			return b[:binary.PutVarint(b, x)]
+		}
+		return b[:binary.PutUvarint(b, uint64(x))]
+	}
+	cat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	for _, data := range [][]byte{
+		good[:len(good)-1],
+		append(good, 0),
+		{1, 0, 7},                         // unknown kind
+		{1, 0, 0, 2, 5, 0, 4, 0},          // unsorted array
+		{1, 0, 2, 1, 9, 0, 3, 0},          // run ending before its start
+		{2, 0, 0, 1, 1, 0, 0, 0, 1, 2, 0}, // keys out of order
+		cat([]byte{1, 0, 2}, varint(1<<62, false), []byte{0, 0, 0, 0}), // too many runs
+		cat([]byte{1}, varint(1<<48, true), []byte{0, 1, 5, 0}),        // key beyond int
+		cat([]byte{1}, varint(-1<<48-1, true), []byte{0, 1, 5, 0}),     // key below int
+	} {
+		if err := s.UnmarshalBinary(data); err == nil {
+			t.Errorf("UnmarshalBinary(%v) succeeded", data)
+		}
+	}
+	if s.String() != "{1 2 3}" {
+		t.Errorf("failed UnmarshalBinary changed set to %s", &s)
+	}
+}
+
+// The benchmarks compare RoaringSet with IntSet. The IntSet benchmarks
+// above use the same data.
+
+func BenchmarkRoaringAdd(b *testing.B) {
+	xs := benchData()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s RoaringSet
+		for _, x := range xs {
+			s.Add(x)
+		}
+	}
+}
+
+func BenchmarkRoaringHas(b *testing.B) {
+	var s RoaringSet
+	s.AddAll(benchData()...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Has(i % benchMax)
+	}
+}
+
+func BenchmarkRoaringUnionWith(b *testing.B) {
+	var s, t RoaringSet
+	xs := benchData()
+	s.AddAll(xs[:benchElems/2]...)
+	t.AddAll(xs[benchElems/2:]...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u := s.Copy()
+		u.UnionWith(&t)
+	}
+}
+
+// A single large element costs IntSet a word for every 64 smaller
+// values, but RoaringSet one small container.
+
+func BenchmarkIntSetAddLarge(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s IntSet
+		s.Add(1 << 24)
+	}
+}
+
+func BenchmarkRoaringAddLarge(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var s RoaringSet
+		s.Add(1 << 24)
+	}
+}
+
+// Sparse sets, with elements spread over a range of 2^30, are cheap for
+// RoaringSet to combine, and expensive for IntSet.
+
+func sparse(n int, seed int64) []int {
+	rng := rand.New(rand.NewSource(seed))
+	xs := make([]int, n)
+	for i := range xs {
+		xs[i] = rng.Intn(1 << 30)
+	}
+	return xs
+}
+
+func BenchmarkIntSetIntersectSparse(b *testing.B) {
+	var s, t IntSet
+	s.AddAll(sparse(1000, 1)...)
+	t.AddAll(sparse(1000, 2)...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Copy().IntersectWith(&t)
+	}
+}
+
+func BenchmarkRoaringIntersectSparse(b *testing.B) {
+	var s, t RoaringSet
+	s.AddAll(sparse(1000, 1)...)
+	t.AddAll(sparse(1000, 2)...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Copy().IntersectWith(&t)
+	}
+}
+
+// Dense sets favour IntSet's single bitmap.
+
+func BenchmarkIntSetIntersectDense(b *testing.B) {
+	var s, t IntSet
+	for x := 0; x < 1<<20; x += 2 {
+		s.Add(x)
+		t.Add(x + x%3)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Copy().IntersectWith(&t)
+	}
+}
+
+func BenchmarkRoaringIntersectDense(b *testing.B) {
+	var s, t RoaringSet
+	for x := 0; x < 1<<20; x += 2 {
+		s.Add(x)
+		t.Add(x + x%3)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Copy().IntersectWith(&t)
+	}
+}
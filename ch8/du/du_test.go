@@ -0,0 +1,268 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// mkfiles creates the named files beneath dir, each holding size bytes.
+func mkfiles(t *testing.T, dir string, files map[string]int) {
+	t.Helper()
+	for name, size := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// analyze walks roots with a walker adjusted by opts
+// and returns the usage report.
+func analyze(roots []string, depth, top int, opts ...func(*walker)) *Report {
+	files := make(chan file)
+	w := newWalker(make(chan struct{}), files)
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.walk(roots)
+	u := newUsage(roots, top)
+	for f := range files {
+		u.add(f)
+	}
+	return u.report(depth)
+}
+
+func TestUsage(t *testing.T) {
+	root := t.TempDir()
+	mkfiles(t, root, map[string]int{
+		"a.txt":          100,
+		"src/b.go":       2000,
+		"src/pkg/c.go":   3000,
+		"src/pkg/d.go":   20000,
+		"docs/e.md":      500,
+		"docs/img/f.png": 5000000,
+	})
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	rep := analyze([]string{root}, 1, 2)
+	if rep.Files != 6 || rep.Dirs != 5 || rep.Bytes != 5025600 {
+		t.Errorf("totals = %d files, %d dirs, %d bytes; want 6, 5, 5025600",
+			rep.Files, rep.Dirs, rep.Bytes)
+	}
+
+	want := map[string]int64{
+		"":      5025600,
+		"docs":  5000500,
+		"empty": 0,
+		"src":   25000,
+	}
+	if len(rep.Tree) != len(want) {
+		t.Errorf("tree has %d directories, want %d", len(rep.Tree), len(want))
+	}
+	for _, du := range rep.Tree {
+		rel, _ := filepath.Rel(root, du.Path)
+		if rel == "." {
+			rel = ""
+		}
+		if bytes, ok := want[rel]; !ok || bytes != du.Bytes {
+			t.Errorf("tree: %q = %d bytes, want %d", rel, du.Bytes, bytes)
+		}
+	}
+
+	if len(rep.TopFiles) != 2 ||
+		rep.TopFiles[0].Path != filepath.Join(root, "docs/img/f.png") ||
+		rep.TopFiles[1].Path != filepath.Join(root, "src/pkg/d.go") {
+		t.Errorf("top files = %v", rep.TopFiles)
+	}
+	if len(rep.TopDirs) != 2 || rep.TopDirs[0].Path != root ||
+		rep.TopDirs[1].Path != filepath.Join(root, "docs") {
+		t.Errorf("top dirs = %v", rep.TopDirs)
+	}
+
+	// 100, 500 < 1KiB; 2000, 3000 < 16KiB; 20000 < 256KiB; 5000000 < 64MiB.
+	counts := []int64{2, 2, 1, 0, 1, 0, 0}
+	for i, b := range rep.Histogram {
+		if b.Files != counts[i] {
+			t.Errorf("histogram bucket %d has %d files, want %d", i, b.Files, counts[i])
+		}
+	}
+}
+
+func follow(w *walker) { w.follow = true }
+func oneFS(w *walker)  { w.oneFS = true }
+
+func TestHardLinks(t *testing.T) {
+	root := t.TempDir()
+	mkfiles(t, root, map[string]int{"a/big": 1000, "c": 10})
+	for _, name := range []string{"a/link", "b/link"} {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.Link(filepath.Join(root, "a/big"), path); err != nil {
+			t.Skipf("hard links not supported: %v", err)
+		}
+	}
+
+	rep := analyze([]string{root}, -1, 0)
+	if rep.Files != 2 || rep.Bytes != 1010 || rep.Links != 2 {
+		t.Errorf("got %d files, %d bytes, %d links; want 2, 1010, 2",
+			rep.Files, rep.Bytes, rep.Links)
+	}
+	// Whichever link is found first is charged to its directory.
+	var a, b int64
+	for _, du := range rep.Tree {
+		switch du.Path {
+		case filepath.Join(root, "a"):
+			a = du.Bytes
+		case filepath.Join(root, "b"):
+			b = du.Bytes
+		}
+	}
+	if a+b != 1000 {
+		t.Errorf("a and b hold %d and %d bytes, want 1000 in total", a, b)
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	root := t.TempDir()
+	mkfiles(t, root, map[string]int{"dir/sub/f": 100, "g": 10})
+	links := map[string]string{
+		"dir/sub/loop": "..",      // loop back to an ancestor
+		"dir/self":     ".",       // loop to its own directory
+		"alias":        "dir",     // second path to a directory
+		"file":         "g",       // second path to a file
+		"dangling":     "no-such", // broken link
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symbolic links not supported: %v", err)
+		}
+	}
+
+	// Without -L, links are files in their own right.
+	rep := analyze([]string{root}, -1, 0)
+	if rep.Files != int64(2+len(links)) || rep.Dirs != 2 {
+		t.Errorf("without -L: %d files, %d dirs; want %d, 2", rep.Files, rep.Dirs, 2+len(links))
+	}
+
+	// With -L, each file and directory is counted once, and the walk terminates.
+	rep = analyze([]string{root}, -1, 0, follow)
+	if rep.Files != 2 || rep.Dirs != 2 || rep.Bytes != 110 || rep.Links != 1 {
+		t.Errorf("with -L: %d files, %d dirs, %d bytes, %d links; want 2, 2, 110, 1",
+			rep.Files, rep.Dirs, rep.Bytes, rep.Links)
+	}
+}
+
+func TestOneFilesystem(t *testing.T) {
+	root := t.TempDir()
+	mkfiles(t, root, map[string]int{"a/b/c": 10, "d": 20, "mnt/e/f": 40})
+	if info, err := os.Stat(root); err != nil {
+		t.Fatal(err)
+	} else if _, _, ok := fileID(info); !ok {
+		t.Skip("device numbers not supported")
+	}
+	// Pretend that another filesystem is mounted on mnt.
+	mount := func(w *walker) {
+		w.fileID = func(info os.FileInfo) (fileKey, uint64, bool) {
+			id, nlink, ok := fileID(info)
+			if info.Name() == "mnt" {
+				id.dev++
+			}
+			return id, nlink, ok
+		}
+	}
+
+	rep := analyze([]string{root}, -1, 0, mount)
+	if rep.Files != 3 || rep.Dirs != 4 || rep.Bytes != 70 {
+		t.Errorf("without -x: %d files, %d dirs, %d bytes; want 3, 4, 70", rep.Files, rep.Dirs, rep.Bytes)
+	}
+	rep = analyze([]string{root}, -1, 0, mount, oneFS)
+	if rep.Files != 2 || rep.Dirs != 2 || rep.Bytes != 30 {
+		t.Errorf("with -x: %d files, %d dirs, %d bytes; want 2, 2, 30", rep.Files, rep.Dirs, rep.Bytes)
+	}
+}
+
+func TestHuman(t *testing.T) {
+	for _, test := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	} {
+		if got := human(test.n); got != test.want {
+			t.Errorf("human(%d) = %q, want %q", test.n, got, test.want)
+		}
+	}
+}
+
+func TestDupFiles(t *testing.T) {
+	root := t.TempDir()
+	big := make([]byte, 3*partialSize)
+	write := func(name string, data []byte) {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a/big1", big)
+	write("b/big2", big)
+	write("b/big3", big)
+	tail := append([]byte(nil), big...)
+	tail[len(tail)-1] = 1 // same size and first block, different content
+	write("tail", tail)
+	write("small1", []byte("hello"))
+	write("a/small2", []byte("hello"))
+	write("other", []byte("world")) // same size, different content
+	write("empty1", nil)
+	write("empty2", nil)
+	if err := os.Link(filepath.Join(root, "a/big1"), filepath.Join(root, "a/biglink")); err != nil {
+		t.Logf("hard links not supported: %v", err)
+	}
+
+	files := make(chan file)
+	newWalker(make(chan struct{}), files).walk([]string{root})
+	d := newDupFinder()
+	for f := range files {
+		d.add(f)
+	}
+	rep := d.find(4, make(chan struct{}))
+
+	want := []DupGroup{
+		{int64(len(big)), []string{"a/big1", "b/big2", "b/big3"}, 2 * int64(len(big))},
+		{5, []string{"a/small2", "small1"}, 5},
+	}
+	if len(rep.Groups) != len(want) {
+		t.Fatalf("got %d groups, want %d: %v", len(rep.Groups), len(want), rep.Groups)
+	}
+	for i, g := range rep.Groups {
+		var rel []string
+		for _, path := range g.Paths {
+			r, _ := filepath.Rel(root, path)
+			rel = append(rel, filepath.ToSlash(r))
+		}
+		if rel[0] == "a/biglink" {
+			rel[0] = "a/big1" // either link may be found first
+			sort.Strings(rel)
+		}
+		w := want[i]
+		if g.Size != w.Size || g.Reclaimable != w.Reclaimable || strings.Join(rel, " ") != strings.Join(w.Paths, " ") {
+			t.Errorf("group %d = %d bytes %v (%d reclaimable), want %d bytes %v (%d reclaimable)",
+				i, g.Size, rel, g.Reclaimable, w.Size, w.Paths, w.Reclaimable)
+		}
+	}
+	if rep.Reclaimable != 2*int64(len(big))+5 {
+		t.Errorf("reclaimable = %d, want %d", rep.Reclaimable, 2*len(big)+5)
+	}
+}
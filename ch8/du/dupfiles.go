@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// partialSize is the number of leading bytes hashed to
+// tell apart files of the same size cheaply.
+const partialSize = 4096
+
+// A DupGroup is a set of files with identical content.
+type DupGroup struct {
+	Size        int64    `json:"size"` // size of each file
+	Paths       []string `json:"paths"`
+	Reclaimable int64    `json:"reclaimable"` // bytes freed by keeping one copy
+}
+
+// A DupReport lists the groups of duplicate files, largest savings first.
+type DupReport struct {
+	Files       int64      `json:"files"` // files examined
+	Groups      []DupGroup `json:"groups"`
+	Reclaimable int64      `json:"reclaimable"`
+}
+
+// A dupFinder accumulates the entries found by a walker
+// and finds those with identical content.
+// It is not safe for concurrent use.
+type dupFinder struct {
+	bySize map[int64][]string
+	seen   map[fileKey]bool // shared files recorded so far
+	nfiles int64
+	nbytes int64
+}
+
+func newDupFinder() *dupFinder {
+	return &dupFinder{
+		bySize: make(map[int64][]string),
+		seen:   make(map[fileKey]bool),
+	}
+}
+
+// add records a regular file. Empty files, directories, symbolic
+// links and further hard links to a file already recorded are ignored,
+// since removing them would reclaim no space.
+func (d *dupFinder) add(f file) {
+	if f.isDir || !f.mode.IsRegular() || f.size == 0 {
+		return
+	}
+	if f.shared {
+		if d.seen[f.id] {
+			return
+		}
+		d.seen[f.id] = true
+	}
+	d.nfiles++
+	d.nbytes += f.size
+	d.bySize[f.size] = append(d.bySize[f.size], f.path)
+}
+
+func (d *dupFinder) progress() (nfiles, nbytes int64) { return d.nfiles, d.nbytes }
+
+// A dupGroup is a set of files that may have identical content.
+type dupGroup struct {
+	size  int64
+	paths []string
+}
+
+// find narrows the recorded files down to groups of duplicates:
+// first by size, then by a hash of the first partialSize bytes,
+// and finally by a SHA-256 hash of the whole file. At most workers
+// files are read at once. It returns nil if done is closed.
+func (d *dupFinder) find(workers int, done <-chan struct{}) *DupReport {
+	var groups []dupGroup
+	for size, paths := range d.bySize {
+		if len(paths) > 1 {
+			groups = append(groups, dupGroup{size, paths})
+		}
+	}
+
+	groups = regroup(groups, partialSize, workers, done)
+	var small, large []dupGroup
+	for _, g := range groups {
+		if g.size <= partialSize {
+			small = append(small, g) // already hashed in full
+		} else {
+			large = append(large, g)
+		}
+	}
+	groups = append(small, regroup(large, -1, workers, done)...)
+
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+
+	rep := &DupReport{Files: d.nfiles}
+	for _, g := range groups {
+		sort.Strings(g.paths)
+		r := g.size * int64(len(g.paths)-1)
+		rep.Groups = append(rep.Groups, DupGroup{g.size, g.paths, r})
+		rep.Reclaimable += r
+	}
+	sort.Slice(rep.Groups, func(i, j int) bool {
+		gi, gj := rep.Groups[i], rep.Groups[j]
+		if gi.Reclaimable != gj.Reclaimable {
+			return gi.Reclaimable > gj.Reclaimable
+		}
+		return gi.Paths[0] < gj.Paths[0]
+	})
+	return rep
+}
+
+type digest [sha256.Size]byte
+
+// regroup splits each group by the hash of the first limit bytes
+// of its files (all of them if limit is negative), keeping only
+// the subgroups that still contain more than one file.
+func regroup(groups []dupGroup, limit int64, workers int, done <-chan struct{}) []dupGroup {
+	var paths []string
+	for _, g := range groups {
+		paths = append(paths, g.paths...)
+	}
+	sums := hashAll(paths, limit, workers, done)
+
+	var result []dupGroup
+	for _, g := range groups {
+		byHash := make(map[digest][]string)
+		for _, path := range g.paths {
+			if sum, ok := sums[path]; ok {
+				byHash[sum] = append(byHash[sum], path)
+			}
+		}
+		for _, same := range byHash {
+			if len(same) > 1 {
+				result = append(result, dupGroup{g.size, same})
+			}
+		}
+	}
+	return result
+}
+
+// hashAll hashes the first limit bytes of each file using a pool of
+// workers. Files that cannot be read are reported and left out.
+// If done is closed, hashAll stops early and returns partial results.
+func hashAll(paths []string, limit int64, workers int, done <-chan struct{}) map[string]digest {
+	type result struct {
+		path string
+		sum  digest
+		err  error
+	}
+	jobs := make(chan string)
+	results := make(chan result)
+
+	go func() {
+		defer close(jobs)
+		for _, path := range paths {
+			select {
+			case jobs <- path:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				sum, err := hashFile(path, limit)
+				select {
+				case results <- result{path, sum, err}:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	sums := make(map[string]digest)
+	for r := range results {
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "du: %v\n", r.err)
+			continue
+		}
+		sums[r.path] = r.sum
+	}
+	return sums
+}
+
+// hashFile returns the SHA-256 hash of the first limit bytes
+// of the named file, or of the whole file if limit is negative.
+func hashFile(path string, limit int64) (digest, error) {
+	var sum digest
+	f, err := os.Open(path)
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return sum, fmt.Errorf("reading %s: %v", path, err)
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,12 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// fileID reports that device and inode numbers are unavailable,
+// which disables hard-link deduplication and the -x flag.
+func fileID(info os.FileInfo) (id fileKey, nlink uint64, ok bool) {
+	return fileKey{}, 0, false
+}
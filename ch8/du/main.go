@@ -0,0 +1,206 @@
+// The du command analyzes the disk usage of one or more file trees.
+//
+// It reports the total size of each directory down to -depth levels,
+// the -top largest files and directories, and a histogram of file
+// sizes, as text or JSON. Like du4, it walks the trees in parallel
+// and terminates quickly when the user hits return.
+//
+// A file with several hard links is counted once. Symbolic links are
+// not followed unless -L is given; each directory is entered at most
+// once, so links that form a loop are harmless. The -x flag skips
+// directories on filesystems other than that of their root.
+//
+// With -dupfiles, du instead reports groups of files with identical
+// content and the space that removing the copies would reclaim.
+//
+// Usage:
+//
+//	$ go run ./ch8/du -depth=2 -top=5 $HOME/go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	depth   = flag.Int("depth", 1, "report directories at most `n` levels below a root (-1 for all)")
+	top     = flag.Int("top", 10, "report the `n` largest files and directories")
+	format  = flag.String("format", "text", "output format: text or json")
+	hFlag   = flag.Bool("h", true, "print sizes in human-readable units")
+	verbose = flag.Bool("v", false, "show verbose progress messages")
+	lFlag   = flag.Bool("L", false, "follow symbolic links")
+	xFlag   = flag.Bool("x", false, "stay on the filesystem of each root")
+	dupFlag = flag.Bool("dupfiles", false, "report files with identical content")
+	workers = flag.Int("j", 8, "hash at most `n` files at once (with -dupfiles)")
+)
+
+// A collector accumulates the entries found by a walker.
+type collector interface {
+	add(f file)
+	progress() (nfiles, nbytes int64)
+}
+
+var done = make(chan struct{})
+
+func main() {
+	flag.Parse()
+	if *format != "text" && *format != "json" {
+		log.Fatalf("du: unknown format %q", *format)
+	}
+	if *workers < 1 {
+		log.Fatalf("du: -j %d: must be at least 1", *workers)
+	}
+
+	// Determine the initial directories.
+	roots := flag.Args()
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+
+	// Cancel traversal when input is detected.
+	go func() {
+		os.Stdin.Read(make([]byte, 1)) // read a single byte
+		close(done)
+	}()
+
+	files := make(chan file)
+	w := newWalker(done, files)
+	w.follow, w.oneFS = *lFlag, *xFlag
+	w.walk(roots)
+
+	u := newUsage(roots, *top)
+	d := newDupFinder()
+	var c collector = u
+	if *dupFlag {
+		c = d
+	}
+
+	// Print progress periodically if requested.
+	var tick <-chan time.Time
+	if *verbose {
+		tick = time.Tick(500 * time.Millisecond)
+	}
+loop:
+	for {
+		select {
+		case <-done:
+			// Drain files to allow existing goroutines to finish.
+			for range files {
+				// Do nothing.
+			}
+			return
+		case f, ok := <-files:
+			if !ok {
+				break loop // files was closed
+			}
+			c.add(f)
+		case <-tick:
+			nfiles, nbytes := c.progress()
+			fmt.Fprintf(os.Stderr, "%d files  %s\n", nfiles, human(nbytes))
+		}
+	}
+
+	size := func(n int64) string { return fmt.Sprint(n) }
+	if *hFlag {
+		size = human
+	}
+	var err error
+	if *dupFlag {
+		rep := d.find(*workers, done)
+		if rep == nil {
+			return // cancelled
+		}
+		if *format == "json" {
+			err = writeJSON(os.Stdout, rep)
+		} else {
+			err = writeDupText(os.Stdout, rep, size)
+		}
+	} else {
+		rep := u.report(*depth)
+		if *format == "json" {
+			err = writeJSON(os.Stdout, rep)
+		} else {
+			err = writeText(os.Stdout, rep, size)
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeJSON(w io.Writer, rep interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// writeText writes rep in a du-like format, using size to format byte counts.
+func writeText(w io.Writer, rep *Report, size func(int64) string) error {
+	for _, du := range rep.Tree {
+		fmt.Fprintf(w, "%10s  %s\n", size(du.Bytes), du.Path)
+	}
+	fmt.Fprintf(w, "\n%d files  %d dirs  %s total", rep.Files, rep.Dirs, size(rep.Bytes))
+	if rep.Links > 0 {
+		fmt.Fprintf(w, "  (%d duplicate links not counted)", rep.Links)
+	}
+	fmt.Fprintln(w)
+
+	if len(rep.TopFiles) > 0 {
+		fmt.Fprintf(w, "\nlargest files:\n")
+		for _, f := range rep.TopFiles {
+			fmt.Fprintf(w, "%10s  %s\n", size(f.Bytes), f.Path)
+		}
+	}
+	if len(rep.TopDirs) > 0 {
+		fmt.Fprintf(w, "\nlargest directories:\n")
+		for _, du := range rep.TopDirs {
+			fmt.Fprintf(w, "%10s  %s\n", size(du.Bytes), du.Path)
+		}
+	}
+
+	fmt.Fprintf(w, "\nfile sizes:\n")
+	var most int64
+	for _, b := range rep.Histogram {
+		if b.Files > most {
+			most = b.Files
+		}
+	}
+	for i, b := range rep.Histogram {
+		var label string
+		if b.Max == 0 {
+			label = ">= " + human(rep.Histogram[i-1].Max)
+		} else {
+			label = "< " + human(b.Max)
+		}
+		bar := 0
+		if most > 0 {
+			bar = int(40 * b.Files / most)
+		}
+		_, err := fmt.Fprintf(w, "%12s  %8d files  %10s  %s\n",
+			label, b.Files, size(b.Bytes), strings.Repeat("#", bar))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeDupText writes each group of duplicates, largest savings first.
+func writeDupText(w io.Writer, rep *DupReport, size func(int64) string) error {
+	for _, g := range rep.Groups {
+		fmt.Fprintf(w, "%d copies of %s (%s reclaimable)\n", len(g.Paths), size(g.Size), size(g.Reclaimable))
+		for _, path := range g.Paths {
+			fmt.Fprintf(w, "\t%s\n", path)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d files examined, %d groups of duplicates, %s reclaimable\n",
+		rep.Files, len(rep.Groups), size(rep.Reclaimable))
+	return err
+}
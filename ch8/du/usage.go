@@ -0,0 +1,204 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A DirUsage is the total size of the files beneath a directory.
+type DirUsage struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"` // 0 for a root
+	Files int64  `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// A FileUsage is the size of a single file.
+type FileUsage struct {
+	Path  string `json:"path"`
+	Bytes int64  `json:"bytes"`
+}
+
+// A Bucket counts the files whose sizes fall below Max
+// and at or above the previous bucket's Max.
+type Bucket struct {
+	Max   int64 `json:"max,omitempty"` // 0 for the last, unbounded bucket
+	Files int64 `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// A Report is the result of a disk-usage analysis.
+type Report struct {
+	Roots     []string    `json:"roots"`
+	Files     int64       `json:"files"`
+	Dirs      int64       `json:"dirs"`
+	Bytes     int64       `json:"bytes"`
+	Links     int64       `json:"links"` // extra paths to files already counted
+	Tree      []*DirUsage `json:"tree"`  // directories within the depth limit, by path
+	TopFiles  []FileUsage `json:"topFiles,omitempty"`
+	TopDirs   []*DirUsage `json:"topDirs,omitempty"`
+	Histogram []Bucket    `json:"histogram"`
+}
+
+// histogramBounds are the upper bounds of the size histogram buckets.
+var histogramBounds = []int64{1 << 10, 1 << 14, 1 << 18, 1 << 22, 1 << 26, 1 << 30}
+
+// usage accumulates the entries found by a walker.
+// It is not safe for concurrent use.
+type usage struct {
+	roots    []string
+	dirs     map[string]*DirUsage
+	top      int
+	topFiles fileHeap
+	hist     []Bucket
+	seen     map[fileKey]bool // shared files counted so far
+	nfiles   int64
+	ndirs    int64
+	nbytes   int64
+	nlinks   int64
+}
+
+func newUsage(roots []string, top int) *usage {
+	u := &usage{
+		dirs: make(map[string]*DirUsage),
+		top:  top,
+		seen: make(map[fileKey]bool),
+	}
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		u.roots = append(u.roots, root)
+		u.dir(root, root)
+	}
+	for _, max := range histogramBounds {
+		u.hist = append(u.hist, Bucket{Max: max})
+	}
+	u.hist = append(u.hist, Bucket{})
+	return u
+}
+
+// add records one entry, charging a file's size
+// to each directory between it and its root.
+// A file reachable by several paths is counted only once.
+func (u *usage) add(f file) {
+	if f.isDir {
+		u.ndirs++
+		u.dir(f.root, f.path)
+		return
+	}
+	if f.shared {
+		if u.seen[f.id] {
+			u.nlinks++
+			return
+		}
+		u.seen[f.id] = true
+	}
+	u.nfiles++
+	u.nbytes += f.size
+
+	i := sort.Search(len(histogramBounds), func(i int) bool { return f.size < histogramBounds[i] })
+	u.hist[i].Files++
+	u.hist[i].Bytes += f.size
+
+	if u.top > 0 {
+		heap.Push(&u.topFiles, FileUsage{f.path, f.size})
+		if len(u.topFiles) > u.top {
+			heap.Pop(&u.topFiles)
+		}
+	}
+
+	for d := filepath.Dir(f.path); ; d = filepath.Dir(d) {
+		du := u.dir(f.root, d)
+		du.Files++
+		du.Bytes += f.size
+		if d == f.root || d == filepath.Dir(d) {
+			break
+		}
+	}
+}
+
+func (u *usage) progress() (nfiles, nbytes int64) { return u.nfiles, u.nbytes }
+
+// dir returns the usage of directory path beneath root, creating it if needed.
+func (u *usage) dir(root, path string) *DirUsage {
+	du, ok := u.dirs[path]
+	if !ok {
+		du = &DirUsage{Path: path}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." {
+			du.Depth = strings.Count(rel, string(filepath.Separator)) + 1
+		}
+		u.dirs[path] = du
+	}
+	return du
+}
+
+// report returns the accumulated usage. Tree includes only the
+// directories at most depth levels below a root, or all of them
+// if depth is negative.
+func (u *usage) report(depth int) *Report {
+	rep := &Report{
+		Roots:     u.roots,
+		Files:     u.nfiles,
+		Dirs:      u.ndirs,
+		Bytes:     u.nbytes,
+		Links:     u.nlinks,
+		Histogram: u.hist,
+	}
+	var all []*DirUsage
+	for _, du := range u.dirs {
+		all = append(all, du)
+		if depth < 0 || du.Depth <= depth {
+			rep.Tree = append(rep.Tree, du)
+		}
+	}
+	sort.Slice(rep.Tree, func(i, j int) bool { return rep.Tree[i].Path < rep.Tree[j].Path })
+
+	if u.top > 0 {
+		rep.TopFiles = append([]FileUsage(nil), u.topFiles...)
+		sort.Slice(rep.TopFiles, func(i, j int) bool {
+			return rep.TopFiles[i].Bytes > rep.TopFiles[j].Bytes
+		})
+		sort.Slice(all, func(i, j int) bool {
+			if all[i].Bytes != all[j].Bytes {
+				return all[i].Bytes > all[j].Bytes
+			}
+			return all[i].Path < all[j].Path
+		})
+		if len(all) > u.top {
+			all = all[:u.top]
+		}
+		rep.TopDirs = all
+	}
+	return rep
+}
+
+// A fileHeap is a min-heap of files ordered by size,
+// used to keep the largest files seen so far.
+type fileHeap []FileUsage
+
+func (h fileHeap) Len() int            { return len(h) }
+func (h fileHeap) Less(i, j int) bool  { return h[i].Bytes < h[j].Bytes }
+func (h fileHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *fileHeap) Push(x interface{}) { *h = append(*h, x.(FileUsage)) }
+func (h *fileHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// human formats n bytes using binary units, e.g. "1.5 MiB".
+func human(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A fileKey identifies a file independently of the paths that lead to it.
+type fileKey struct {
+	dev, ino uint64
+}
+
+// A file is an entry found by the walker.
+type file struct {
+	root  string // root of the walk that found the entry
+	path  string
+	size  int64
+	mode  os.FileMode
+	isDir bool
+
+	// id identifies the file if shared is set, meaning that the
+	// file may be reachable by more than one path (a hard link,
+	// or the target of a followed symbolic link).
+	id     fileKey
+	shared bool
+}
+
+// A walker traverses file trees in parallel, sending every entry it
+// finds on files. A counting semaphore limits the number of directories
+// read at once, and the walk stops early once done is closed.
+type walker struct {
+	done  <-chan struct{}
+	sema  chan struct{}
+	files chan<- file
+	n     sync.WaitGroup
+
+	follow bool // follow symbolic links
+	oneFS  bool // don't cross filesystem boundaries
+
+	devs map[string]uint64 // device of each root, for oneFS
+
+	// fileID identifies files; tests replace it to simulate
+	// mount points.
+	fileID func(os.FileInfo) (id fileKey, nlink uint64, ok bool)
+
+	mu      sync.Mutex
+	visited map[fileKey]bool // directories entered so far
+}
+
+func newWalker(done <-chan struct{}, files chan<- file) *walker {
+	return &walker{
+		done:    done,
+		sema:    make(chan struct{}, 20),
+		files:   files,
+		devs:    make(map[string]uint64),
+		fileID:  fileID,
+		visited: make(map[fileKey]bool),
+	}
+}
+
+func (w *walker) cancelled() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// walk traverses each root in parallel and
+// closes w.files once every walk has finished.
+func (w *walker) walk(roots []string) {
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if info, err := os.Stat(root); err == nil {
+			if id, _, ok := w.fileID(info); ok {
+				w.devs[root] = id.dev
+				w.visit(id)
+			}
+		}
+		w.n.Add(1)
+		go w.walkDir(root, root)
+	}
+	go func() {
+		w.n.Wait()
+		close(w.files)
+	}()
+}
+
+// visit records that the directory id has been entered and
+// reports whether this is the first time.
+func (w *walker) visit(id fileKey) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.visited[id] {
+		return false
+	}
+	w.visited[id] = true
+	return true
+}
+
+// walkDir recursively walks the file tree rooted at dir
+// and sends each entry found on w.files.
+//
+// Each directory is entered at most once, so following a symbolic
+// link that leads back to an ancestor cannot cause an endless walk.
+func (w *walker) walkDir(root, dir string) {
+	defer w.n.Done()
+	if w.cancelled() {
+		return
+	}
+	for _, entry := range w.dirents(dir) {
+		path := filepath.Join(dir, entry.Name())
+		linked := entry.Mode()&os.ModeSymlink != 0 && w.follow
+		if linked {
+			info, err := os.Stat(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "du: %v\n", err) // e.g., dangling link
+				continue
+			}
+			entry = info
+		}
+		id, nlink, ok := w.fileID(entry)
+		if entry.IsDir() {
+			if ok {
+				if w.oneFS && id.dev != w.devs[root] {
+					continue // mount point of another filesystem
+				}
+				if !w.visit(id) {
+					if linked {
+						fmt.Fprintf(os.Stderr, "du: %s: directory already visited\n", path)
+					}
+					continue
+				}
+			}
+			w.files <- file{root: root, path: path, mode: entry.Mode(), isDir: true}
+			w.n.Add(1)
+			go w.walkDir(root, path)
+		} else {
+			w.files <- file{
+				root:   root,
+				path:   path,
+				size:   entry.Size(),
+				mode:   entry.Mode(),
+				id:     id,
+				shared: ok && (nlink > 1 || w.follow),
+			}
+		}
+	}
+}
+
+// dirents returns the entries of directory dir.
+func (w *walker) dirents(dir string) []os.FileInfo {
+	select {
+	case w.sema <- struct{}{}: // acquire token
+	case <-w.done:
+		return nil // cancelled
+	}
+	defer func() { <-w.sema }() // release token
+
+	f, err := os.Open(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "du: %v\n", err)
+		return nil
+	}
+	defer f.Close()
+
+	entries, err := f.Readdir(0) // 0 => no limit; read all entries
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "du: %v\n", err)
+		// Don't return: Readdir may return partial results.
+	}
+	return entries
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxRedirects = 10
+
+// A Result records the outcome of checking one link.
+type Result struct {
+	URL         string   `json:"url"`
+	Status      int      `json:"status,omitempty"` // status of the final response
+	Err         string   `json:"error,omitempty"`
+	Redirects   []Hop    `json:"redirects,omitempty"`
+	Final       string   `json:"final"` // URL after following redirects
+	ContentType string   `json:"contentType,omitempty"`
+	Referrers   []string `json:"referrers,omitempty"` // pages that link to URL
+}
+
+// A Hop is one step of a redirect chain: a request for URL
+// answered with a redirect Status.
+type Hop struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// Broken reports whether the link could not be fetched
+// or its final response was an error.
+func (r *Result) Broken() bool {
+	return r.Err != "" || r.Status >= 400
+}
+
+func (r *Result) addReferrer(page string) {
+	if page == "" {
+		return
+	}
+	for _, p := range r.Referrers {
+		if p == page {
+			return
+		}
+	}
+	r.Referrers = append(r.Referrers, page)
+}
+
+// check requests url, following and recording any redirects.
+// It tries HEAD first and falls back to GET for servers
+// that do not support HEAD. If page is not nil, check uses GET
+// instead and, if the response is a healthy HTML page, calls page
+// with it before closing its body, so that a page to be crawled is
+// fetched only once.
+func check(url string, page func(*http.Response)) *Result {
+	r := &Result{URL: url, Final: url}
+	method := http.MethodHead
+	if page != nil {
+		method = http.MethodGet
+	}
+	resp, err := request(r, method)
+	if err == nil && method == http.MethodHead &&
+		(resp.StatusCode == http.StatusMethodNotAllowed ||
+			resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		r.Redirects = nil
+		resp, err = request(r, http.MethodGet)
+	}
+	if err != nil {
+		r.Err = err.Error()
+		return r
+	}
+	defer resp.Body.Close()
+	r.Status = resp.StatusCode
+	r.Final = resp.Request.URL.String()
+	r.ContentType = resp.Header.Get("Content-Type")
+	if page != nil && resp.StatusCode == http.StatusOK &&
+		strings.HasPrefix(r.ContentType, "text/html") {
+		page(resp)
+	}
+	return r
+}
+
+// request issues a single request for r.URL with the given method,
+// appending each redirect it follows to r.Redirects. The caller must
+// close the body of the response.
+func request(r *Result, method string) (*http.Response, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			prev := via[len(via)-1]
+			r.Redirects = append(r.Redirects, Hop{prev.URL.String(), req.Response.StatusCode})
+			return nil
+		},
+	}
+	req, err := http.NewRequest(method, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
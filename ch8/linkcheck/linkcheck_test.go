@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestCrawl(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/a">a</a> <a href="/missing">missing</a>
+			<a href="/old#top">old</a> <a href="mailto:x@example.com">mail</a>
+			<img src="/logo.png">`)
+	})
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/">home</a> <a href="/missing">missing</a>`)
+	})
+	mux.Handle("/old", http.RedirectHandler("/older", http.StatusMovedPermanently))
+	mux.Handle("/older", http.RedirectHandler("/a", http.StatusFound))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	rep := crawl([]string{ts.URL + "/"}, 3, 4)
+	if rep.Checked != 5 {
+		t.Errorf("checked %d links, want 5", rep.Checked)
+	}
+	if list := rep.Broken[ts.URL+"/"]; len(list) != 2 || list[0].URL != ts.URL+"/logo.png" {
+		t.Errorf("broken links on / = %v, want [/logo.png /missing]", list)
+	}
+
+	missing := ts.URL + "/missing"
+	if list := rep.Broken[ts.URL+"/a"]; len(list) != 1 || list[0].URL != missing || list[0].Status != http.StatusNotFound {
+		t.Errorf("broken links on /a = %v, want [%s]", list, missing)
+	}
+	if len(rep.Broken) != 2 {
+		t.Errorf("%d pages with broken links, want 2", len(rep.Broken))
+	}
+
+	redirected := rep.Redirected()
+	if len(redirected) != 1 {
+		t.Fatalf("%d redirected links, want 1", len(redirected))
+	}
+	r := redirected[0]
+	want := []Hop{{ts.URL + "/old", 301}, {ts.URL + "/older", 302}}
+	if fmt.Sprint(r.Redirects) != fmt.Sprint(want) || r.Final != ts.URL+"/a" || r.Status != 200 {
+		t.Errorf("redirect chain = %v -> %s (%d), want %v -> %s/a (200)",
+			r.Redirects, r.Final, r.Status, want, ts.URL)
+	}
+}
+
+func TestFetchOnce(t *testing.T) {
+	requests := make(map[string][]string) // path -> methods
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path] = append(requests[r.URL.Path], r.Method)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	rep := crawl([]string{ts.URL + "/"}, 1, 4)
+	if rep.Checked != 2 {
+		t.Errorf("checked %d links, want 2", rep.Checked)
+	}
+	// The page is crawled, so fetched with GET alone; the link at
+	// the maximum depth is only checked.
+	want := map[string][]string{"/": {"GET"}, "/a": {"HEAD"}}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
@@ -0,0 +1,151 @@
+// Linkcheck crawls the pages reachable from the command-line URLs and
+// reports the HTTP status of every link it discovers.
+//
+// Pages on the same hosts as the starting URLs are crawled up to -depth
+// levels deep; links to other hosts are checked but not crawled.
+// Redirect chains are recorded, and broken links are grouped by the
+// pages that reference them.
+//
+// Usage:
+//
+//	$ go run ./ch8/linkcheck -format=html https://example.com/ > report.html
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+
+	"gopl.io/ch5/links"
+)
+
+var (
+	format  = flag.String("format", "text", "report format: text, json or html")
+	depth   = flag.Int("depth", 3, "maximum crawl depth from the starting pages")
+	workers = flag.Int("n", 20, "maximum number of concurrent requests")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: linkcheck [flags] url...\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	w, ok := writers[*format]
+	if !ok {
+		log.Fatalf("linkcheck: unknown format %q", *format)
+	}
+	report := crawl(flag.Args(), *depth, *workers)
+	if err := w(os.Stdout, report); err != nil {
+		log.Fatal(err)
+	}
+	if len(report.Broken) > 0 {
+		os.Exit(1)
+	}
+}
+
+// A link is a URL to be checked, together with the page that
+// referenced it and its distance from the starting pages.
+type link struct {
+	url      string
+	referrer string // empty for the starting pages
+	depth    int
+}
+
+// A visit is the outcome of checking one link.
+type visit struct {
+	result *Result
+	found  []link
+}
+
+// crawl checks every link reachable from roots and returns the report.
+// At most workers requests are in flight at once.
+func crawl(roots []string, maxDepth, workers int) *Report {
+	hosts := make(map[string]bool)
+	var start []link
+	for _, root := range roots {
+		u, err := url.Parse(root)
+		if err != nil {
+			log.Printf("linkcheck: %v", err)
+			continue
+		}
+		hosts[u.Host] = true
+		start = append(start, link{url: normalize(u)})
+	}
+
+	tokens := make(chan struct{}, workers) // counting semaphore
+	visits := make(chan visit)
+	results := make(map[string]*Result)
+	var n int // number of pending visits
+
+	enqueue := func(list []link) {
+		for _, l := range list {
+			if r, ok := results[l.url]; ok {
+				r.addReferrer(l.referrer)
+				continue
+			}
+			r := &Result{URL: l.url}
+			r.addReferrer(l.referrer)
+			results[l.url] = r
+			n++
+			go func(l link) {
+				tokens <- struct{}{} // acquire a token
+				v := fetch(l, hosts, maxDepth)
+				<-tokens // release the token
+				visits <- v
+			}(l)
+		}
+	}
+
+	enqueue(start)
+	for ; n > 0; n-- {
+		v := <-visits
+		r := results[v.result.URL]
+		v.result.Referrers = r.Referrers
+		*r = *v.result
+		enqueue(v.found)
+	}
+	return newReport(results)
+}
+
+// fetch checks the status of l and, if l is a healthy HTML page on
+// one of the crawled hosts, extracts the links it contains.
+// Links of every kind are checked, but only HTML pages are crawled.
+func fetch(l link, hosts map[string]bool, maxDepth int) visit {
+	var list []links.Link
+	var page func(*http.Response)
+	if u, err := url.Parse(l.url); err == nil && hosts[u.Host] && l.depth < maxDepth {
+		page = func(resp *http.Response) {
+			if !hosts[resp.Request.URL.Host] {
+				return // redirected to another host
+			}
+			var err error
+			list, err = links.ExtractFrom(resp.Body, resp.Request.URL)
+			if err != nil {
+				log.Printf("parsing %s as HTML: %v", resp.Request.URL, err)
+			}
+		}
+	}
+	r := check(l.url, page)
+	var found []link
+	for _, ref := range list {
+		u, err := url.Parse(ref.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue // ignore mailto:, javascript:, etc.
+		}
+		found = append(found, link{url: normalize(u), referrer: r.Final, depth: l.depth + 1})
+	}
+	return visit{result: r, found: found}
+}
+
+// normalize returns u without its fragment, so that links to
+// different sections of one page are checked only once.
+func normalize(u *url.URL) string {
+	v := *u
+	v.Fragment = ""
+	return v.String()
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// startPage is the referrer under which broken starting URLs are listed.
+const startPage = "(command line)"
+
+// A Report summarizes a crawl.
+type Report struct {
+	Checked int       `json:"checked"`
+	Results []*Result `json:"results"` // sorted by URL
+
+	// Broken maps each page to the broken links it references.
+	Broken map[string][]*Result `json:"broken"`
+}
+
+func newReport(results map[string]*Result) *Report {
+	rep := &Report{Broken: make(map[string][]*Result)}
+	for _, r := range results {
+		rep.Results = append(rep.Results, r)
+		if !r.Broken() {
+			continue
+		}
+		if len(r.Referrers) == 0 {
+			rep.Broken[startPage] = append(rep.Broken[startPage], r)
+		}
+		for _, page := range r.Referrers {
+			rep.Broken[page] = append(rep.Broken[page], r)
+		}
+	}
+	rep.Checked = len(rep.Results)
+	sort.Slice(rep.Results, func(i, j int) bool {
+		return rep.Results[i].URL < rep.Results[j].URL
+	})
+	for _, list := range rep.Broken {
+		sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+	}
+	return rep
+}
+
+// Pages returns the pages with broken links, in order.
+func (rep *Report) Pages() []string {
+	var pages []string
+	for page := range rep.Broken {
+		pages = append(pages, page)
+	}
+	sort.Strings(pages)
+	return pages
+}
+
+// Redirected returns the results that followed at least one redirect.
+func (rep *Report) Redirected() []*Result {
+	var list []*Result
+	for _, r := range rep.Results {
+		if len(r.Redirects) > 0 {
+			list = append(list, r)
+		}
+	}
+	return list
+}
+
+// Describe returns a short description of the outcome of r,
+// such as "404 Not Found" or the transport error.
+func (r *Result) Describe() string {
+	if r.Err != "" {
+		return r.Err
+	}
+	return fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+}
+
+var writers = map[string]func(io.Writer, *Report) error{
+	"text": writeText,
+	"json": writeJSON,
+	"html": writeHTML,
+}
+
+func writeText(w io.Writer, rep *Report) error {
+	fmt.Fprintf(w, "%d links checked, %d pages with broken links\n", rep.Checked, len(rep.Broken))
+	for _, page := range rep.Pages() {
+		fmt.Fprintf(w, "\n%s\n", page)
+		for _, r := range rep.Broken[page] {
+			fmt.Fprintf(w, "\t%s\t%s\n", r.URL, r.Describe())
+		}
+	}
+	if redirected := rep.Redirected(); len(redirected) > 0 {
+		fmt.Fprintf(w, "\nredirects\n")
+		for _, r := range redirected {
+			fmt.Fprintf(w, "\t")
+			for _, hop := range r.Redirects {
+				fmt.Fprintf(w, "%s -%d-> ", hop.URL, hop.Status)
+			}
+			fmt.Fprintf(w, "%s (%s)\n", r.Final, r.Describe())
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, rep *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+var reportHTML = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Link check report</title></head>
+<body>
+<h1>{{.Checked}} links checked, {{len .Broken}} pages with broken links</h1>
+{{range $page := .Pages}}
+<h2>{{$page}}</h2>
+<table>
+<tr style='text-align: left'><th>Link</th><th>Status</th></tr>
+{{range index $.Broken $page}}
+<tr><td><a href='{{.URL}}'>{{.URL}}</a></td><td>{{.Describe}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{with .Redirected}}
+<h2>Redirects</h2>
+<ul>
+{{range .}}
+<li>{{range .Redirects}}{{.URL}} &rarr; {{.Status}} &rarr; {{end}}{{.Final}} ({{.Describe}})</li>
+{{end}}
+</ul>
+{{end}}
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, rep *Report) error {
+	return reportHTML.Execute(w, rep)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopl.io/ch8/thumbnail"
+)
+
+// A job is one image to be thumbnailed.
+type job struct {
+	name string // file name or name of the upload
+	open func() (io.ReadCloser, error)
+}
+
+// fileJob returns a job that reads the named file.
+func fileJob(name string) job {
+	return job{name, func() (io.ReadCloser, error) { return os.Open(name) }}
+}
+
+// A Result reports the outcome of one job.
+type Result struct {
+	Name      string `json:"name"`
+	Thumbnail string `json:"thumbnail,omitempty"` // location of the output
+	Bytes     int64  `json:"bytes,omitempty"`     // size of the output
+	Cached    bool   `json:"cached,omitempty"`    // output was already in the cache
+	Err       string `json:"error,omitempty"`
+}
+
+// A Manifest reports the outcome of a batch, in job order.
+type Manifest struct {
+	Results    []Result `json:"results"`
+	Succeeded  int      `json:"succeeded"`
+	Failed     int      `json:"failed"`
+	TotalBytes int64    `json:"totalBytes"` // bytes occupied by the thumbnails
+}
+
+// A cache stores thumbnails in a directory, named by a hash of the
+// source image's content and the options used to make them.
+type cache struct {
+	dir string
+}
+
+// key returns the cache file name for a thumbnail of data made with opts.
+func (c *cache) key(data []byte, opts thumbnail.Options) string {
+	h := sha256.New()
+	h.Write(data)
+	fmt.Fprintf(h, "\x00%d %d %s %s %s", opts.Width, opts.Height, opts.Fit, opts.Filter, opts.Format)
+	return hex.EncodeToString(h.Sum(nil)) + opts.Ext()
+}
+
+// thumbnails makes a thumbnail of each job, running at most workers
+// jobs at once. Jobs that have not finished when ctx is cancelled
+// fail with the context's error; the others are unaffected.
+func (c *cache) thumbnails(ctx context.Context, jobs []job, opts thumbnail.Options, workers int) *Manifest {
+	results := make([]Result, len(jobs))
+	sema := make(chan struct{}, workers) // counting semaphore
+	var wg sync.WaitGroup
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j job) {
+			defer wg.Done()
+			select {
+			case sema <- struct{}{}: // acquire token
+			case <-ctx.Done():
+				results[i] = Result{Name: j.name, Err: ctx.Err().Error()}
+				return
+			}
+			defer func() { <-sema }() // release token
+			results[i] = c.thumbnail(ctx, j, opts)
+		}(i, j)
+	}
+	wg.Wait()
+
+	m := &Manifest{Results: results}
+	for _, r := range results {
+		if r.Err != "" {
+			m.Failed++
+		} else {
+			m.Succeeded++
+			m.TotalBytes += r.Bytes
+		}
+	}
+	return m
+}
+
+// thumbnail makes a thumbnail for j, or finds it in the cache.
+func (c *cache) thumbnail(ctx context.Context, j job, opts thumbnail.Options) Result {
+	res := Result{Name: j.name}
+	fail := func(err error) Result {
+		res.Err = err.Error()
+		return res
+	}
+
+	in, err := j.open()
+	if err != nil {
+		return fail(err)
+	}
+	data, err := ioutil.ReadAll(in)
+	in.Close()
+	if err != nil {
+		return fail(err)
+	}
+
+	key := c.key(data, opts)
+	path := filepath.Join(c.dir, key)
+	res.Thumbnail = key
+	if info, err := os.Stat(path); err == nil {
+		res.Bytes, res.Cached = info.Size(), true
+		return res
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	if err := checkSize(data, opts); err != nil {
+		return fail(fmt.Errorf("%s: %v", j.name, err))
+	}
+	var buf bytes.Buffer
+	if err := opts.Stream(&buf, bytes.NewReader(data)); err != nil {
+		return fail(fmt.Errorf("%s: %v", j.name, err))
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+
+	// Write to a temporary file and rename it, so that concurrent
+	// requests for the same thumbnail never see a partial file.
+	tmp, err := ioutil.TempFile(c.dir, "tmp-")
+	if err != nil {
+		return fail(err)
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fail(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fail(err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fail(err)
+	}
+	res.Bytes = int64(buf.Len())
+	return res
+}
+
+// Limits on the size of images, which bound the memory and time each
+// job takes.
+const (
+	maxSourcePixels = 1 << 25
+	maxThumbPixels  = 4096 * 4096
+)
+
+// checkSize returns an error if the image encoded in data, or its
+// thumbnail under opts, is too large, without decoding the image.
+func checkSize(data []byte, opts thumbnail.Options) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxSourcePixels {
+		return fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	// EXIF data may turn the image on its side.
+	for _, src := range []image.Point{{cfg.Width, cfg.Height}, {cfg.Height, cfg.Width}} {
+		if size := opts.Size(src); int64(size.X)*int64(size.Y) > maxThumbPixels {
+			return fmt.Errorf("thumbnail of %dx%d pixels is too large", size.X, size.Y)
+		}
+	}
+	return nil
+}
+
+// imageExts are the file name extensions of images found in directories.
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true}
+
+// dirJobs returns a job for each image file in the tree rooted at dir.
+func dirJobs(dir string) ([]job, error) {
+	var jobs []job
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && imageExts[strings.ToLower(filepath.Ext(path))] {
+			jobs = append(jobs, fileJob(path))
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// parseOptions returns the thumbnail options given by the width,
+// height, fit, filter and format parameters. Missing ones keep
+// their default values.
+func parseOptions(params url.Values) (thumbnail.Options, error) {
+	var opts thumbnail.Options
+	var err error
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"width", &opts.Width}, {"height", &opts.Height}} {
+		if s := params.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 || n > 4096 {
+				return opts, fmt.Errorf("invalid %s %q", p.name, s)
+			}
+			*p.dst = n
+		}
+	}
+	if s := params.Get("fit"); s != "" {
+		if opts.Fit, err = thumbnail.ParseFit(s); err != nil {
+			return opts, err
+		}
+	}
+	if s := params.Get("filter"); s != "" {
+		if opts.Filter, err = thumbnail.ParseFilter(s); err != nil {
+			return opts, err
+		}
+	}
+	if s := params.Get("format"); s != "" {
+		if opts.Format, err = thumbnail.ParseFormat(s); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
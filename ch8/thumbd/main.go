@@ -0,0 +1,122 @@
+// Thumbd makes thumbnails of many images at once, either from the
+// command line or as an HTTP service.
+//
+// Thumbnails are made by a bounded pool of workers and cached in a
+// directory, keyed by a hash of each image's content and the options.
+// Every batch produces a manifest reporting the outcome for each image
+// and the total size of the thumbnails, as makeThumbnails6 does in
+// gopl.io/ch8/thumbnail; one failing image does not spoil the batch.
+// Images, and thumbnails, too large to make in bounded memory fail
+// before they are decoded.
+//
+// On the command line, each argument is an image file or a directory
+// whose images are thumbnailed, and the manifest is printed as JSON:
+//
+//	$ go run ./ch8/thumbd -width=200 -fit=cover ~/Pictures
+//
+// With -http, thumbd serves POST /thumbnails, which accepts images
+// uploaded as multipart "image" fields, and, if -root is set, "dir"
+// parameters naming directories beneath it. The width, height, fit,
+// filter and format parameters select the options. The thumbnails
+// are then available under /cache/. Work on behalf of a request
+// stops when its client goes away.
+//
+//	$ go run ./ch8/thumbd -http=localhost:8000 &
+//	$ curl -F image=@foo.jpeg 'localhost:8000/thumbnails?format=png'
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+var (
+	addr     = flag.String("http", "", "serve HTTP on `address` instead of processing arguments")
+	cacheDir = flag.String("cache", "thumbcache", "cache `directory` for thumbnails")
+	root     = flag.String("root", "", "allow HTTP clients to thumbnail directories beneath `dir`")
+	workers  = flag.Int("j", runtime.NumCPU(), "make at most `n` thumbnails at once")
+
+	width  = flag.Int("width", 0, "thumbnail width (command line)")
+	height = flag.Int("height", 0, "thumbnail height (command line)")
+	fit    = flag.String("fit", "contain", "contain, cover or fill (command line)")
+	filter = flag.String("filter", "lanczos3", "lanczos3, bilinear or box (command line)")
+	format = flag.String("format", "jpeg", "jpeg, png or gif (command line)")
+)
+
+func main() {
+	flag.Parse()
+	if err := os.MkdirAll(*cacheDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+	c := &cache{dir: *cacheDir}
+
+	if *addr != "" {
+		s := &server{cache: c, workers: *workers, root: *root}
+		http.HandleFunc("/thumbnails", s.thumbnails)
+		http.Handle("/cache/", http.StripPrefix("/cache/", http.FileServer(http.Dir(c.dir))))
+		log.Fatal(http.ListenAndServe(*addr, nil))
+	}
+
+	if flag.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "usage: thumbd [flags] file-or-dir...\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	opts, err := parseOptions(url.Values{
+		"width":  {strconv.Itoa(*width)},
+		"height": {strconv.Itoa(*height)},
+		"fit":    {*fit},
+		"filter": {*filter},
+		"format": {*format},
+	})
+	if err != nil {
+		log.Fatalf("thumbd: %v", err)
+	}
+
+	var jobs []job
+	for _, arg := range flag.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			log.Fatalf("thumbd: %v", err)
+		}
+		if !info.IsDir() {
+			jobs = append(jobs, fileJob(arg))
+			continue
+		}
+		list, err := dirJobs(arg)
+		if err != nil {
+			log.Fatalf("thumbd: %v", err)
+		}
+		jobs = append(jobs, list...)
+	}
+
+	// Cancel outstanding work on interrupt.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	m := c.thumbnails(ctx, jobs, opts, *workers)
+	for i := range m.Results {
+		if t := m.Results[i].Thumbnail; t != "" {
+			m.Results[i].Thumbnail = filepath.Join(c.dir, t)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		log.Fatal(err)
+	}
+	if m.Failed > 0 {
+		stop()
+		os.Exit(1)
+	}
+}
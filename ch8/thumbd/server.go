@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// maxMemory is the number of bytes of an upload held in memory;
+// the rest is stored in temporary files.
+const maxMemory = 32 << 20
+
+// A server handles thumbnail requests over HTTP.
+type server struct {
+	cache   *cache
+	workers int    // per request
+	root    string // directories clients may name; "" for none
+}
+
+// thumbnails handles POST /thumbnails.
+func (s *server) thumbnails(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var err error
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		err = r.ParseMultipartForm(maxMemory)
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseOptions(r.Form)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var jobs []job
+	if r.MultipartForm != nil {
+		for _, fh := range r.MultipartForm.File["image"] {
+			jobs = append(jobs, uploadJob(fh))
+		}
+	}
+	for _, dir := range r.Form["dir"] {
+		path, err := s.resolve(dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		list, err := dirJobs(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jobs = append(jobs, list...)
+	}
+	if len(jobs) == 0 {
+		http.Error(w, "no images: upload \"image\" files or name a \"dir\"", http.StatusBadRequest)
+		return
+	}
+
+	m := s.cache.thumbnails(r.Context(), jobs, opts, s.workers)
+	if r.Context().Err() != nil {
+		return // client has gone away
+	}
+	for i := range m.Results {
+		if t := m.Results[i].Thumbnail; t != "" {
+			m.Results[i].Thumbnail = "/cache/" + t
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m); err != nil {
+		log.Printf("thumbd: writing manifest: %v", err)
+	}
+}
+
+// resolve returns the path of dir beneath the server's root,
+// or an error if directories are not allowed or dir escapes the root,
+// whether by its name or through a symbolic link.
+func (s *server) resolve(dir string) (string, error) {
+	if s.root == "" {
+		return "", fmt.Errorf("directories are not allowed")
+	}
+	path := filepath.Join(s.root, filepath.FromSlash(dir))
+	if !within(s.root, path) {
+		return "", fmt.Errorf("%s: outside root", dir)
+	}
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return "", fmt.Errorf("%s: root not found", dir)
+	}
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: not found", dir)
+	}
+	if !within(root, path) {
+		return "", fmt.Errorf("%s: outside root", dir)
+	}
+	return path, nil
+}
+
+// within reports whether path lies in the tree rooted at root.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// uploadJob returns a job that reads an uploaded file.
+func uploadJob(fh *multipart.FileHeader) job {
+	return job{fh.Filename, func() (io.ReadCloser, error) { return fh.Open() }}
+}
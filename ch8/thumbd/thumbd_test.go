@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func pngData(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// upload posts the named files to the server and decodes the manifest.
+func upload(t *testing.T, url string, files map[string][]byte) *Manifest {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range files {
+		fw, err := mw.CreateFormFile("image", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	mw.Close()
+	resp, err := http.Post(url, mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s: %s", url, resp.Status)
+	}
+	var m Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	return &m
+}
+
+func TestServer(t *testing.T) {
+	c := &cache{dir: t.TempDir()}
+	root := t.TempDir()
+	s := &server{cache: c, workers: 2, root: root}
+	ts := httptest.NewServer(http.HandlerFunc(s.thumbnails))
+	defer ts.Close()
+
+	files := map[string][]byte{
+		"wide.png": pngData(t, 400, 100),
+		"tall.png": pngData(t, 100, 400),
+		"bad.png":  []byte("not an image"),
+	}
+	m := upload(t, ts.URL+"?width=64&height=64&format=png", files)
+	if m.Succeeded != 2 || m.Failed != 1 || len(m.Results) != 3 {
+		t.Fatalf("manifest = %+v, want 2 succeeded, 1 failed", m)
+	}
+	var total int64
+	for _, r := range m.Results {
+		if (r.Err != "") != (r.Name == "bad.png") {
+			t.Errorf("%s: error %q", r.Name, r.Err)
+		}
+		if r.Err == "" {
+			path := filepath.Join(c.dir, filepath.Base(r.Thumbnail))
+			info, err := os.Stat(path)
+			if err != nil || info.Size() != r.Bytes || filepath.Ext(path) != ".png" {
+				t.Errorf("%s: thumbnail %s: %v", r.Name, r.Thumbnail, err)
+			}
+			total += r.Bytes
+		}
+	}
+	if m.TotalBytes != total {
+		t.Errorf("total bytes = %d, want %d", m.TotalBytes, total)
+	}
+
+	// The same image with the same options is served from the cache;
+	// other options produce a new thumbnail.
+	m = upload(t, ts.URL+"?width=64&height=64&format=png", map[string][]byte{"again.png": files["wide.png"]})
+	if !m.Results[0].Cached {
+		t.Errorf("second upload was not cached")
+	}
+	m = upload(t, ts.URL+"?width=32&format=png", map[string][]byte{"again.png": files["wide.png"]})
+	if m.Results[0].Cached || m.Results[0].Err != "" {
+		t.Errorf("upload with new options: %+v", m.Results[0])
+	}
+
+	// Directories beneath the root may be named; others may not.
+	os.MkdirAll(filepath.Join(root, "pics"), 0755)
+	os.WriteFile(filepath.Join(root, "pics", "a.png"), files["tall.png"], 0644)
+	os.WriteFile(filepath.Join(root, "pics", "notes.txt"), []byte("hi"), 0644)
+	resp, err := http.PostForm(ts.URL, url.Values{"dir": {"pics"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dm Manifest
+	json.NewDecoder(resp.Body).Decode(&dm)
+	resp.Body.Close()
+	if len(dm.Results) != 1 || dm.Succeeded != 1 {
+		t.Errorf("dir manifest = %+v, want one success", dm)
+	}
+	resp, err = http.PostForm(ts.URL, url.Values{"dir": {"../"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dir outside root: %s, want 403", resp.Status)
+	}
+
+	// Nor may a link beneath the root lead outside it.
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.png"), files["tall.png"], 0644)
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+	resp, err = http.PostForm(ts.URL, url.Values{"dir": {"escape"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("dir linked outside root: %s, want 403", resp.Status)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := &server{cache: &cache{dir: t.TempDir()}, workers: 2}
+	ts := httptest.NewServer(http.HandlerFunc(s.thumbnails))
+	defer ts.Close()
+
+	// A PNG whose header claims more pixels than it holds.
+	huge := pngData(t, 1, 1)
+	binary.BigEndian.PutUint32(huge[16:], 8192) // IHDR width
+	binary.BigEndian.PutUint32(huge[20:], 8192) // and height
+	binary.BigEndian.PutUint32(huge[29:], crc32.ChecksumIEEE(huge[12:29]))
+
+	for _, test := range []struct {
+		query string
+		data  []byte
+	}{
+		{"", huge},
+		{"?width=4096&fit=cover", pngData(t, 1, 10000)},
+		{"?height=4096&fit=fill", pngData(t, 10000, 1)},
+	} {
+		m := upload(t, ts.URL+test.query, map[string][]byte{"big.png": test.data})
+		if m.Failed != 1 || !strings.Contains(m.Results[0].Err, "too large") {
+			t.Errorf("%s: %+v, want too large", test.query, m.Results[0])
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// exifOrientation returns the value of the Orientation tag in the
+// EXIF metadata of a JPEG file, or 1 (upright) if there is none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1 // not a JPEG
+	}
+	for p := 2; p+4 <= len(data); {
+		if data[p] != 0xFF {
+			return 1
+		}
+		marker := data[p+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan, end of image
+			return 1
+		}
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if n < 2 || p+2+n > len(data) {
+			return 1
+		}
+		seg := data[p+4 : p+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		p += 2 + n
+	}
+	return 1
+}
+
+// tiffOrientation returns the Orientation tag (0x0112) of the
+// first image file directory of the TIFF structure in data.
+func tiffOrientation(data []byte) int {
+	if len(data) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(data[4:]))
+	if ifd < 0 || ifd+2 > len(data) {
+		return 1
+	}
+	count := int(order.Uint16(data[ifd:]))
+	for i := 0; i < count; i++ {
+		e := ifd + 2 + 12*i
+		if e+12 > len(data) {
+			break
+		}
+		if order.Uint16(data[e:]) == 0x0112 {
+			return int(order.Uint16(data[e+8:])) // SHORT value, left-justified
+		}
+	}
+	return 1
+}
@@ -0,0 +1,240 @@
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// A Fit determines how an image is fitted into the thumbnail box.
+type Fit int
+
+const (
+	Contain Fit = iota // scale to fit inside the box, preserving aspect ratio
+	Cover              // scale to cover the box, cropping the excess
+	Fill               // stretch to the box, ignoring aspect ratio
+)
+
+// A Filter is a resampling filter.
+type Filter int
+
+const (
+	Lanczos3 Filter = iota // sharpest; may ring slightly at hard edges
+	Bilinear               // triangle filter
+	Box                    // area average
+)
+
+// A Format is an output image encoding.
+type Format int
+
+const (
+	JPEG Format = iota
+	PNG
+	GIF
+)
+
+var (
+	fitNames    = []string{"contain", "cover", "fill"}
+	filterNames = []string{"lanczos3", "bilinear", "box"}
+	formatNames = []string{"jpeg", "png", "gif"}
+)
+
+func (f Fit) String() string    { return name(fitNames, int(f)) }
+func (f Filter) String() string { return name(filterNames, int(f)) }
+func (f Format) String() string { return name(formatNames, int(f)) }
+
+func name(names []string, i int) string {
+	if i < 0 || i >= len(names) {
+		return fmt.Sprintf("%d", i)
+	}
+	return names[i]
+}
+
+func lookup(kind string, names []string, s string) (int, error) {
+	for i, name := range names {
+		if s == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown %s %q", kind, s)
+}
+
+// ParseFit returns the Fit named s, such as "cover".
+func ParseFit(s string) (Fit, error) {
+	i, err := lookup("fit", fitNames, s)
+	return Fit(i), err
+}
+
+// ParseFilter returns the Filter named s, such as "bilinear".
+func ParseFilter(s string) (Filter, error) {
+	i, err := lookup("filter", filterNames, s)
+	return Filter(i), err
+}
+
+// ParseFormat returns the Format named s, such as "png".
+func ParseFormat(s string) (Format, error) {
+	if s == "jpg" {
+		return JPEG, nil
+	}
+	i, err := lookup("format", formatNames, s)
+	return Format(i), err
+}
+
+// Options control the size, resampling and encoding of a thumbnail.
+// The zero value produces a JPEG that fits in a 128x128 box,
+// resampled with Lanczos3. A side that follows the aspect ratio is
+// no longer than the other side or the image's, whichever is greater.
+type Options struct {
+	Width, Height int // box size; if one is zero, it follows the aspect ratio
+	Fit           Fit
+	Filter        Filter
+	Format        Format
+}
+
+// Ext returns the file name extension for the output format, e.g. ".png".
+func (o Options) Ext() string {
+	if o.Format == JPEG {
+		return ".jpeg"
+	}
+	return "." + o.Format.String()
+}
+
+// Image returns a thumbnail-size version of src.
+func (o Options) Image(src image.Image) image.Image {
+	return o.image(src, 1)
+}
+
+func (o Options) image(src image.Image, orientation int) image.Image {
+	img := orient(toRGBA(src), orientation)
+	if img.Rect.Empty() {
+		return img
+	}
+	w, h, crop := o.layout(img.Rect)
+	return resample(img.SubImage(crop).(*image.RGBA), w, h, o.Filter)
+}
+
+// Size returns the size of the thumbnail of an image of size src,
+// as oriented for display.
+func (o Options) Size(src image.Point) image.Point {
+	if src.X <= 0 || src.Y <= 0 {
+		return image.Point{}
+	}
+	w, h, _ := o.layout(image.Rectangle{Max: src})
+	return image.Pt(w, h)
+}
+
+// layout returns the size of the thumbnail of the non-empty image
+// bounds r and the part of r that it shows.
+func (o Options) layout(r image.Rectangle) (w, h int, crop image.Rectangle) {
+	sw, sh := r.Dx(), r.Dy()
+
+	// A missing side follows the aspect ratio, but is no longer than
+	// the given side or the image's, whichever is greater, so that a
+	// thin image cannot make a huge thumbnail.
+	w, h = o.Width, o.Height
+	switch {
+	case w <= 0 && h <= 0:
+		w, h = 128, 128
+	case w <= 0:
+		w = min(max(1, h*sw/sh), max(h, sw))
+	case h <= 0:
+		h = min(max(1, w*sh/sw), max(w, sh))
+	}
+
+	crop = r
+	switch o.Fit {
+	case Contain:
+		if sw*h > sh*w { // wider than the box
+			h = max(1, (w*sh+sw/2)/sw)
+		} else {
+			w = max(1, (h*sw+sh/2)/sh)
+		}
+	case Cover:
+		if sw*h > sh*w { // wider than the box: crop left and right
+			cw := (sh*w + h/2) / h
+			crop.Min.X += (sw - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else { // taller than the box: crop top and bottom
+			ch := (sw*h + w/2) / w
+			crop.Min.Y += (sh - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+	}
+	return w, h, crop
+}
+
+// Encode writes img to w in the output format.
+func (o Options) Encode(w io.Writer, img image.Image) error {
+	switch o.Format {
+	case PNG:
+		return png.Encode(w, img)
+	case GIF:
+		return gif.Encode(w, img, nil)
+	default:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	}
+}
+
+// MaxPixels is the size of the largest image that Stream decodes.
+const MaxPixels = 1 << 26
+
+// Stream reads an image from r and writes a thumbnail of it to w.
+// The orientation recorded in a JPEG's EXIF data is honored.
+func (o Options) Stream(w io.Writer, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return o.Encode(w, o.image(src, exifOrientation(data)))
+}
+
+// File reads an image from infile and writes a thumbnail of it to outfile.
+func (o Options) File(outfile, infile string) (err error) {
+	in, err := os.Open(infile)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(outfile)
+	if err != nil {
+		return err
+	}
+
+	if err := o.Stream(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("scaling %s to %s: %s", infile, outfile, err)
+	}
+	return out.Close()
+}
+
+func min(x, y int) int {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
@@ -0,0 +1,263 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+// testImage returns a 200x120 image with smooth gradients,
+// a hard-edged disk and fine stripes.
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 120))
+	for y := 0; y < 120; y++ {
+		for x := 0; x < 200; x++ {
+			c := color.NRGBA{uint8(x * 255 / 199), uint8(y * 255 / 119), 128, 255}
+			if math.Hypot(float64(x-140), float64(y-60)) < 40 {
+				c = color.NRGBA{255, 255, 255, 255}
+			}
+			if x < 40 && (x/2)%2 == 0 {
+				c = color.NRGBA{0, 0, 0, 255}
+			}
+			if y < 10 {
+				c.A = uint8(x) // translucent strip
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+var goldenTests = []struct {
+	name string
+	opts Options
+}{
+	{"contain-lanczos3", Options{Width: 64, Height: 64}},
+	{"cover-bilinear", Options{Width: 64, Height: 64, Fit: Cover, Filter: Bilinear}},
+	{"fill-box", Options{Width: 50, Height: 50, Fit: Fill, Filter: Box}},
+	{"width-only", Options{Width: 80}},
+	{"upscale", Options{Width: 300, Height: 300, Filter: Bilinear}},
+}
+
+func TestGolden(t *testing.T) {
+	src := testImage()
+	for _, test := range goldenTests {
+		got := test.opts.Image(src)
+		path := filepath.Join("testdata", test.name+".png")
+		if *update {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, got); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if err := compare(got, want, 2); err != "" {
+			t.Errorf("%s: %s", test.name, err)
+		}
+	}
+}
+
+// compare reports the first difference between got and want that
+// exceeds tol in any 8-bit channel, or "" if there is none.
+func compare(got, want image.Image, tol int) string {
+	if got.Bounds() != want.Bounds() {
+		return fmt.Sprintf("bounds %v, want %v", got.Bounds(), want.Bounds())
+	}
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			g := color.NRGBAModel.Convert(got.At(x, y)).(color.NRGBA)
+			w := color.NRGBAModel.Convert(want.At(x, y)).(color.NRGBA)
+			if g.A == 0 && w.A == 0 {
+				continue
+			}
+			if diff(g.R, w.R) > tol || diff(g.G, w.G) > tol ||
+				diff(g.B, w.B) > tol || diff(g.A, w.A) > tol {
+				return fmt.Sprintf("%v: got %v, want %v", image.Pt(x, y), g, w)
+			}
+		}
+	}
+	return ""
+}
+
+func diff(x, y uint8) int {
+	if x > y {
+		return int(x - y)
+	}
+	return int(y - x)
+}
+
+func TestIdentity(t *testing.T) {
+	src := toRGBA(testImage())
+	for _, filter := range []Filter{Lanczos3, Bilinear, Box} {
+		got := resample(src, 200, 120, filter)
+		if err := compare(got, src, 0); err != "" {
+			t.Errorf("%s: %s", filter, err)
+		}
+	}
+}
+
+// exifJPEG returns a JPEG encoding of img with an EXIF
+// Orientation tag, in the given byte order.
+func exifJPEG(t *testing.T, img image.Image, orientation uint16, order binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	var tiff bytes.Buffer
+	if order == binary.LittleEndian {
+		tiff.WriteString("II")
+	} else {
+		tiff.WriteString("MM")
+	}
+	binary.Write(&tiff, order, uint16(42))
+	binary.Write(&tiff, order, uint32(8))                // offset of IFD0
+	binary.Write(&tiff, order, uint16(1))                // one entry
+	binary.Write(&tiff, order, []uint16{0x0112, 3})      // Orientation, SHORT
+	binary.Write(&tiff, order, uint32(1))                // count
+	binary.Write(&tiff, order, []uint16{orientation, 0}) // value
+	binary.Write(&tiff, order, uint32(0))                // no next IFD
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(seg)+2))
+	data := buf.Bytes()
+	return append(append(append([]byte{}, data[:2]...), append(app1, seg...)...), data[2:]...)
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	// Left half red, right half blue.
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 32 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.SetRGBA(x, y, c)
+		}
+	}
+
+	for _, test := range []struct {
+		orientation       uint16
+		order             binary.ByteOrder
+		w, h              int
+		topLeft, botRight bool // red?
+	}{
+		{1, binary.BigEndian, 32, 16, true, false},
+		{3, binary.LittleEndian, 32, 16, false, true},
+		{6, binary.BigEndian, 16, 32, true, false},    // left side becomes the top
+		{8, binary.LittleEndian, 16, 32, false, true}, // left side becomes the bottom
+	} {
+		data := exifJPEG(t, src, test.orientation, test.order)
+		if got := exifOrientation(data); got != int(test.orientation) {
+			t.Errorf("exifOrientation = %d, want %d", got, test.orientation)
+		}
+		var out bytes.Buffer
+		opts := Options{Width: 32, Height: 32, Format: PNG}
+		if err := opts.Stream(&out, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := img.Bounds()
+		if b.Dx() != test.w || b.Dy() != test.h {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d",
+				test.orientation, b.Dx(), b.Dy(), test.w, test.h)
+			continue
+		}
+		red := func(x, y int) bool {
+			r, _, b, _ := img.At(x, y).RGBA()
+			return r > b
+		}
+		if red(1, 1) != test.topLeft || red(b.Dx()-2, b.Dy()-2) != test.botRight {
+			t.Errorf("orientation %d: wrong rotation", test.orientation)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if f, err := ParseFit("cover"); err != nil || f != Cover {
+		t.Errorf("ParseFit(cover) = %v, %v", f, err)
+	}
+	if f, err := ParseFilter("box"); err != nil || f != Box {
+		t.Errorf("ParseFilter(box) = %v, %v", f, err)
+	}
+	if f, err := ParseFormat("jpg"); err != nil || f != JPEG {
+		t.Errorf("ParseFormat(jpg) = %v, %v", f, err)
+	}
+	if _, err := ParseFormat("webp"); err == nil {
+		t.Errorf("ParseFormat(webp) succeeded")
+	}
+}
+
+// pngHeader returns the signature and header chunk of a PNG image of
+// the given size, which is enough for image.DecodeConfig.
+func pngHeader(width, height uint32) []byte {
+	ihdr := []byte("IHDR\x00\x00\x00\x00\x00\x00\x00\x00\x08\x02\x00\x00\x00")
+	binary.BigEndian.PutUint32(ihdr[4:], width)
+	binary.BigEndian.PutUint32(ihdr[8:], height)
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)-4))
+	buf.Write(ihdr)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr))
+	return buf.Bytes()
+}
+
+func TestBounds(t *testing.T) {
+	// A missing side may not exceed the given one and the image's.
+	thin := image.NewRGBA(image.Rect(0, 0, 1, 1000))
+	for _, test := range []struct {
+		opts Options
+		src  image.Image
+		want image.Point
+	}{
+		{Options{Width: 100}, thin, image.Pt(1, 1000)},
+		{Options{Height: 10}, thin, image.Pt(1, 10)},
+		{Options{Width: 100}, image.NewRGBA(image.Rect(0, 0, 10, 20)), image.Pt(50, 100)},
+		{Options{Height: 100}, image.NewRGBA(image.Rect(0, 0, 1000, 1)), image.Pt(1000, 1)},
+		{Options{Width: 100, Fit: Cover}, thin, image.Pt(100, 1000)},
+	} {
+		if got := test.opts.Image(test.src).Bounds().Size(); got != test.want {
+			t.Errorf("%+v of %v image: %v, want %v", test.opts, test.src.Bounds().Size(), got, test.want)
+		}
+		if got := test.opts.Size(test.src.Bounds().Size()); got != test.want {
+			t.Errorf("%+v.Size(%v) = %v, want %v", test.opts, test.src.Bounds().Size(), got, test.want)
+		}
+	}
+
+	// Stream refuses to decode huge images.
+	var buf bytes.Buffer
+	err := Options{}.Stream(&buf, bytes.NewReader(pngHeader(1<<16, 1<<16)))
+	if err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("Stream of 65536x65536 image: got %v, want too large", err)
+	}
+}
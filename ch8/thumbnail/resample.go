@@ -0,0 +1,226 @@
+package thumbnail
+
+import (
+	"image"
+	"image/draw"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// A kernel is a resampling filter function with the given support:
+// it is zero outside (-support, +support).
+type kernel struct {
+	support float64
+	at      func(x float64) float64
+}
+
+var kernels = map[Filter]kernel{
+	Box: {0.5, func(x float64) float64 {
+		if x >= -0.5 && x < 0.5 {
+			return 1
+		}
+		return 0
+	}},
+	Bilinear: {1, func(x float64) float64 {
+		if x = math.Abs(x); x < 1 {
+			return 1 - x
+		}
+		return 0
+	}},
+	Lanczos3: {3, func(x float64) float64 {
+		if x = math.Abs(x); x < 3 {
+			return sinc(x) * sinc(x/3)
+		}
+		return 0
+	}},
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// A tap is the contribution of source sample i to an output sample.
+type tap struct {
+	i int
+	w float32
+}
+
+// weights returns, for each of the out output samples, the normalized
+// filter taps over in input samples.
+func weights(in, out int, k kernel) [][]tap {
+	scale := float64(in) / float64(out)
+	stretch := math.Max(scale, 1) // widen the filter when downsampling
+	radius := k.support * stretch
+	taps := make([][]tap, out)
+	for o := range taps {
+		center := (float64(o)+0.5)*scale - 0.5
+		lo := int(math.Ceil(center - radius))
+		hi := int(math.Floor(center + radius))
+		var sum float64
+		var ts []tap
+		for i := lo; i <= hi; i++ {
+			w := k.at((float64(i) - center) / stretch)
+			if w == 0 {
+				continue
+			}
+			j := i // clamp to the edge
+			if j < 0 {
+				j = 0
+			} else if j >= in {
+				j = in - 1
+			}
+			ts = append(ts, tap{j, float32(w)})
+			sum += w
+		}
+		if sum == 0 { // e.g., box filter between samples
+			ts = []tap{{clamp(int(center+0.5), in), 1}}
+			sum = 1
+		}
+		for t := range ts {
+			ts[t].w /= float32(sum)
+		}
+		taps[o] = ts
+	}
+	return taps
+}
+
+func clamp(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// resample scales src to w x h using the filter, first horizontally
+// and then vertically. Each pass is split by rows among goroutines.
+func resample(src *image.RGBA, w, h int, filter Filter) *image.RGBA {
+	k := kernels[filter]
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	xtaps := weights(sw, w, k)
+	ytaps := weights(sh, h, k)
+
+	// Horizontal pass: sw x sh -> w x sh, as premultiplied float RGBA.
+	tmp := make([]float32, w*sh*4)
+	parallelRows(sh, func(y int) {
+		row := src.Pix[src.PixOffset(src.Rect.Min.X, src.Rect.Min.Y+y):]
+		out := tmp[y*w*4 : (y+1)*w*4]
+		for x, ts := range xtaps {
+			var r, g, b, a float32
+			for _, t := range ts {
+				p := row[t.i*4 : t.i*4+4]
+				r += float32(p[0]) * t.w
+				g += float32(p[1]) * t.w
+				b += float32(p[2]) * t.w
+				a += float32(p[3]) * t.w
+			}
+			out[x*4], out[x*4+1], out[x*4+2], out[x*4+3] = r, g, b, a
+		}
+	})
+
+	// Vertical pass: w x sh -> w x h.
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	parallelRows(h, func(y int) {
+		out := dst.Pix[y*dst.Stride : y*dst.Stride+w*4]
+		for x := 0; x < w; x++ {
+			var r, g, b, a float32
+			for _, t := range ytaps[y] {
+				p := tmp[(t.i*w+x)*4 : (t.i*w+x)*4+4]
+				r += p[0] * t.w
+				g += p[1] * t.w
+				b += p[2] * t.w
+				a += p[3] * t.w
+			}
+			// Premultiplied color may not exceed alpha.
+			alpha := toByte(a, 255)
+			out[x*4+3] = alpha
+			out[x*4] = toByte(r, alpha)
+			out[x*4+1] = toByte(g, alpha)
+			out[x*4+2] = toByte(b, alpha)
+		}
+	})
+	return dst
+}
+
+// toByte rounds v to the nearest integer in [0, max].
+func toByte(v float32, max uint8) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= float32(max) {
+		return max
+	}
+	return uint8(v + 0.5)
+}
+
+// parallelRows calls f(y) for each y in [0, n),
+// dividing the rows among one goroutine per CPU.
+func parallelRows(n int, f func(y int)) {
+	workers := runtime.NumCPU()
+	if workers > n {
+		workers = n
+	}
+	var wg sync.WaitGroup
+	for k := 0; k < workers; k++ {
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			for y := k * n / workers; y < (k+1)*n/workers; y++ {
+				f(y)
+			}
+		}(k)
+	}
+	wg.Wait()
+}
+
+// toRGBA returns src as an *image.RGBA whose bounds start at (0, 0).
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) to img, so that the
+// result appears upright. Other values leave img unchanged.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 { // rotated by 90 degrees
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // needs 90 clockwise rotation
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // needs 90 counterclockwise rotation
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], img.Pix[img.PixOffset(sx, sy):])
+		}
+	}
+	return dst
+}
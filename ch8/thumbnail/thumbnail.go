@@ -4,7 +4,9 @@
 // See page 234.
 
 // The thumbnail package produces thumbnail-size images from
-// larger images.  Only JPEG images are currently supported.
+// larger images.  Image, ImageStream and ImageFile use a crude
+// scaling algorithm and write only JPEG images; an Options value
+// selects the size, fit, resampling filter and output format.
 package thumbnail
 
 import (